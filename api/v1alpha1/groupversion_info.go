@@ -15,6 +15,11 @@ limitations under the License.
 */
 
 // Package v1alpha1 contains API Schema definitions for the hive v1alpha1 API group
+//
+// v1alpha1 remains the model the controller and the webhooks work with, while
+// v1alpha2 is the storage version. Objects stored as v1alpha2 are converted by
+// the conversion webhook, and the types whose schema is the same in both
+// versions are aliases of the v1alpha2 types.
 // +kubebuilder:object:generate=true
 // +groupName=hive.kubedoop.dev
 package v1alpha1
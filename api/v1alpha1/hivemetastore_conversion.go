@@ -0,0 +1,198 @@
+/*
+Copyright 2024 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	hivev1alpha2 "github.com/zncdatadev/hive-operator/api/v1alpha2"
+)
+
+// databaseTypeDerby is the embedded database, its databaseName is the path of the database.
+const databaseTypeDerby = "derby"
+
+var _ conversion.Convertible = &HiveMetastore{}
+
+// ConvertTo converts this HiveMetastore to the hub version v1alpha2.
+// The types shared with the hub are aliases, they are copied as is.
+func (src *HiveMetastore) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*hivev1alpha2.HiveMetastore)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = hivev1alpha2.HiveMetastoreSpec{
+		Image:            src.Spec.Image,
+		ClusterConfig:    convertClusterConfigTo(src.Spec.ClusterConfig),
+		ClusterOperation: src.Spec.ClusterOperation,
+		Metastore:        src.Spec.Metastore,
+		HiveServer2:      src.Spec.HiveServer2,
+	}
+
+	dst.Status = hivev1alpha2.HiveMetastoreStatus{
+		Conditions:         src.Status.Conditions,
+		Replicas:           src.Status.Replicas,
+		ReadyReplicas:      src.Status.ReadyReplicas,
+		ObservedGeneration: src.Status.ObservedGeneration,
+		RoleGroups:         src.Status.RoleGroups,
+		Schema:             src.Status.Schema,
+		Backup:             src.Status.Backup,
+		Restore:            src.Status.Restore,
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version v1alpha2 to this version.
+func (dst *HiveMetastore) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*hivev1alpha2.HiveMetastore)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec = HiveMetastoreSpec{
+		Image:            src.Spec.Image,
+		ClusterConfig:    convertClusterConfigFrom(src.Spec.ClusterConfig),
+		ClusterOperation: src.Spec.ClusterOperation,
+		Metastore:        src.Spec.Metastore,
+		HiveServer2:      src.Spec.HiveServer2,
+	}
+
+	dst.Status = HiveMetastoreStatus{
+		Conditions:         src.Status.Conditions,
+		Replicas:           src.Status.Replicas,
+		ReadyReplicas:      src.Status.ReadyReplicas,
+		ObservedGeneration: src.Status.ObservedGeneration,
+		RoleGroups:         src.Status.RoleGroups,
+		Schema:             src.Status.Schema,
+		Backup:             src.Status.Backup,
+		Restore:            src.Status.Restore,
+	}
+	return nil
+}
+
+func convertClusterConfigTo(src *ClusterConfigSpec) *hivev1alpha2.ClusterConfigSpec {
+	if src == nil {
+		return nil
+	}
+	dst := &hivev1alpha2.ClusterConfigSpec{
+		VectorAggregatorConfigMapName: src.VectorAggregatorConfigMapName,
+		Database:                      convertDatabaseTo(src.Database),
+		S3:                            src.S3,
+		ListenerClass:                 src.ListenerClass,
+		HDFS:                          src.HDFS,
+		Backup:                        src.Backup,
+		RestoreFrom:                   src.RestoreFrom,
+	}
+	if src.Authentication != nil {
+		dst.Authentication = &hivev1alpha2.AuthenticationSpec{
+			Tls:      (*hivev1alpha2.TlsSpec)(src.Authentication.Tls),
+			Kerberos: (*hivev1alpha2.KerberosSpec)(src.Authentication.Kerberos),
+		}
+	}
+	return dst
+}
+
+func convertClusterConfigFrom(src *hivev1alpha2.ClusterConfigSpec) *ClusterConfigSpec {
+	if src == nil {
+		return nil
+	}
+	dst := &ClusterConfigSpec{
+		VectorAggregatorConfigMapName: src.VectorAggregatorConfigMapName,
+		Database:                      convertDatabaseFrom(src.Database),
+		S3:                            src.S3,
+		ListenerClass:                 src.ListenerClass,
+		HDFS:                          src.HDFS,
+		Backup:                        src.Backup,
+		RestoreFrom:                   src.RestoreFrom,
+	}
+	if src.Authentication != nil {
+		dst.Authentication = &AuthenticationSpec{
+			Tls:      (*TlsSpec)(src.Authentication.Tls),
+			Kerberos: (*KerberosSpec)(src.Authentication.Kerberos),
+		}
+	}
+	return dst
+}
+
+// convertDatabaseTo splits the flat database of v1alpha1 into the raw URL, the server and derby.
+// The databaseName is the path of the derby database, and the name on the server for the other types.
+// Fields v1alpha1 ignores are dropped, so the hub satisfies its validation rules: the server fields
+// are not used with a connString, and the storage is only used by derby.
+func convertDatabaseTo(src *DatabaseSpec) *hivev1alpha2.DatabaseSpec {
+	if src == nil {
+		return nil
+	}
+	dst := &hivev1alpha2.DatabaseSpec{
+		Type:              src.DatabaseType,
+		JdbcURL:           src.ConnString,
+		CredentialsSecret: src.CredentialsSecret,
+		Credentials:       (*hivev1alpha2.DatabaseCredentialsSpec)(src.Credentials),
+		Tls:               (*hivev1alpha2.DatabaseTlsSpec)(src.Tls),
+		WaitTimeout:       src.WaitTimeout,
+		MaxConnections:    src.MaxConnections,
+	}
+
+	if src.DatabaseType == databaseTypeDerby {
+		derby := hivev1alpha2.DerbySpec{
+			Path:    src.DatabaseName,
+			Storage: src.Storage,
+		}
+		if !reflect.DeepEqual(derby, hivev1alpha2.DerbySpec{}) {
+			dst.Derby = &derby
+		}
+		return dst
+	}
+
+	server := hivev1alpha2.DatabaseServerSpec{
+		Host:         src.Host,
+		Port:         src.Port,
+		DatabaseName: src.DatabaseName,
+		SSLMode:      src.SSLMode,
+		Parameters:   src.Parameters,
+	}
+	if src.ConnString == "" && !reflect.DeepEqual(server, hivev1alpha2.DatabaseServerSpec{}) {
+		dst.Server = &server
+	}
+	return dst
+}
+
+func convertDatabaseFrom(src *hivev1alpha2.DatabaseSpec) *DatabaseSpec {
+	if src == nil {
+		return nil
+	}
+	dst := &DatabaseSpec{
+		DatabaseType:      src.Type,
+		ConnString:        src.JdbcURL,
+		CredentialsSecret: src.CredentialsSecret,
+		Credentials:       (*DatabaseCredentialsSpec)(src.Credentials),
+		Tls:               (*DatabaseTlsSpec)(src.Tls),
+		WaitTimeout:       src.WaitTimeout,
+		MaxConnections:    src.MaxConnections,
+	}
+	if server := src.Server; server != nil {
+		dst.Host = server.Host
+		dst.Port = server.Port
+		dst.DatabaseName = server.DatabaseName
+		dst.SSLMode = server.SSLMode
+		dst.Parameters = server.Parameters
+	}
+	if derby := src.Derby; derby != nil {
+		dst.Storage = derby.Storage
+		if derby.Path != "" {
+			dst.DatabaseName = derby.Path
+		}
+	}
+	return dst
+}
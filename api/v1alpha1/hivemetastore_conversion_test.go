@@ -0,0 +1,377 @@
+/*
+Copyright 2024 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	hivev1alpha2 "github.com/zncdatadev/hive-operator/api/v1alpha2"
+)
+
+func newTestHiveMetastore(database *DatabaseSpec) *HiveMetastore {
+	now := metav1.NewTime(time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC))
+	return &HiveMetastore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "hive",
+			Namespace:  "default",
+			Labels:     map[string]string{"app": "hive"},
+			Generation: 2,
+		},
+		Spec: HiveMetastoreSpec{
+			Image: &ImageSpec{
+				Repo:           DefaultRepository,
+				ProductVersion: DefaultProductVersion,
+				PullPolicy:     corev1.PullIfNotPresent,
+			},
+			ClusterConfig: &ClusterConfigSpec{
+				Database: database,
+				S3: &S3Spec{
+					Reference: "minio",
+					Buckets:   []string{"warehouse"},
+				},
+				ListenerClass: "cluster-internal",
+				Authentication: &AuthenticationSpec{
+					Tls: &TlsSpec{SecretClass: "tls", JksPassword: "changeit"},
+				},
+				Backup: &BackupSpec{
+					Schedule:  "0 3 * * *",
+					Retention: 7,
+					Target: &BackupTargetSpec{
+						S3: &S3Spec{
+							Inline: &s3v1alpha1.S3ConnectionSpec{Host: "minio", Port: 9000},
+						},
+						Bucket: "backups",
+					},
+				},
+				RestoreFrom: &RestoreSpec{
+					S3:     &S3Spec{Reference: "minio"},
+					Bucket: "backups",
+					Key:    "hive/metastore-20240101T030000Z.pgdump",
+				},
+			},
+			ClusterOperation: &commonsv1alpha1.ClusterOperationSpec{Stopped: true},
+			Metastore: &RoleSpec{
+				Config: &ConfigSpec{
+					WarehouseDir: "s3a://warehouse/hive",
+					Libraries: []LibrarySpec{
+						{Name: "postgresql.jar", URL: "https://example.com/postgresql.jar"},
+						{Name: "hook.jar", Image: &LibraryImageSpec{Image: "hook:1.0", Path: "/hook.jar"}},
+						{Name: "listener.jar", S3: &LibraryS3Spec{Bucket: "libs", Key: "listener.jar"}},
+					},
+					Performance: &PerformanceSpec{
+						ConnectionPool: &ConnectionPoolSpec{Type: "HikariCP", MaxPoolSize: ptr.To[int32](5)},
+						DirectSQL:      ptr.To(false),
+						Cache:          &DataNucleusCacheSpec{Enabled: true, Type: "weak"},
+					},
+				},
+				RoleGroups: map[string]*RoleGroupSpec{
+					"default": {
+						Replicas: 2,
+						Config: &ConfigSpec{
+							RoleGroupConfigSpec: &commonsv1alpha1.RoleGroupConfigSpec{GracefulShutdownTimeout: "1m"},
+						},
+						OverridesSpec: &commonsv1alpha1.OverridesSpec{
+							ConfigOverrides: map[string]map[string]string{
+								"hive-site.xml": {"hive.metastore.event.db.notification.api.auth": "false"},
+							},
+						},
+					},
+				},
+			},
+			HiveServer2: &RoleSpec{
+				RoleGroups: map[string]*RoleGroupSpec{"default": {Replicas: 1}},
+			},
+		},
+		Status: HiveMetastoreStatus{
+			Conditions: []metav1.Condition{
+				{Type: ConditionTypeAvailable, Status: metav1.ConditionTrue, Reason: "Available", LastTransitionTime: now},
+			},
+			Replicas:           3,
+			ReadyReplicas:      3,
+			ObservedGeneration: 2,
+			RoleGroups: map[string]RoleGroupStatus{
+				"metastore-default": {Role: "metastore", RoleGroup: "default", Replicas: 2, ReadyReplicas: 2,
+					OverriddenConfigKeys: []string{"hive-site.xml:hive.metastore.event.db.notification.api.auth"}},
+			},
+			Schema:  &SchemaStatus{Version: "4.0.0", JobName: "hive-schema-1", Result: SchemaMigrationSucceeded, LastMigrationTime: &now},
+			Backup:  &BackupStatus{JobName: "hive-backup-1", Result: BackupFailed, Message: "upload failed", LastScheduleTime: &now},
+			Restore: &RestoreStatus{Source: "s3://backups/hive/metastore.pgdump", Phase: RestoreCompleted, StartTime: &now},
+		},
+	}
+}
+
+// assertHubDatabaseValid checks the XValidation rules of the v1alpha2 DatabaseSpec.
+func assertHubDatabaseValid(t *testing.T, database *hivev1alpha2.DatabaseSpec) {
+	t.Helper()
+	if database.JdbcURL != "" && database.Server != nil {
+		t.Errorf("jdbcUrl and server are mutually exclusive: %+v", database)
+	}
+	if database.Type != databaseTypeDerby && database.Derby != nil {
+		t.Errorf("derby is only used with the derby database type: %+v", database)
+	}
+}
+
+func TestHiveMetastoreConversionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		database *DatabaseSpec
+		// expected is the database after the round trip, when v1alpha1 ignores some of its fields.
+		expected *DatabaseSpec
+	}{
+		{
+			name: "postgres server",
+			database: &DatabaseSpec{
+				DatabaseType:      "postgres",
+				Host:              "postgres.default.svc",
+				Port:              5432,
+				DatabaseName:      "hive",
+				SSLMode:           "verify-full",
+				Parameters:        map[string]string{"connectTimeout": "10"},
+				CredentialsSecret: "hive-credentials",
+				Tls:               &DatabaseTlsSpec{SecretClass: "tls"},
+				WaitTimeout:       &metav1.Duration{Duration: time.Minute},
+				MaxConnections:    ptr.To[int32](100),
+			},
+		},
+		{
+			name: "mysql connString",
+			database: &DatabaseSpec{
+				DatabaseType: "mysql",
+				ConnString:   "jdbc:mysql://mysql:3306/hive",
+				Credentials: &DatabaseCredentialsSpec{
+					Credentials: commonsv1alpha1.Credentials{SecretClass: "mysql"},
+					UsernameKey: "user",
+					PasswordKey: "pass",
+				},
+			},
+		},
+		{
+			name: "derby",
+			database: &DatabaseSpec{
+				DatabaseType: "derby",
+				DatabaseName: "/kubedoop/data/metastore_db",
+				Storage:      &commonsv1alpha1.StorageResource{Capacity: resource.MustParse("2Gi"), StorageClass: "local"},
+			},
+		},
+		{
+			name:     "derby defaults",
+			database: &DatabaseSpec{DatabaseType: "derby"},
+		},
+		{
+			name: "postgres connString with server fields and storage",
+			database: &DatabaseSpec{
+				DatabaseType:      "postgres",
+				ConnString:        "jdbc:postgresql://postgres:5432/hive",
+				Host:              "ignored",
+				DatabaseName:      "ignored",
+				CredentialsSecret: "hive-credentials",
+				Storage:           &commonsv1alpha1.StorageResource{Capacity: resource.MustParse("2Gi")},
+			},
+			expected: &DatabaseSpec{
+				DatabaseType:      "postgres",
+				ConnString:        "jdbc:postgresql://postgres:5432/hive",
+				CredentialsSecret: "hive-credentials",
+			},
+		},
+		{
+			name: "mysql server with storage",
+			database: &DatabaseSpec{
+				DatabaseType:      "mysql",
+				Host:              "mysql",
+				DatabaseName:      "hive",
+				CredentialsSecret: "hive-credentials",
+				Storage:           &commonsv1alpha1.StorageResource{StorageClass: "local"},
+			},
+			expected: &DatabaseSpec{
+				DatabaseType:      "mysql",
+				Host:              "mysql",
+				DatabaseName:      "hive",
+				CredentialsSecret: "hive-credentials",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := newTestHiveMetastore(tt.database)
+
+			hub := &hivev1alpha2.HiveMetastore{}
+			if err := original.DeepCopy().ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			assertHubDatabaseValid(t, hub.Spec.ClusterConfig.Database)
+			converted := &HiveMetastore{}
+			if err := converted.ConvertFrom(hub.DeepCopy()); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			expected := original
+			if tt.expected != nil {
+				expected = newTestHiveMetastore(tt.expected)
+			}
+			assertEqual(t, expected, converted)
+
+			// The hub converted from v1alpha1 also survives the other direction.
+			spoke := &HiveMetastore{}
+			if err := spoke.ConvertFrom(hub.DeepCopy()); err != nil {
+				t.Fatalf("ConvertFrom: %v", err)
+			}
+			roundTripped := &hivev1alpha2.HiveMetastore{}
+			if err := spoke.ConvertTo(roundTripped); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			assertEqual(t, hub, roundTripped)
+		})
+	}
+}
+
+func TestHiveMetastoreConvertDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		database *DatabaseSpec
+		expected *hivev1alpha2.DatabaseSpec
+	}{
+		{
+			name: "server fields",
+			database: &DatabaseSpec{
+				DatabaseType: "postgres",
+				Host:         "postgres",
+				DatabaseName: "hive",
+				SSLMode:      "require",
+			},
+			expected: &hivev1alpha2.DatabaseSpec{
+				Type:   "postgres",
+				Server: &hivev1alpha2.DatabaseServerSpec{Host: "postgres", DatabaseName: "hive", SSLMode: "require"},
+			},
+		},
+		{
+			name:     "raw url",
+			database: &DatabaseSpec{DatabaseType: "mariadb", ConnString: "jdbc:mariadb://mariadb:3306/hive"},
+			expected: &hivev1alpha2.DatabaseSpec{Type: "mariadb", JdbcURL: "jdbc:mariadb://mariadb:3306/hive"},
+		},
+		{
+			name: "derby path",
+			database: &DatabaseSpec{
+				DatabaseType: "derby",
+				DatabaseName: "/kubedoop/data/hive",
+				Storage:      &commonsv1alpha1.StorageResource{StorageClass: "local"},
+			},
+			expected: &hivev1alpha2.DatabaseSpec{
+				Type: "derby",
+				Derby: &hivev1alpha2.DerbySpec{
+					Path:    "/kubedoop/data/hive",
+					Storage: &commonsv1alpha1.StorageResource{StorageClass: "local"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &hivev1alpha2.HiveMetastore{}
+			if err := newTestHiveMetastore(tt.database).ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo: %v", err)
+			}
+			assertEqual(t, tt.expected, hub.Spec.ClusterConfig.Database)
+		})
+	}
+}
+
+func TestHiveMetastoreConvertFromHub(t *testing.T) {
+	hub := &hivev1alpha2.HiveMetastore{
+		ObjectMeta: metav1.ObjectMeta{Name: "hive", Namespace: "default"},
+		Spec: hivev1alpha2.HiveMetastoreSpec{
+			ClusterConfig: &hivev1alpha2.ClusterConfigSpec{
+				Database: &hivev1alpha2.DatabaseSpec{
+					Type:              "oracle",
+					Server:            &hivev1alpha2.DatabaseServerSpec{Host: "oracle", Port: 1521, DatabaseName: "ORCLPDB1"},
+					CredentialsSecret: "hive-credentials",
+				},
+				Authentication: &hivev1alpha2.AuthenticationSpec{
+					Kerberos: &hivev1alpha2.KerberosSpec{SecretClass: "kerberos", MetastoreServiceName: "hive"},
+				},
+			},
+			Metastore: &hivev1alpha2.RoleSpec{
+				RoleGroups: map[string]*hivev1alpha2.RoleGroupSpec{"default": {Replicas: 1}},
+			},
+		},
+		Status: hivev1alpha2.HiveMetastoreStatus{
+			Conditions: []metav1.Condition{{Type: ConditionTypeSpecValid, Status: metav1.ConditionTrue, Reason: "Valid"}},
+		},
+	}
+
+	spoke := &HiveMetastore{}
+	if err := spoke.ConvertFrom(hub.DeepCopy()); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	assertEqual(t, &DatabaseSpec{
+		DatabaseType:      "oracle",
+		Host:              "oracle",
+		Port:              1521,
+		DatabaseName:      "ORCLPDB1",
+		CredentialsSecret: "hive-credentials",
+	}, spoke.Spec.ClusterConfig.Database)
+
+	roundTripped := &hivev1alpha2.HiveMetastore{}
+	if err := spoke.ConvertTo(roundTripped); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	assertEqual(t, hub, roundTripped)
+}
+
+// TestHiveMetastoreConditionsJSON checks that the conditions keep their v1alpha1 key and use the new key in v1alpha2.
+func TestHiveMetastoreConditionsJSON(t *testing.T) {
+	original := newTestHiveMetastore(&DatabaseSpec{DatabaseType: "derby"})
+	hub := &hivev1alpha2.HiveMetastore{}
+	if err := original.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+
+	for version, status := range map[string]any{"v1alpha1": original.Status, "v1alpha2": hub.Status} {
+		data, err := json.Marshal(status)
+		if err != nil {
+			t.Fatalf("marshal %s status: %v", version, err)
+		}
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("unmarshal %s status: %v", version, err)
+		}
+		key := map[string]string{"v1alpha1": "condition", "v1alpha2": "conditions"}[version]
+		if _, ok := fields[key]; !ok {
+			t.Errorf("%s status has no %q key: %s", version, key, data)
+		}
+	}
+}
+
+func assertEqual(t *testing.T, expected, actual any) {
+	t.Helper()
+	if reflect.DeepEqual(expected, actual) {
+		return
+	}
+	expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+	actualJSON, _ := json.MarshalIndent(actual, "", "  ")
+	t.Errorf("converted object differs\nexpected: %s\nactual: %s", expectedJSON, actualJSON)
+}
@@ -17,18 +17,87 @@ limitations under the License.
 package v1alpha1
 
 import (
+	hivev1alpha2 "github.com/zncdatadev/hive-operator/api/v1alpha2"
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
-	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/constants"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	DefaultWarehouseDir = "/kubedoop/warehouse"
+	DefaultWarehouseDir = hivev1alpha2.DefaultWarehouseDir
+)
+
+// Condition types reported in HiveMetastoreStatus.Conditions
+const (
+	ConditionTypeAvailable                = hivev1alpha2.ConditionTypeAvailable
+	ConditionTypeProgressing              = hivev1alpha2.ConditionTypeProgressing
+	ConditionTypeDegraded                 = hivev1alpha2.ConditionTypeDegraded
+	ConditionTypeReconciliationPaused     = hivev1alpha2.ConditionTypeReconciliationPaused
+	ConditionTypeStopped                  = hivev1alpha2.ConditionTypeStopped
+	ConditionTypeSpecValid                = hivev1alpha2.ConditionTypeSpecValid
+	ConditionTypeDatabaseReachable        = hivev1alpha2.ConditionTypeDatabaseReachable
+	ConditionTypeConnectionBudgetExceeded = hivev1alpha2.ConditionTypeConnectionBudgetExceeded
+)
+
+// The types whose schema is the same in both versions are declared once in the hub v1alpha2 and
+// aliased here. v1alpha1 only declares the types it serializes differently: the flat database,
+// the status conditions, and the authentication, whose markers predate the validation of v1alpha2.
+type (
+	BackupResult          = hivev1alpha2.BackupResult
+	RestorePhase          = hivev1alpha2.RestorePhase
+	SchemaMigrationResult = hivev1alpha2.SchemaMigrationResult
+
+	RestoreSpec             = hivev1alpha2.RestoreSpec
+	BackupSpec              = hivev1alpha2.BackupSpec
+	BackupTargetSpec        = hivev1alpha2.BackupTargetSpec
+	HDFSSpec                = hivev1alpha2.HDFSSpec
+	S3Spec                  = hivev1alpha2.S3Spec
+	DatabaseTlsSpec         = hivev1alpha2.DatabaseTlsSpec
+	DatabaseCredentialsSpec = hivev1alpha2.DatabaseCredentialsSpec
+	RoleSpec                = hivev1alpha2.RoleSpec
+	ConfigSpec              = hivev1alpha2.ConfigSpec
+	PerformanceSpec         = hivev1alpha2.PerformanceSpec
+	ConnectionPoolSpec      = hivev1alpha2.ConnectionPoolSpec
+	DataNucleusCacheSpec    = hivev1alpha2.DataNucleusCacheSpec
+	LibrarySpec             = hivev1alpha2.LibrarySpec
+	LibraryImageSpec        = hivev1alpha2.LibraryImageSpec
+	LibraryS3Spec           = hivev1alpha2.LibraryS3Spec
+	RoleGroupSpec           = hivev1alpha2.RoleGroupSpec
+
+	RestoreStatus   = hivev1alpha2.RestoreStatus
+	BackupStatus    = hivev1alpha2.BackupStatus
+	SchemaStatus    = hivev1alpha2.SchemaStatus
+	RoleGroupStatus = hivev1alpha2.RoleGroupStatus
+)
+
+const (
+	BackupRunning   = hivev1alpha2.BackupRunning
+	BackupSucceeded = hivev1alpha2.BackupSucceeded
+	BackupFailed    = hivev1alpha2.BackupFailed
+)
+
+const (
+	RestoreStopping  = hivev1alpha2.RestoreStopping
+	RestoreRestoring = hivev1alpha2.RestoreRestoring
+	RestoreUpgrading = hivev1alpha2.RestoreUpgrading
+	RestoreCompleted = hivev1alpha2.RestoreCompleted
+	RestoreFailed    = hivev1alpha2.RestoreFailed
+)
+
+const (
+	SchemaMigrationRunning   = hivev1alpha2.SchemaMigrationRunning
+	SchemaMigrationSucceeded = hivev1alpha2.SchemaMigrationSucceeded
+	SchemaMigrationFailed    = hivev1alpha2.SchemaMigrationFailed
 )
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas"
+// +kubebuilder:printcolumn:name="Available",type="string",JSONPath=".status.condition[?(@.type==\"Available\")].status"
+// +kubebuilder:printcolumn:name="Degraded",type="string",JSONPath=".status.condition[?(@.type==\"Degraded\")].status",priority=1
+// +kubebuilder:printcolumn:name="Stopped",type="string",JSONPath=".status.condition[?(@.type==\"Stopped\")].status",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // HiveMetastore is the Schema for the hivemetastores API
 type HiveMetastore struct {
@@ -62,6 +131,11 @@ type HiveMetastoreSpec struct {
 
 	// +kubebuilder:validation:Required
 	Metastore *RoleSpec `json:"metastore"`
+
+	// HiveServer2 provides a JDBC endpoint for Hive SQL.
+	// It is connected to the metastore rolegroups of this cluster.
+	// +kubebuilder:validation:Optional
+	HiveServer2 *RoleSpec `json:"hiveServer2,omitempty"`
 }
 
 type ClusterConfigSpec struct {
@@ -85,45 +159,94 @@ type ClusterConfigSpec struct {
 
 	// +kubebuilder:validation:Optional
 	Authentication *AuthenticationSpec `json:"authentication,omitempty"`
-}
 
-type HDFSSpec struct {
-	// +kubebuilder:validation:Required
-	ConfigMap string `json:"configMap"`
-}
-
-type S3Spec struct {
+	// Scheduled backups of the metastore database to S3.
 	// +kubebuilder:validation:Optional
-	Inline *s3v1alpha1.S3ConnectionSpec `json:"inline,omitempty"`
+	Backup *BackupSpec `json:"backup,omitempty"`
 
-	// S3 connection reference
+	// Restore the metastore database from a backup in S3. The cluster is stopped, the dump is restored,
+	// the schema is upgraded and the cluster is started again. Each source is restored once,
+	// changing the source restores again.
 	// +kubebuilder:validation:Optional
-	Reference string `json:"reference,omitempty"`
+	RestoreFrom *RestoreSpec `json:"restoreFrom,omitempty"`
 }
 
 type DatabaseSpec struct {
-	// +kubebuilder:validation:Required
-	ConnString string `json:"connString"`
+	// Raw JDBC connection string. When set, it takes precedence over the structured
+	// host, port, databaseName, sslMode and parameters fields.
+	// +kubebuilder:validation:Optional
+	ConnString string `json:"connString,omitempty"`
 
 	// +kubebuilder:validation:Required
 	// +kubebuilder:default="derby"
-	// +kubebuilder:validation:enum=derby;mysql;postgres;oracle
+	// +kubebuilder:validation:enum=derby;mysql;mariadb;postgres;oracle;mssql
 	DatabaseType string `json:"databaseType"`
 
-	// +kubebuilder:validation:Required
+	// Hostname of the database server, used to render the JDBC URL when connString is empty.
+	// +kubebuilder:validation:Optional
+	Host string `json:"host,omitempty"`
+
+	// Port of the database server, defaults to the standard port of the database type.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// Name of the database, the service name for oracle, or the path of the derby database.
+	// +kubebuilder:validation:Optional
+	DatabaseName string `json:"databaseName,omitempty"`
+
+	// SSL mode of the connection, translated to the parameters of the JDBC driver.
+	// Defaults to verify-full when tls is set.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=disable;require;verify-ca;verify-full
+	SSLMode string `json:"sslMode,omitempty"`
+
+	// Extra JDBC parameters, they take precedence over the parameters derived from sslMode.
+	// +kubebuilder:validation:Optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
 	// A reference to a secret to use for the database connection credentials.
 	// It must contain the following keys:
 	//  - username
 	//  - password
-	CredentialsSecret string `json:"credentialsSecret"`
+	// Databases other than derby require either credentialsSecret or credentials.
+	// +kubebuilder:validation:Optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+
+	// Credentials provisioned by a secret-operator SecretClass, mutually exclusive with credentialsSecret.
+	// +kubebuilder:validation:Optional
+	Credentials *DatabaseCredentialsSpec `json:"credentials,omitempty"`
+
+	// CA verifying the certificate of the database server.
+	// +kubebuilder:validation:Optional
+	Tls *DatabaseTlsSpec `json:"tls,omitempty"`
+
+	// How long the metastore pods and the schema Job wait for the database to accept connections
+	// before they fail, defaults to 5m.
+	// +kubebuilder:validation:Optional
+	WaitTimeout *metav1.Duration `json:"waitTimeout,omitempty"`
+
+	// Storage of the PVC holding the embedded derby database, mounted at /kubedoop/data.
+	// Only used with derby, which then allows a single metastore replica.
+	// +kubebuilder:validation:Optional
+	Storage *commonsv1alpha1.StorageResource `json:"storage,omitempty"`
+
+	// Connection budget of the metastore on the database server. The ConnectionBudgetExceeded condition
+	// is set when the connections of the metastore rolegroups exceed it. Each metastore pod opens up to
+	// 3 * maxPoolSize + 2 connections: the DataNucleus pool, the two pools of the transaction handler,
+	// each sized by maxPoolSize, and the secondary DataNucleus pool of 2 connections.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
 }
 
 type AuthenticationSpec struct {
 	// +kubebuilder:validation:Optional
 	Tls *TlsSpec `json:"tls,omitempty"`
 
-	// +kubebuilder:validation:Required
-	Kerberos *KerberosSpec `json:"kerberos"`
+	// +kubebuilder:validation:Optional
+	Kerberos *KerberosSpec `json:"kerberos,omitempty"`
 }
 
 type TlsSpec struct {
@@ -141,48 +264,58 @@ type KerberosSpec struct {
 	// +kubebuilder:validation:Required
 	// +kubebuilder:minLength=1
 	SecretClass string `json:"secretClass"`
-}
-
-type RoleSpec struct {
 
+	// MetastoreServiceName is the service part of the metastore principals, e.g. `hive` for
+	// `hive/<rolegroup service FQDN>@REALM`. The principals use the FQDN of the rolegroup service
+	// clients connect through, not the FQDN of the pod. Defaults to `metastore`.
 	// +kubebuilder:validation:Optional
-	Config *ConfigSpec `json:"config,omitempty"`
-
-	// +kubebuilder:validation:Required
-	RoleGroups map[string]*RoleGroupSpec `json:"roleGroups"`
+	// +kubebuilder:validation:Pattern=`^[^/@]+$`
+	MetastoreServiceName string `json:"metastoreServiceName,omitempty"`
 
+	// HiveServer2ServiceName is the service part of the HiveServer2 principals. Defaults to `hiveserver2`.
 	// +kubebuilder:validation:Optional
-	RoleConfig *commonsv1alpha1.RoleConfigSpec `json:"roleConfig,omitempty"`
+	// +kubebuilder:validation:Pattern=`^[^/@]+$`
+	HiveServer2ServiceName string `json:"hiveServer2ServiceName,omitempty"`
 
-	*commonsv1alpha1.OverridesSpec `json:",inline"`
+	// RequireTls rejects the spec unless authentication.tls is set too, so the SASL handshake of the
+	// metastore and the SPNEGO endpoints of HiveServer2 are never served over plain connections.
+	// +kubebuilder:validation:Optional
+	RequireTls bool `json:"requireTls,omitempty"`
 }
 
-type ConfigSpec struct {
-	*commonsv1alpha1.RoleGroupConfigSpec `json:",inline"`
-
+// HiveMetastoreStatus defines the observed state of HiveMetastore
+type HiveMetastoreStatus struct {
 	// +kubebuilder:validation:Optional
-	// +kubebuilder:default:="/kubedoop/warehouse"
-	WarehouseDir string `json:"warehouseDir,omitempty"`
-}
+	Conditions []metav1.Condition `json:"condition,omitempty"`
 
-type RoleGroupSpec struct {
+	// Total desired replicas across all rolegroups.
 	// +kubebuilder:validation:Optional
-	// +kubebuilder:default:=1
 	Replicas int32 `json:"replicas,omitempty"`
 
+	// Total ready replicas across all rolegroups.
 	// +kubebuilder:validation:Optional
-	Config *ConfigSpec `json:"config,omitempty"`
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
 
-	*commonsv1alpha1.OverridesSpec `json:",inline"`
-}
+	// The generation of the HiveMetastore last processed by the operator.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
-// HiveMetastoreStatus defines the observed state of HiveMetastore
-type HiveMetastoreStatus struct {
+	// Status of each rolegroup StatefulSet, keyed by `<role>-<roleGroup>`.
 	// +kubebuilder:validation:Optional
-	Conditions []metav1.Condition `json:"condition,omitempty"`
+	RoleGroups map[string]RoleGroupStatus `json:"roleGroups,omitempty"`
 
+	// State of the metastore database schema, managed by the schematool Job.
+	// It is not set for derby, where each metastore pod owns its schema.
 	// +kubebuilder:validation:Optional
-	Replicas int32 `json:"replicas,omitempty"`
+	Schema *SchemaStatus `json:"schema,omitempty"`
+
+	// State of the scheduled database backups.
+	// +kubebuilder:validation:Optional
+	Backup *BackupStatus `json:"backup,omitempty"`
+
+	// State of the restore from restoreFrom.
+	// +kubebuilder:validation:Optional
+	Restore *RestoreStatus `json:"restore,omitempty"`
 }
 
 func init() {
@@ -1,34 +1,13 @@
 package v1alpha1
 
 import (
-	corev1 "k8s.io/api/core/v1"
+	hivev1alpha2 "github.com/zncdatadev/hive-operator/api/v1alpha2"
 )
 
 const (
-	DefaultRepository     = "quay.io/zncdatadev"
-	DefaultProductVersion = "4.0.1"
-	DefaultProductName    = "hive"
+	DefaultRepository     = hivev1alpha2.DefaultRepository
+	DefaultProductVersion = hivev1alpha2.DefaultProductVersion
+	DefaultProductName    = hivev1alpha2.DefaultProductName
 )
 
-type ImageSpec struct {
-	// +kubebuilder:validation:Optional
-	Custom string `json:"custom,omitempty"`
-
-	// +kubebuilder:validation:Optional
-	// +kubebuilder:default=quay.io/zncdatadev
-	Repo string `json:"repo,omitempty"`
-
-	// +kubebuilder:validation:Optional
-	KubedoopVersion string `json:"kubedoopVersion,omitempty"`
-
-	// +kubebuilder:validation:Optional
-	ProductVersion string `json:"productVersion,omitempty"`
-
-	// +kubebuilder:validation:Optional
-	// +kubebuilder:default=IfNotPresent
-	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
-	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
-
-	// +kubebuilder:validation:Optional
-	PullSecretName string `json:"pullSecretName,omitempty"`
-}
+type ImageSpec = hivev1alpha2.ImageSpec
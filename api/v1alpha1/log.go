@@ -4,6 +4,10 @@ import (
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
 )
 
+// LoggingSpec is kept for the Go clients of v1alpha1, no field of the API references it.
+//
+// Deprecated: logging is configured with the logging field of the rolegroup config,
+// whose containers are serialized as `containers`. LoggingSpec is not part of v1alpha2.
 type LoggingSpec struct {
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default=false
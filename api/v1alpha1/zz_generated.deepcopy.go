@@ -22,7 +22,6 @@ package v1alpha1
 
 import (
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
-	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -58,7 +57,7 @@ func (in *ClusterConfigSpec) DeepCopyInto(out *ClusterConfigSpec) {
 	if in.Database != nil {
 		in, out := &in.Database, &out.Database
 		*out = new(DatabaseSpec)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.S3 != nil {
 		in, out := &in.S3, &out.S3
@@ -75,6 +74,16 @@ func (in *ClusterConfigSpec) DeepCopyInto(out *ClusterConfigSpec) {
 		*out = new(AuthenticationSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Backup != nil {
+		in, out := &in.Backup, &out.Backup
+		*out = new(BackupSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RestoreFrom != nil {
+		in, out := &in.RestoreFrom, &out.RestoreFrom
+		*out = new(RestoreSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterConfigSpec.
@@ -88,28 +97,40 @@ func (in *ClusterConfigSpec) DeepCopy() *ClusterConfigSpec {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ConfigSpec) DeepCopyInto(out *ConfigSpec) {
+func (in *DatabaseSpec) DeepCopyInto(out *DatabaseSpec) {
 	*out = *in
-	if in.RoleGroupConfigSpec != nil {
-		in, out := &in.RoleGroupConfigSpec, &out.RoleGroupConfigSpec
-		*out = new(commonsv1alpha1.RoleGroupConfigSpec)
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(DatabaseCredentialsSpec)
 		(*in).DeepCopyInto(*out)
 	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigSpec.
-func (in *ConfigSpec) DeepCopy() *ConfigSpec {
-	if in == nil {
-		return nil
+	if in.Tls != nil {
+		in, out := &in.Tls, &out.Tls
+		*out = new(DatabaseTlsSpec)
+		**out = **in
+	}
+	if in.WaitTimeout != nil {
+		in, out := &in.WaitTimeout, &out.WaitTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(commonsv1alpha1.StorageResource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxConnections != nil {
+		in, out := &in.MaxConnections, &out.MaxConnections
+		*out = new(int32)
+		**out = **in
 	}
-	out := new(ConfigSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *DatabaseSpec) DeepCopyInto(out *DatabaseSpec) {
-	*out = *in
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseSpec.
@@ -122,21 +143,6 @@ func (in *DatabaseSpec) DeepCopy() *DatabaseSpec {
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *HDFSSpec) DeepCopyInto(out *HDFSSpec) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HDFSSpec.
-func (in *HDFSSpec) DeepCopy() *HDFSSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(HDFSSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HiveMetastore) DeepCopyInto(out *HiveMetastore) {
 	*out = *in
@@ -219,6 +225,11 @@ func (in *HiveMetastoreSpec) DeepCopyInto(out *HiveMetastoreSpec) {
 		*out = new(RoleSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.HiveServer2 != nil {
+		in, out := &in.HiveServer2, &out.HiveServer2
+		*out = new(RoleSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HiveMetastoreSpec.
@@ -241,6 +252,28 @@ func (in *HiveMetastoreStatus) DeepCopyInto(out *HiveMetastoreStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RoleGroups != nil {
+		in, out := &in.RoleGroups, &out.RoleGroups
+		*out = make(map[string]RoleGroupStatus, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.Schema != nil {
+		in, out := &in.Schema, &out.Schema
+		*out = new(SchemaStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Backup != nil {
+		in, out := &in.Backup, &out.Backup
+		*out = new(BackupStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Restore != nil {
+		in, out := &in.Restore, &out.Restore
+		*out = new(RestoreStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HiveMetastoreStatus.
@@ -253,21 +286,6 @@ func (in *HiveMetastoreStatus) DeepCopy() *HiveMetastoreStatus {
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ImageSpec) DeepCopyInto(out *ImageSpec) {
-	*out = *in
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageSpec.
-func (in *ImageSpec) DeepCopy() *ImageSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(ImageSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KerberosSpec) DeepCopyInto(out *KerberosSpec) {
 	*out = *in
@@ -305,97 +323,6 @@ func (in *LoggingSpec) DeepCopy() *LoggingSpec {
 	return out
 }
 
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RoleGroupSpec) DeepCopyInto(out *RoleGroupSpec) {
-	*out = *in
-	if in.Config != nil {
-		in, out := &in.Config, &out.Config
-		*out = new(ConfigSpec)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.OverridesSpec != nil {
-		in, out := &in.OverridesSpec, &out.OverridesSpec
-		*out = new(commonsv1alpha1.OverridesSpec)
-		(*in).DeepCopyInto(*out)
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoleGroupSpec.
-func (in *RoleGroupSpec) DeepCopy() *RoleGroupSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(RoleGroupSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RoleSpec) DeepCopyInto(out *RoleSpec) {
-	*out = *in
-	if in.Config != nil {
-		in, out := &in.Config, &out.Config
-		*out = new(ConfigSpec)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.RoleGroups != nil {
-		in, out := &in.RoleGroups, &out.RoleGroups
-		*out = make(map[string]*RoleGroupSpec, len(*in))
-		for key, val := range *in {
-			var outVal *RoleGroupSpec
-			if val == nil {
-				(*out)[key] = nil
-			} else {
-				inVal := (*in)[key]
-				in, out := &inVal, &outVal
-				*out = new(RoleGroupSpec)
-				(*in).DeepCopyInto(*out)
-			}
-			(*out)[key] = outVal
-		}
-	}
-	if in.RoleConfig != nil {
-		in, out := &in.RoleConfig, &out.RoleConfig
-		*out = new(commonsv1alpha1.RoleConfigSpec)
-		(*in).DeepCopyInto(*out)
-	}
-	if in.OverridesSpec != nil {
-		in, out := &in.OverridesSpec, &out.OverridesSpec
-		*out = new(commonsv1alpha1.OverridesSpec)
-		(*in).DeepCopyInto(*out)
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoleSpec.
-func (in *RoleSpec) DeepCopy() *RoleSpec {
-	if in == nil {
-		return nil
-	}
-	out := new(RoleSpec)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *S3Spec) DeepCopyInto(out *S3Spec) {
-	*out = *in
-	if in.Inline != nil {
-		in, out := &in.Inline, &out.Inline
-		*out = new(s3v1alpha1.S3ConnectionSpec)
-		(*in).DeepCopyInto(*out)
-	}
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Spec.
-func (in *S3Spec) DeepCopy() *S3Spec {
-	if in == nil {
-		return nil
-	}
-	out := new(S3Spec)
-	in.DeepCopyInto(out)
-	return out
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TlsSpec) DeepCopyInto(out *TlsSpec) {
 	*out = *in
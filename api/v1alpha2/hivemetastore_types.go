@@ -0,0 +1,662 @@
+/*
+Copyright 2023 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DefaultWarehouseDir = "/kubedoop/warehouse"
+)
+
+// Condition types reported in HiveMetastoreStatus.Conditions
+const (
+	ConditionTypeAvailable            = "Available"
+	ConditionTypeProgressing          = "Progressing"
+	ConditionTypeDegraded             = "Degraded"
+	ConditionTypeReconciliationPaused = "ReconciliationPaused"
+	ConditionTypeStopped              = "Stopped"
+	ConditionTypeSpecValid            = "SpecValid"
+	ConditionTypeDatabaseReachable    = "DatabaseReachable"
+	// ConditionTypeConnectionBudgetExceeded warns that the metastore pools may open more connections
+	// than the maxConnections of the database.
+	ConditionTypeConnectionBudgetExceeded = "ConnectionBudgetExceeded"
+)
+
+// BackupResult is the outcome of the last backup Job.
+type BackupResult string
+
+const (
+	BackupRunning   BackupResult = "Running"
+	BackupSucceeded BackupResult = "Succeeded"
+	BackupFailed    BackupResult = "Failed"
+)
+
+// RestorePhase is the step of a restore from a backup.
+type RestorePhase string
+
+const (
+	// RestoreStopping waits until the metastore and HiveServer2 pods are gone.
+	RestoreStopping RestorePhase = "Stopping"
+	// RestoreRestoring runs the restore Job against the stopped cluster.
+	RestoreRestoring RestorePhase = "Restoring"
+	// RestoreUpgrading runs the schema upgrade and brings the StatefulSets back.
+	RestoreUpgrading RestorePhase = "Upgrading"
+	RestoreCompleted RestorePhase = "Completed"
+	// RestoreFailed keeps the cluster stopped until restoreFrom is removed or changed.
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// SchemaMigrationResult is the outcome of the last schematool run.
+type SchemaMigrationResult string
+
+const (
+	SchemaMigrationRunning   SchemaMigrationResult = "Running"
+	SchemaMigrationSucceeded SchemaMigrationResult = "Succeeded"
+	SchemaMigrationFailed    SchemaMigrationResult = "Failed"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas"
+// +kubebuilder:printcolumn:name="Available",type="string",JSONPath=".status.conditions[?(@.type==\"Available\")].status"
+// +kubebuilder:printcolumn:name="Degraded",type="string",JSONPath=".status.conditions[?(@.type==\"Degraded\")].status",priority=1
+// +kubebuilder:printcolumn:name="Stopped",type="string",JSONPath=".status.conditions[?(@.type==\"Stopped\")].status",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// HiveMetastore is the Schema for the hivemetastores API
+type HiveMetastore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HiveMetastoreSpec   `json:"spec,omitempty"`
+	Status HiveMetastoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HiveMetastoreList contains a list of HiveMetastore
+type HiveMetastoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HiveMetastore `json:"items"`
+}
+
+// HiveMetastoreSpec defines the desired state of HiveMetastore
+type HiveMetastoreSpec struct {
+	// +kubebuilder:validation:Optional
+	// +default:value={"repo": "quay.io/zncdatadev", "pullPolicy": "IfNotPresent"}
+	Image *ImageSpec `json:"image,omitempty"`
+
+	// +kubebuilder:validation:Required
+	ClusterConfig *ClusterConfigSpec `json:"clusterConfig"`
+
+	// +kubebuilder:validation:Optional
+	ClusterOperation *commonsv1alpha1.ClusterOperationSpec `json:"clusterOperation,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Metastore *RoleSpec `json:"metastore"`
+
+	// HiveServer2 provides a JDBC endpoint for Hive SQL.
+	// It is connected to the metastore rolegroups of this cluster.
+	// +kubebuilder:validation:Optional
+	HiveServer2 *RoleSpec `json:"hiveServer2,omitempty"`
+}
+
+type ClusterConfigSpec struct {
+
+	// +kubebuilder:validation:Optional
+	VectorAggregatorConfigMapName string `json:"vectorAggregatorConfigMapName,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Database *DatabaseSpec `json:"database"`
+
+	// +kubebuilder:validation:Optional
+	S3 *S3Spec `json:"s3,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=cluster-internal
+	// +kubebuilder:validation:Enum=cluster-internal;external-unstable;external-stable
+	ListenerClass constants.ListenerClass `json:"listenerClass,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	HDFS *HDFSSpec `json:"hdfs,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Authentication *AuthenticationSpec `json:"authentication,omitempty"`
+
+	// Scheduled backups of the metastore database to S3.
+	// +kubebuilder:validation:Optional
+	Backup *BackupSpec `json:"backup,omitempty"`
+
+	// Restore the metastore database from a backup in S3. The cluster is stopped, the dump is restored,
+	// the schema is upgraded and the cluster is started again. Each source is restored once,
+	// changing the source restores again.
+	// +kubebuilder:validation:Optional
+	RestoreFrom *RestoreSpec `json:"restoreFrom,omitempty"`
+}
+
+type RestoreSpec struct {
+	// S3 connection of the backup, only inline and reference are used.
+	// +kubebuilder:validation:Required
+	S3 *S3Spec `json:"s3"`
+
+	// Name of the bucket holding the backup.
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// Key of the backup object, e.g. "my-cluster/metastore-20240101T030000Z.pgdump".
+	// The dump must have the format of the backups of the configured database type.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+
+	// Image providing the restore tool, defaults to `docker.io/library/postgres:17`, `docker.io/library/mysql:8.4`
+	// or `docker.io/library/mariadb:11.4` of the database type.
+	// The embedded derby database is restored with the product image.
+	// +kubebuilder:validation:Optional
+	Image string `json:"image,omitempty"`
+}
+
+// BackupSpec configures a CronJob dumping the metastore database with pg_dump, mysqldump,
+// or archiving the embedded derby database, and uploading the dump to S3.
+type BackupSpec struct {
+	// Cron schedule of the backups, e.g. "0 3 * * *".
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Number of backups kept in the target, older backups are deleted after each upload.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=7
+	// +kubebuilder:validation:Minimum=1
+	Retention int32 `json:"retention,omitempty"`
+
+	// +kubebuilder:validation:Required
+	Target *BackupTargetSpec `json:"target"`
+
+	// Image providing the dump tool, defaults to `docker.io/library/postgres:17`, `docker.io/library/mysql:8.4`
+	// or `docker.io/library/mariadb:11.4` of the database type.
+	// The embedded derby database is archived with the product image.
+	// +kubebuilder:validation:Optional
+	Image string `json:"image,omitempty"`
+
+	// Suspend the scheduled backups.
+	// +kubebuilder:validation:Optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+type BackupTargetSpec struct {
+	// S3 connection of the target, only inline and reference are used.
+	// +kubebuilder:validation:Required
+	S3 *S3Spec `json:"s3"`
+
+	// Name of the bucket the backups are uploaded to.
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// Prefix of the backup objects, defaults to the name of the cluster.
+	// +kubebuilder:validation:Optional
+	Prefix string `json:"prefix,omitempty"`
+}
+
+type HDFSSpec struct {
+	// +kubebuilder:validation:Required
+	ConfigMap string `json:"configMap"`
+}
+
+type S3Spec struct {
+	// +kubebuilder:validation:Optional
+	Inline *s3v1alpha1.S3ConnectionSpec `json:"inline,omitempty"`
+
+	// S3 connection reference
+	// +kubebuilder:validation:Optional
+	Reference string `json:"reference,omitempty"`
+
+	// S3Bucket references, each bucket is configured with the endpoint and credentials
+	// of its own connection, so tables can be spread across several object stores.
+	// The CAs of all connections are imported into the truststore shared by the connections,
+	// and disabling the verification of one connection disables it for all of them.
+	// +kubebuilder:validation:Optional
+	Buckets []string `json:"buckets,omitempty"`
+}
+
+// DatabaseSpec is the metastore database. The JDBC URL is either given as is with jdbcUrl,
+// or rendered from the server, or from derby for the embedded database.
+// +kubebuilder:validation:XValidation:rule="!(has(self.jdbcUrl) && has(self.server))",message="jdbcUrl and server are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="self.type == 'derby' || !has(self.derby)",message="derby is only used with the derby database type"
+type DatabaseSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:default="derby"
+	// +kubebuilder:validation:Enum=derby;mysql;mariadb;postgres;oracle;mssql
+	Type string `json:"type"`
+
+	// Raw JDBC URL, used as is. The type still selects the driver and the schematool dialect.
+	// +kubebuilder:validation:Optional
+	JdbcURL string `json:"jdbcUrl,omitempty"`
+
+	// Database server the JDBC URL is rendered from, for all types but derby.
+	// +kubebuilder:validation:Optional
+	Server *DatabaseServerSpec `json:"server,omitempty"`
+
+	// The embedded derby database.
+	// +kubebuilder:validation:Optional
+	Derby *DerbySpec `json:"derby,omitempty"`
+
+	// A reference to a secret to use for the database connection credentials.
+	// It must contain the following keys:
+	//  - username
+	//  - password
+	// Databases other than derby require either credentialsSecret or credentials.
+	// +kubebuilder:validation:Optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+
+	// Credentials provisioned by a secret-operator SecretClass, mutually exclusive with credentialsSecret.
+	// +kubebuilder:validation:Optional
+	Credentials *DatabaseCredentialsSpec `json:"credentials,omitempty"`
+
+	// CA verifying the certificate of the database server.
+	// +kubebuilder:validation:Optional
+	Tls *DatabaseTlsSpec `json:"tls,omitempty"`
+
+	// How long the metastore pods and the schema Job wait for the database to accept connections
+	// before they fail, defaults to 5m.
+	// +kubebuilder:validation:Optional
+	WaitTimeout *metav1.Duration `json:"waitTimeout,omitempty"`
+
+	// Connection budget of the metastore on the database server. The ConnectionBudgetExceeded condition
+	// is set when the connections of the metastore rolegroups exceed it. Each metastore pod opens up to
+	// 3 * maxPoolSize + 2 connections: the DataNucleus pool, the two pools of the transaction handler,
+	// each sized by maxPoolSize, and the secondary DataNucleus pool of 2 connections.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+}
+
+type DatabaseServerSpec struct {
+	// +kubebuilder:validation:Optional
+	Host string `json:"host,omitempty"`
+
+	// Defaults to the standard port of the database type.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// Name of the database, the service name for oracle.
+	// +kubebuilder:validation:Optional
+	DatabaseName string `json:"databaseName,omitempty"`
+
+	// SSL mode of the connection, translated to the parameters of the JDBC driver.
+	// Defaults to verify-full when tls is set.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=disable;require;verify-ca;verify-full
+	SSLMode string `json:"sslMode,omitempty"`
+
+	// Extra JDBC parameters, they take precedence over the parameters derived from sslMode.
+	// +kubebuilder:validation:Optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// DerbySpec is the embedded derby database, which allows a single metastore replica.
+type DerbySpec struct {
+	// Path of the database, defaults to /kubedoop/data/metastore_db.
+	// +kubebuilder:validation:Optional
+	Path string `json:"path,omitempty"`
+
+	// Storage of the PVC holding the database, mounted at /kubedoop/data.
+	// +kubebuilder:validation:Optional
+	Storage *commonsv1alpha1.StorageResource `json:"storage,omitempty"`
+}
+
+// DatabaseTlsSpec references the CA of the database server, exactly one of secretClass and secret must be set.
+// The CA is added to the rendered JDBC URL, a raw JDBC URL is used as is.
+type DatabaseTlsSpec struct {
+	// SecretClass of secret-operator providing the CA.
+	// +kubebuilder:validation:Optional
+	SecretClass string `json:"secretClass,omitempty"`
+
+	// Secret in the namespace of the cluster holding the PEM encoded CA in the `ca.crt` key.
+	// +kubebuilder:validation:Optional
+	Secret string `json:"secret,omitempty"`
+}
+
+type DatabaseCredentialsSpec struct {
+	commonsv1alpha1.Credentials `json:",inline"`
+
+	// Key of the username in the provisioned secret.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="username"
+	UsernameKey string `json:"usernameKey,omitempty"`
+
+	// Key of the password in the provisioned secret.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="password"
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// AuthenticationSpec configures TLS and kerberos independently, either can be used on its own.
+type AuthenticationSpec struct {
+	// Serve the thrift endpoints over TLS.
+	// +kubebuilder:validation:Optional
+	Tls *TlsSpec `json:"tls,omitempty"`
+
+	// Authenticate the clients with kerberos.
+	// +kubebuilder:validation:Optional
+	Kerberos *KerberosSpec `json:"kerberos,omitempty"`
+}
+
+type TlsSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="tls"
+	// +kubebuilder:validation:MinLength=1
+	SecretClass string `json:"secretClass,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="changeit"
+	JksPassword string `json:"jksPassword,omitempty"`
+}
+
+type KerberosSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	SecretClass string `json:"secretClass"`
+
+	// MetastoreServiceName is the service part of the metastore principals, e.g. `hive` for
+	// `hive/<rolegroup service FQDN>@REALM`. The principals use the FQDN of the rolegroup service
+	// clients connect through, not the FQDN of the pod. Defaults to `metastore`.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[^/@]+$`
+	MetastoreServiceName string `json:"metastoreServiceName,omitempty"`
+
+	// HiveServer2ServiceName is the service part of the HiveServer2 principals. Defaults to `hiveserver2`.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[^/@]+$`
+	HiveServer2ServiceName string `json:"hiveServer2ServiceName,omitempty"`
+
+	// RequireTls rejects the spec unless authentication.tls is set too, so the SASL handshake of the
+	// metastore and the SPNEGO endpoints of HiveServer2 are never served over plain connections.
+	// +kubebuilder:validation:Optional
+	RequireTls bool `json:"requireTls,omitempty"`
+}
+
+type RoleSpec struct {
+
+	// +kubebuilder:validation:Optional
+	Config *ConfigSpec `json:"config,omitempty"`
+
+	// +kubebuilder:validation:Required
+	RoleGroups map[string]*RoleGroupSpec `json:"roleGroups"`
+
+	// +kubebuilder:validation:Optional
+	RoleConfig *commonsv1alpha1.RoleConfigSpec `json:"roleConfig,omitempty"`
+
+	*commonsv1alpha1.OverridesSpec `json:",inline"`
+}
+
+type ConfigSpec struct {
+	*commonsv1alpha1.RoleGroupConfigSpec `json:",inline"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="/kubedoop/warehouse"
+	WarehouseDir string `json:"warehouseDir,omitempty"`
+
+	// Jars added to the classpath, e.g. JDBC drivers, table format hooks or event listeners.
+	// They are fetched by init containers before the product starts.
+	// +kubebuilder:validation:Optional
+	Libraries []LibrarySpec `json:"libraries,omitempty"`
+
+	// Tuning of the metastore database access, rendered into hive-site.xml of the metastore.
+	// Unset fields default to values chosen from the database type.
+	// +kubebuilder:validation:Optional
+	Performance *PerformanceSpec `json:"performance,omitempty"`
+}
+
+type PerformanceSpec struct {
+	// +kubebuilder:validation:Optional
+	ConnectionPool *ConnectionPoolSpec `json:"connectionPool,omitempty"`
+
+	// Run the metastore queries as direct SQL instead of JDO, which speeds up large partition listings.
+	// The metastore falls back to JDO when a direct SQL query fails. Defaults to true.
+	// +kubebuilder:validation:Optional
+	DirectSQL *bool `json:"directSql,omitempty"`
+
+	// Level 2 cache of DataNucleus, it caches the metastore objects across queries of a metastore pod.
+	// +kubebuilder:validation:Optional
+	Cache *DataNucleusCacheSpec `json:"cache,omitempty"`
+}
+
+type ConnectionPoolSpec struct {
+	// Connection pool of DataNucleus, defaults to HikariCP, and to None for the embedded derby database.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=HikariCP;BONECP;DBCP;None
+	Type string `json:"type,omitempty"`
+
+	// Maximum number of connections of the pool of each metastore pod, defaults to 10 for postgres,
+	// whose connections are processes, and to 20 for the other databases. The two pools of the
+	// transaction handler are sized by it too.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	MaxPoolSize *int32 `json:"maxPoolSize,omitempty"`
+}
+
+type DataNucleusCacheSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Reference type of the cached objects, soft references are released under memory pressure.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="soft"
+	// +kubebuilder:validation:Enum=soft;weak
+	Type string `json:"type,omitempty"`
+}
+
+// LibrarySpec is a jar added to the classpath, exactly one of image, url and s3 must be set.
+type LibrarySpec struct {
+	// File name of the jar on the classpath.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9._-]+\.jar$`
+	Name string `json:"name"`
+
+	// Copy the jar from an OCI image.
+	// +kubebuilder:validation:Optional
+	Image *LibraryImageSpec `json:"image,omitempty"`
+
+	// Download the jar from a HTTP or HTTPS URL.
+	// +kubebuilder:validation:Optional
+	URL string `json:"url,omitempty"`
+
+	// Download the jar from a S3 bucket.
+	// +kubebuilder:validation:Optional
+	S3 *LibraryS3Spec `json:"s3,omitempty"`
+
+	// Hex encoded SHA-256 checksum of the jar, the pod does not start when the fetched jar does not match.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type LibraryImageSpec struct {
+	// +kubebuilder:validation:Required
+	Image string `json:"image"`
+
+	// Absolute path of the jar in the image, the image must provide a `cp` binary.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:="IfNotPresent"
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+}
+
+type LibraryS3Spec struct {
+	// Name of the S3Bucket, it is read with the credentials of its connection.
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// Key of the jar in the bucket.
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+type RoleGroupSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default:=1
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Config *ConfigSpec `json:"config,omitempty"`
+
+	*commonsv1alpha1.OverridesSpec `json:",inline"`
+}
+
+// HiveMetastoreStatus defines the observed state of HiveMetastore
+type HiveMetastoreStatus struct {
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Total desired replicas across all rolegroups.
+	// +kubebuilder:validation:Optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Total ready replicas across all rolegroups.
+	// +kubebuilder:validation:Optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// The generation of the HiveMetastore last processed by the operator.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Status of each rolegroup StatefulSet, keyed by `<role>-<roleGroup>`.
+	// +kubebuilder:validation:Optional
+	RoleGroups map[string]RoleGroupStatus `json:"roleGroups,omitempty"`
+
+	// State of the metastore database schema, managed by the schematool Job.
+	// It is not set for derby, where each metastore pod owns its schema.
+	// +kubebuilder:validation:Optional
+	Schema *SchemaStatus `json:"schema,omitempty"`
+
+	// State of the scheduled database backups.
+	// +kubebuilder:validation:Optional
+	Backup *BackupStatus `json:"backup,omitempty"`
+
+	// State of the restore from restoreFrom.
+	// +kubebuilder:validation:Optional
+	Restore *RestoreStatus `json:"restore,omitempty"`
+}
+
+type RestoreStatus struct {
+	// The restored backup, as s3://<bucket>/<key>.
+	// +kubebuilder:validation:Optional
+	Source string `json:"source,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Stopping;Restoring;Upgrading;Completed;Failed
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	// Name of the Job restoring the backup.
+	// +kubebuilder:validation:Optional
+	JobName string `json:"jobName,omitempty"`
+
+	// Details of the current phase, the failure reason when it failed.
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+type BackupStatus struct {
+	// Name of the Job running the last backup.
+	// +kubebuilder:validation:Optional
+	JobName string `json:"jobName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+	Result BackupResult `json:"result,omitempty"`
+
+	// Details of the last backup, the failure reason when it failed.
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// Time the last backup was scheduled.
+	// +kubebuilder:validation:Optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// Time the last successful backup finished.
+	// +kubebuilder:validation:Optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+}
+
+type SchemaStatus struct {
+	// Schema version reported by schematool after the last successful migration.
+	// +kubebuilder:validation:Optional
+	Version string `json:"version,omitempty"`
+
+	// Name of the Job running the last migration.
+	// +kubebuilder:validation:Optional
+	JobName string `json:"jobName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+	Result SchemaMigrationResult `json:"result,omitempty"`
+
+	// Details of the last migration, the failure reason when it failed.
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+
+	// Time the last migration finished.
+	// +kubebuilder:validation:Optional
+	LastMigrationTime *metav1.Time `json:"lastMigrationTime,omitempty"`
+}
+
+type RoleGroupStatus struct {
+	// +kubebuilder:validation:Required
+	Role string `json:"role"`
+
+	// +kubebuilder:validation:Required
+	RoleGroup string `json:"roleGroup"`
+
+	// +kubebuilder:validation:Optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+
+	// Operator-managed configuration keys replaced by configOverrides, as <file>:<key>.
+	// +kubebuilder:validation:Optional
+	OverriddenConfigKeys []string `json:"overriddenConfigKeys,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HiveMetastore{}, &HiveMetastoreList{})
+}
@@ -0,0 +1,34 @@
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	DefaultRepository     = "quay.io/zncdatadev"
+	DefaultProductVersion = "4.0.1"
+	DefaultProductName    = "hive"
+)
+
+type ImageSpec struct {
+	// +kubebuilder:validation:Optional
+	Custom string `json:"custom,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=quay.io/zncdatadev
+	Repo string `json:"repo,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	KubedoopVersion string `json:"kubedoopVersion,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ProductVersion string `json:"productVersion,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=IfNotPresent
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	PullSecretName string `json:"pullSecretName,omitempty"`
+}
@@ -26,18 +26,23 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	hivev1alpha2 "github.com/zncdatadev/hive-operator/api/v1alpha2"
 	"github.com/zncdatadev/hive-operator/internal/controller"
 	"github.com/zncdatadev/hive-operator/internal/util/version"
+	webhookv1alpha1 "github.com/zncdatadev/hive-operator/internal/webhook/v1alpha1"
+	webhookv1alpha2 "github.com/zncdatadev/hive-operator/internal/webhook/v1alpha2"
 	s3v1alph1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	// +kubebuilder:scaffold:imports
@@ -52,6 +57,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(hivev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(hivev1alpha2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 
 	utilruntime.Must(s3v1alph1.AddToScheme(scheme))
@@ -174,6 +180,11 @@ func main() {
 		LeaderElection:         enableLeaderElection,
 		WebhookServer:          webhookServer,
 		LeaderElectionID:       "d5bf9a68.kubedoop.dev",
+		// Secrets are read from the API server, only their metadata is cached by the Secret watch of the
+		// controller, so the operator does not keep the data of every Secret of the cluster in memory.
+		Client: client.Options{
+			Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -198,6 +209,17 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "HiveMetastore")
 		os.Exit(1)
 	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = webhookv1alpha1.SetupHiveMetastoreWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "HiveMetastore")
+			os.Exit(1)
+		}
+		if err = webhookv1alpha2.SetupHiveMetastoreWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "HiveMetastore")
+			os.Exit(1)
+		}
+	}
 
 	// +kubebuilder:scaffold:builder
 
@@ -9,4 +9,24 @@ const (
 	MetricsPortName   = "metrics"
 	MetricsPort       = 9084
 	MetastorePort     = 9083
+
+	HiveServer2PortName      = "hiveserver2"
+	HiveServer2Port          = 10000
+	HiveServer2WebUIPortName = "http"
+	HiveServer2WebUIPort     = 10002
+)
+
+const (
+	// AnnotationConfigHash is set on the pod template of the rolegroup StatefulSet.
+	// It changes whenever the effective configuration changes, which triggers a rolling restart.
+	AnnotationConfigHash = "hive.kubedoop.dev/config-hash"
+
+	// AnnotationOverriddenConfigKeys is set on the rolegroup ConfigMap, it lists the operator-managed
+	// keys replaced by configOverrides as <file>:<key>, separated by commas.
+	AnnotationOverriddenConfigKeys = "hive.kubedoop.dev/overridden-config-keys"
+)
+
+const (
+	// KubedoopGroupID is the group of the kubedoop user the product images run as.
+	KubedoopGroupID = 1000
 )
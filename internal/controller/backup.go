@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	client "github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	BackupComponentName = "backup"
+
+	backupVolumeName          = "backup"
+	backupS3VolumeName        = "backup-s3-credentials"
+	backupS3CAVolumeName      = "backup-s3-ca"
+	backupDumpContainerName   = "dump"
+	backupUploadContainerName = "upload"
+
+	defaultBackupRetention = 7
+	backupJobHistoryLimit  = 3
+	backupJobBackoffLimit  = 1
+)
+
+var (
+	BackupDir = path.Join(constants.KubedoopRoot, "backup")
+
+	backupDumpFile         = path.Join(BackupDir, "dump")
+	backupS3CredentialsDir = path.Join(constants.KubedoopSecretDir, backupS3VolumeName)
+	backupS3CADir          = path.Join(constants.KubedoopSecretDir, backupS3CAVolumeName)
+)
+
+// GetBackupCronJobName returns the name of the backup CronJob of the cluster.
+func GetBackupCronJobName(clusterName string) string {
+	return clusterName + "-" + BackupComponentName
+}
+
+// ValidateBackup checks that the database can be backed up to the configured target.
+func ValidateBackup(clusterConfig *hivev1alpha1.ClusterConfigSpec) error {
+	backup := clusterConfig.Backup
+	if backup == nil {
+		return nil
+	}
+
+	if err := validateDatabaseTools(clusterConfig.Database, "backup"); err != nil {
+		return err
+	}
+	if backup.Target == nil || !HasS3Connection(backup.Target.S3) {
+		return fmt.Errorf("backup target requires an inline or referenced s3 connection")
+	}
+	return nil
+}
+
+var _ builder.ObjectBuilder = &BackupCronJobBuilder{}
+
+// BackupCronJobBuilder builds the CronJob dumping the database into an emptyDir in an init container,
+// then uploading the dump to S3 and deleting the backups exceeding the retention.
+type BackupCronJobBuilder struct {
+	builder.Job
+	ClusterConfig *hivev1alpha1.ClusterConfigSpec
+	Metastore     *hivev1alpha1.RoleSpec
+	// Stopped suspends the CronJob while the cluster is stopped.
+	Stopped bool
+}
+
+func NewBackupCronJobBuilder(
+	client *client.Client,
+	name string,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	metastore *hivev1alpha1.RoleSpec,
+	stopped bool,
+	image *util.Image,
+	options ...builder.Option,
+) *BackupCronJobBuilder {
+	return &BackupCronJobBuilder{
+		Job: builder.Job{
+			BaseWorkloadBuilder: *builder.NewBaseWorkloadBuilder(
+				client,
+				name,
+				image,
+				nil,
+				nil,
+				options...,
+			),
+		},
+		ClusterConfig: clusterConfig,
+		Metastore:     metastore,
+		Stopped:       stopped,
+	}
+}
+
+func (b *BackupCronJobBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
+	backup := b.ClusterConfig.Backup
+
+	dbConfig, err := NewDatabaseConfig(b.ClusterConfig.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Connection, err := GetS3Connect(ctx, b.Client, backup.Target.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	dumpContainer, err := b.getDumpContainer(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.AddInitContainer(dumpContainer)
+	b.AddContainer(b.getUploadContainer(s3Connection))
+
+	b.AddVolumes([]corev1.Volume{
+		{
+			Name: backupVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+		newCredentialsVolume(backupS3VolumeName, s3Connection.credential),
+	})
+	if secretClass := getS3CASecretClass(s3Connection); secretClass != "" {
+		b.AddVolumes([]corev1.Volume{newCAVolume(backupS3CAVolumeName, secretClass)})
+	}
+	b.AddVolumes(dbConfig.GetVolumes())
+
+	b.SetRestPolicy(ptr.To(corev1.RestartPolicyNever))
+
+	job, err := b.GetObject()
+	if err != nil {
+		return nil, err
+	}
+
+	if dbConfig.IsEmbedded() {
+		if err := b.setupDerbyVolume(job); err != nil {
+			return nil, err
+		}
+	}
+
+	return &batchv1.CronJob{
+		ObjectMeta: job.ObjectMeta,
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   backup.Schedule,
+			Suspend:                    ptr.To(backup.Suspend || b.Stopped),
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: ptr.To[int32](backupJobHistoryLimit),
+			FailedJobsHistoryLimit:     ptr.To[int32](backupJobHistoryLimit),
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: job.Labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: ptr.To[int32](backupJobBackoffLimit),
+					Template:     job.Spec.Template,
+				},
+			},
+		},
+	}, nil
+}
+
+// setupDerbyVolume mounts the PVC of the embedded derby database into the backup pod. The PVC is
+// ReadWriteOnce, so the pod is scheduled onto the node of the metastore pod.
+// The archive is taken while the metastore is running, derby is only meant for development clusters.
+func (b *BackupCronJobBuilder) setupDerbyVolume(job *batchv1.Job) error {
+	roleGroupName, claimName, err := getDerbyClaim(b.ClusterName, b.Metastore)
+	if err != nil {
+		return err
+	}
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: derbyDataVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+				ReadOnly:  true,
+			},
+		},
+	})
+	podSpec.Affinity = &corev1.Affinity{
+		PodAffinity: &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							constants.LabelKubernetesInstance:  b.ClusterName,
+							constants.LabelKubernetesComponent: MetastoreRoleName,
+							constants.LabelKubernetesRoleGroup: roleGroupName,
+						},
+					},
+					TopologyKey: corev1.LabelHostname,
+				},
+			},
+		},
+	}
+	return nil
+}
+
+// getDumpContainer writes the dump of the database to the backup volume.
+func (b *BackupCronJobBuilder) getDumpContainer(dbConfig *DatabaseConfig) (*corev1.Container, error) {
+	image, pullPolicy := getDatabaseToolImage(dbConfig.Spec, b.ClusterConfig.Backup.Image, b.GetImage())
+	container := &corev1.Container{
+		Name:            backupDumpContainerName,
+		Image:           image,
+		ImagePullPolicy: pullPolicy,
+		Command:         []string{"sh", "-eu", "-c"},
+		VolumeMounts: append([]corev1.VolumeMount{
+			{Name: backupVolumeName, MountPath: BackupDir},
+		}, dbConfig.GetVolumeMounts()...),
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+
+	if dbConfig.IsEmbedded() {
+		name := getDerbyDatabaseName(dbConfig.Spec)
+		container.VolumeMounts = []corev1.VolumeMount{
+			{Name: backupVolumeName, MountPath: BackupDir},
+			{Name: derbyDataVolumeName, MountPath: constants.KubedoopDataDir, ReadOnly: true},
+		}
+		container.Args = []string{`
+tar czf ` + backupDumpFile + ` -C ` + path.Dir(name) + ` ` + path.Base(name) + `
+`}
+		return container, nil
+	}
+
+	env, setup, err := getDatabaseClientSetup(dbConfig, BackupDir)
+	if err != nil {
+		return nil, err
+	}
+	container.Env = env
+
+	switch dbConfig.Spec.DatabaseType {
+	case DatabaseTypePostgres:
+		container.Args = []string{setup + `
+pg_dump -Fc -f ` + backupDumpFile + `
+`}
+	case DatabaseTypeMysql, DatabaseTypeMariadb:
+		sqlFile := path.Join(BackupDir, "dump.sql")
+		container.Args = []string{setup + `
+dump=$(command -v mariadb-dump || command -v mysqldump)
+"$dump" --defaults-extra-file=` + path.Join(BackupDir, databaseClientConfigFile) + ` \
+    --single-transaction --routines --triggers "$DB_NAME" > ` + sqlFile + `
+gzip -c ` + sqlFile + ` > ` + backupDumpFile + `
+rm -f ` + sqlFile + `
+`}
+	}
+	return container, nil
+}
+
+// getUploadContainer uploads the dump, then deletes the oldest backups exceeding the retention.
+// Backup keys contain a UTC timestamp, so their lexical order is their chronological order.
+func (b *BackupCronJobBuilder) getUploadContainer(s3Connection *S3Connection) *corev1.Container {
+	backup := b.ClusterConfig.Backup
+	target := backup.Target
+
+	prefix := target.Prefix
+	if prefix == "" {
+		prefix = b.ClusterName
+	}
+	keyPrefix := path.Join(prefix, "metastore-")
+	retention := backup.Retention
+	if retention == 0 {
+		retention = defaultBackupRetention
+	}
+
+	bucketURL := getS3ObjectURL(s3Connection, target.Bucket, "")
+	listURL := bucketURL
+	listURL.RawQuery = "list-type=2&prefix=" + url.QueryEscape(keyPrefix)
+	curl := getS3CurlCommand(s3Connection, backupS3CredentialsDir, backupS3CADir)
+
+	args := `
+key="` + keyPrefix + `$(date -u +%Y%m%dT%H%M%SZ).` + databaseDumpFileExtensions[b.ClusterConfig.Database.DatabaseType] + `"
+` + curl + ` --upload-file ` + backupDumpFile + ` ` + shellQuote(bucketURL.String()) + `"$key"
+
+` + curl + ` ` + shellQuote(listURL.String()) + ` \
+    | grep -o '<Key>[^<]*</Key>' | sed -e 's/<Key>//' -e 's,</Key>,,' | sort > ` + path.Join(BackupDir, "keys") + `
+count=$(wc -l < ` + path.Join(BackupDir, "keys") + `)
+if [ "$count" -gt ` + strconv.Itoa(int(retention)) + ` ]; then
+    head -n $((count - ` + strconv.Itoa(int(retention)) + `)) ` + path.Join(BackupDir, "keys") + ` | while read -r old; do
+        ` + curl + ` -X DELETE ` + shellQuote(bucketURL.String()) + `"$old"
+        echo "deleted backup $old"
+    done
+fi
+
+echo "uploaded backup s3://` + target.Bucket + `/$key" | tee /dev/termination-log
+`
+
+	container := builder.NewContainer(backupUploadContainerName, b.GetImage())
+	container.SetCommand([]string{"sh", "-euo", "pipefail", "-c"}).
+		SetArgs([]string{args}).
+		AddVolumeMounts([]corev1.VolumeMount{
+			{Name: backupVolumeName, MountPath: BackupDir},
+			{Name: backupS3VolumeName, MountPath: backupS3CredentialsDir, ReadOnly: true},
+		})
+	if getS3CASecretClass(s3Connection) != "" {
+		container.AddVolumeMount(&corev1.VolumeMount{Name: backupS3CAVolumeName, MountPath: backupS3CADir, ReadOnly: true})
+	}
+
+	obj := container.Build()
+	obj.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	return obj
+}
+
+// GetBackupLabels returns the labels selecting the backup CronJob and its Jobs.
+func GetBackupLabels(clusterInfo reconciler.ClusterInfo) map[string]string {
+	labels := clusterInfo.GetLabels()
+	labels[constants.LabelKubernetesComponent] = BackupComponentName
+	return labels
+}
+
+func NewBackupReconciler(
+	client *client.Client,
+	clusterInfo reconciler.ClusterInfo,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	metastore *hivev1alpha1.RoleSpec,
+	stopped bool,
+	image *util.Image,
+) *reconciler.GenericResourceReconciler[*BackupCronJobBuilder] {
+	b := NewBackupCronJobBuilder(
+		client,
+		GetBackupCronJobName(clusterInfo.ClusterName),
+		clusterConfig,
+		metastore,
+		stopped,
+		image,
+		func(o *builder.Options) {
+			o.ClusterName = clusterInfo.ClusterName
+			o.RoleName = BackupComponentName
+			o.Labels = GetBackupLabels(clusterInfo)
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+	return reconciler.NewGenericResourceReconciler(client, b)
+}
+
+// DeleteBackupCronJob deletes the backup CronJob once the backup is removed from the spec, the Jobs it
+// created are deleted with it. A CronJob of the same name not labeled as the backup of the cluster is kept.
+func DeleteBackupCronJob(ctx context.Context, c *client.Client, clusterInfo reconciler.ClusterInfo) error {
+	cronJob := &batchv1.CronJob{}
+	key := ctrlclient.ObjectKey{Namespace: c.GetOwnerNamespace(), Name: GetBackupCronJobName(clusterInfo.ClusterName)}
+	if err := c.Client.Get(ctx, key, cronJob); err != nil {
+		return ctrlclient.IgnoreNotFound(err)
+	}
+	for label, value := range GetBackupLabels(clusterInfo) {
+		if cronJob.Labels[label] != value {
+			return nil
+		}
+	}
+
+	log.Info("Deleting backup cronjob, the backup was removed", "namespace", cronJob.Namespace, "name", cronJob.Name)
+	return ctrlclient.IgnoreNotFound(c.Client.Delete(ctx, cronJob, ctrlclient.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
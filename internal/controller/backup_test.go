@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func newTestS3Spec() *hivev1alpha1.S3Spec {
+	spec := newTestS3ConnectionSpec("minio")
+	spec.PathStyle = true
+	return &hivev1alpha1.S3Spec{Inline: spec}
+}
+
+func newTestMetastoreRole() *hivev1alpha1.RoleSpec {
+	return &hivev1alpha1.RoleSpec{
+		RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{"default": {Replicas: 1}},
+	}
+}
+
+// findContainer returns the container of the name, or fails the test.
+func findContainer(t *testing.T, containers []corev1.Container, name string) *corev1.Container {
+	t.Helper()
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	t.Fatalf("container %s not found", name)
+	return nil
+}
+
+// findVolume returns the volume of the name, or fails the test.
+func findVolume(t *testing.T, volumes []corev1.Volume, name string) *corev1.Volume {
+	t.Helper()
+	for i := range volumes {
+		if volumes[i].Name == name {
+			return &volumes[i]
+		}
+	}
+	t.Fatalf("volume %s not found", name)
+	return nil
+}
+
+func buildTestBackupCronJob(t *testing.T, database *hivev1alpha1.DatabaseSpec, stopped bool) *batchv1.CronJob {
+	t.Helper()
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: database,
+		Backup: &hivev1alpha1.BackupSpec{
+			Schedule:  "0 3 * * *",
+			Retention: 3,
+			Target:    &hivev1alpha1.BackupTargetSpec{S3: newTestS3Spec(), Bucket: "backups"},
+		},
+	}
+	if err := ValidateBackup(clusterConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBackupCronJobBuilder(
+		newTestClient(t),
+		GetBackupCronJobName("hive"),
+		clusterConfig,
+		newTestMetastoreRole(),
+		stopped,
+		util.NewImage(hivev1alpha1.DefaultProductName, "0.0.0-dev", hivev1alpha1.DefaultProductVersion),
+		func(o *builder.Options) {
+			o.ClusterName = "hive"
+			o.RoleName = BackupComponentName
+		},
+	)
+	obj, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj.(*batchv1.CronJob)
+}
+
+func TestBackupCronJobBuilderPostgres(t *testing.T) {
+	cronJob := buildTestBackupCronJob(t, &hivev1alpha1.DatabaseSpec{
+		DatabaseType:      DatabaseTypePostgres,
+		ConnString:        "jdbc:postgresql://postgres:5432/hive",
+		CredentialsSecret: "hive-credentials",
+	}, false)
+
+	if cronJob.Name != "hive-backup" || cronJob.Spec.Schedule != "0 3 * * *" {
+		t.Errorf("CronJob = %s with schedule %s, expected hive-backup with schedule 0 3 * * *", cronJob.Name, cronJob.Spec.Schedule)
+	}
+	if *cronJob.Spec.Suspend {
+		t.Error("CronJob of a running cluster is suspended")
+	}
+	if cronJob.Spec.ConcurrencyPolicy != batchv1.ForbidConcurrent {
+		t.Errorf("concurrency policy = %s, expected %s", cronJob.Spec.ConcurrencyPolicy, batchv1.ForbidConcurrent)
+	}
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	dump := findContainer(t, podSpec.InitContainers, backupDumpContainerName)
+	if dump.Image != "docker.io/library/postgres:17" {
+		t.Errorf("dump image = %s, expected docker.io/library/postgres:17", dump.Image)
+	}
+	if !strings.Contains(dump.Args[0], "pg_dump -Fc -f "+backupDumpFile) {
+		t.Errorf("dump args do not run pg_dump:\n%s", dump.Args[0])
+	}
+	env := map[string]string{}
+	for _, e := range dump.Env {
+		env[e.Name] = e.Value
+	}
+	if env["PGHOST"] != "postgres" || env["PGDATABASE"] != "hive" {
+		t.Errorf("dump env = %v, expected the host and database of the connString", env)
+	}
+
+	upload := findContainer(t, podSpec.Containers, backupUploadContainerName)
+	for _, expected := range []string{
+		`key="hive/metastore-$(date -u +%Y%m%dT%H%M%SZ).pgdump"`,
+		"--upload-file " + backupDumpFile + " 'http://minio:9000/backups/'",
+		"'http://minio:9000/backups/?list-type=2&prefix=hive%2Fmetastore-'",
+		`if [ "$count" -gt 3 ]; then`,
+	} {
+		if !strings.Contains(upload.Args[0], expected) {
+			t.Errorf("upload args do not contain %s:\n%s", expected, upload.Args[0])
+		}
+	}
+
+	findVolume(t, podSpec.Volumes, backupVolumeName)
+	findVolume(t, podSpec.Volumes, backupS3VolumeName)
+	findVolume(t, podSpec.Volumes, databaseCredentialsVolumeName)
+	if podSpec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("restart policy = %s, expected %s", podSpec.RestartPolicy, corev1.RestartPolicyNever)
+	}
+}
+
+func TestBackupCronJobBuilderDerby(t *testing.T) {
+	database := &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby, Storage: &commonsv1alpha1.StorageResource{}}
+	cronJob := buildTestBackupCronJob(t, database, true)
+
+	if !*cronJob.Spec.Suspend {
+		t.Error("CronJob of a stopped cluster is not suspended")
+	}
+
+	podSpec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	volume := findVolume(t, podSpec.Volumes, derbyDataVolumeName)
+	if claim := volume.PersistentVolumeClaim; claim == nil || claim.ClaimName != "derby-data-hive-metastore-default-0" || !claim.ReadOnly {
+		t.Errorf("derby volume = %+v, expected the read-only PVC of the metastore pod", volume.VolumeSource)
+	}
+	if podSpec.Affinity == nil || podSpec.Affinity.PodAffinity == nil {
+		t.Fatal("backup pod has no affinity to the metastore pod")
+	}
+
+	dump := findContainer(t, podSpec.InitContainers, backupDumpContainerName)
+	expected := "tar czf " + backupDumpFile + " -C " + path.Dir(DefaultDerbyDatabaseName) + " metastore_db"
+	if !strings.Contains(dump.Args[0], expected) {
+		t.Errorf("dump args do not contain %s:\n%s", expected, dump.Args[0])
+	}
+}
+
+func TestDeleteBackupCronJob(t *testing.T) {
+	clusterInfo := reconciler.ClusterInfo{
+		GVK:         &metav1.GroupVersionKind{Group: hivev1alpha1.GroupVersion.Group, Version: hivev1alpha1.GroupVersion.Version, Kind: "HiveMetastore"},
+		ClusterName: "hive",
+	}
+	name := GetBackupCronJobName("hive")
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		deleted bool
+	}{
+		{name: "backup cronjob", labels: GetBackupLabels(clusterInfo), deleted: true},
+		{name: "unrelated cronjob", labels: map[string]string{"app": "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: tt.labels}}
+			c := newTestClient(t, cronJob)
+
+			if err := DeleteBackupCronJob(context.Background(), c, clusterInfo); err != nil {
+				t.Fatal(err)
+			}
+			err := c.Client.Get(context.Background(), ctrlclient.ObjectKeyFromObject(cronJob), &batchv1.CronJob{})
+			if deleted := apierrors.IsNotFound(err); deleted != tt.deleted {
+				t.Errorf("deleted = %v, want %v (err %v)", deleted, tt.deleted, err)
+			}
+		})
+	}
+
+	// Without a CronJob there is nothing to delete.
+	if err := DeleteBackupCronJob(context.Background(), newTestClient(t), clusterInfo); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupCronJobBuilderS3CA(t *testing.T) {
+	s3Spec := newTestS3Spec()
+	s3Spec.Inline.Tls = newTestS3CATls("minio-ca")
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: &hivev1alpha1.DatabaseSpec{
+			DatabaseType:      DatabaseTypePostgres,
+			ConnString:        "jdbc:postgresql://postgres:5432/hive",
+			CredentialsSecret: "hive-credentials",
+		},
+		Backup: &hivev1alpha1.BackupSpec{
+			Schedule: "0 3 * * *",
+			Target:   &hivev1alpha1.BackupTargetSpec{S3: s3Spec, Bucket: "backups"},
+		},
+	}
+
+	obj, err := NewBackupCronJobBuilder(
+		newTestClient(t),
+		GetBackupCronJobName("hive"),
+		clusterConfig,
+		newTestMetastoreRole(),
+		false,
+		util.NewImage(hivev1alpha1.DefaultProductName, "0.0.0-dev", hivev1alpha1.DefaultProductVersion),
+		func(o *builder.Options) {
+			o.ClusterName = "hive"
+			o.RoleName = BackupComponentName
+		},
+	).Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	podSpec := obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec
+	volume := findVolume(t, podSpec.Volumes, backupS3CAVolumeName)
+	if secretClass := volume.Ephemeral.VolumeClaimTemplate.Annotations[constants.AnnotationSecretsClass]; secretClass != "minio-ca" {
+		t.Errorf("CA volume secretClass = %s, expected minio-ca", secretClass)
+	}
+	upload := findContainer(t, podSpec.Containers, backupUploadContainerName)
+	if !strings.Contains(upload.Args[0], "--cacert "+path.Join(backupS3CADir, tlsCACertKey)) {
+		t.Errorf("upload args do not verify the endpoint with the CA:\n%s", upload.Args[0])
+	}
+	if !slices.ContainsFunc(upload.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == backupS3CAVolumeName }) {
+		t.Errorf("upload container does not mount the CA: %v", upload.VolumeMounts)
+	}
+}
@@ -2,13 +2,21 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 
 	client "github.com/zncdatadev/operator-go/pkg/client"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
 	"github.com/zncdatadev/operator-go/pkg/util"
 
 	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
-	"github.com/zncdatadev/hive-operator/internal/util/version"
+	"github.com/zncdatadev/hive-operator/internal/constant"
+)
+
+const (
+	MetastoreRoleName   = "metastore"
+	HiveServer2RoleName = "hiveserver2"
 )
 
 var _ reconciler.Reconciler = &ClusterReconciler{}
@@ -16,6 +24,8 @@ var _ reconciler.Reconciler = &ClusterReconciler{}
 type ClusterReconciler struct {
 	reconciler.BaseCluster[*hivev1alpha1.HiveMetastoreSpec]
 	ClusterConfig *hivev1alpha1.ClusterConfigSpec
+	// Restore is the observed restore from restoreFrom, nil without a restore.
+	Restore *hivev1alpha1.RestoreStatus
 }
 
 func NewClusterReconciler(
@@ -35,48 +45,93 @@ func NewClusterReconciler(
 }
 
 func (r *ClusterReconciler) GetImage() *util.Image {
-	productVersion := r.Spec.Image.ProductVersion
-	if productVersion == "" {
-		productVersion = hivev1alpha1.DefaultProductVersion
-	}
-
-	image := util.NewImage(
-		hivev1alpha1.DefaultProductName,
-		version.BuildVersion,
-		productVersion,
-		func(options *util.ImageOptions) {
-			options.Custom = r.Spec.Image.Custom
-			options.Repo = r.Spec.Image.Repo
-			options.PullPolicy = r.Spec.Image.PullPolicy
-		},
-	)
-
-	if r.Spec.Image.KubedoopVersion != "" {
-		image.KubedoopVersion = r.Spec.Image.KubedoopVersion
-	}
+	return getImage(r.Spec.Image)
+}
 
-	return image
+// IsStopped also stops the cluster while a backup is restored, and after a failed restore.
+func (r *ClusterReconciler) IsStopped() bool {
+	return r.BaseCluster.IsStopped() || isRestoreStopping(r.Restore)
 }
 
 func (r *ClusterReconciler) RegisterResource(ctx context.Context) error {
-	roleInfo := reconciler.RoleInfo{
-		ClusterInfo: r.ClusterInfo,
-		RoleName:    "metastore",
-	}
+	metastoreURIs := GetMetastoreURIs(r.Client.GetOwnerNamespace(), r.ClusterInfo.ClusterName, r.Spec.Metastore)
 
-	node := NewNodeRoleReconciler(
-		r.Client,
-		r.IsStopped(),
-		r.ClusterConfig,
-		roleInfo,
-		r.GetImage(),
-		r.Spec.Metastore,
-	)
-	if err := node.RegisterResources(ctx); err != nil {
+	// The discovery ConfigMap only depends on the spec, it is published even while the schema is migrated.
+	r.AddResource(NewDiscoveryConfigMapReconciler(r.Client, r.ClusterInfo, r.ClusterConfig, metastoreURIs))
+
+	// The backup CronJob is kept while the cluster is stopped, it is only suspended.
+	if r.ClusterConfig.Backup != nil {
+		r.AddResource(NewBackupReconciler(r.Client, r.ClusterInfo, r.ClusterConfig, r.Spec.Metastore, r.IsStopped(), r.GetImage()))
+	} else if err := DeleteBackupCronJob(ctx, r.Client, r.ClusterInfo); err != nil {
 		return err
 	}
 
-	r.AddResource(node)
+	if r.Restore != nil && r.Restore.Phase == hivev1alpha1.RestoreRestoring {
+		r.AddResource(NewRestoreReconciler(r.Client, r.ClusterInfo, r.ClusterConfig, r.Spec.Metastore, r.GetImage()))
+	}
+
+	// The schema must be migrated before the metastore runs the new version, so the Job is registered before the roles.
+	if !r.IsStopped() && IsSchemaJobEnabled(r.ClusterConfig.Database) {
+		var libraries []hivev1alpha1.LibrarySpec
+		if r.Spec.Metastore != nil && r.Spec.Metastore.Config != nil {
+			libraries = r.Spec.Metastore.Config.Libraries
+		}
+		r.AddResource(NewSchemaReconciler(r.Client, r.ClusterInfo, r.ClusterConfig, libraries, r.GetImage()))
+	}
+
+	roles := map[string]*hivev1alpha1.RoleSpec{
+		MetastoreRoleName: r.Spec.Metastore,
+	}
+	if r.Spec.HiveServer2 != nil {
+		roles[HiveServer2RoleName] = r.Spec.HiveServer2
+	}
+
+	// The metastore role is registered first, HiveServer2 depends on it.
+	for _, roleName := range []string{MetastoreRoleName, HiveServer2RoleName} {
+		spec, ok := roles[roleName]
+		if !ok {
+			continue
+		}
+
+		roleInfo := reconciler.RoleInfo{
+			ClusterInfo: r.ClusterInfo,
+			RoleName:    roleName,
+		}
+
+		node := NewNodeRoleReconciler(
+			r.Client,
+			r.IsStopped(),
+			r.ClusterConfig,
+			roleInfo,
+			r.GetImage(),
+			metastoreURIs,
+			spec,
+		)
+		if err := node.RegisterResources(ctx); err != nil {
+			return err
+		}
+
+		r.AddResource(node)
+	}
 
 	return nil
 }
+
+// GetMetastoreURIs returns the thrift URIs of all metastore rolegroup services, sorted by rolegroup name.
+func GetMetastoreURIs(namespace string, clusterName string, metastore *hivev1alpha1.RoleSpec) []string {
+	if metastore == nil {
+		return nil
+	}
+
+	uris := make([]string, 0, len(metastore.RoleGroups))
+	for _, roleGroupName := range slices.Sorted(maps.Keys(metastore.RoleGroups)) {
+		svcName := clusterName + "-" + MetastoreRoleName + "-" + roleGroupName
+		uris = append(uris, fmt.Sprintf("thrift://%s:%d", GetServiceFQDN(namespace, svcName), constant.MetastorePort))
+	}
+	return uris
+}
+
+// GetServiceFQDN returns the cluster DNS name of a Service.
+func GetServiceFQDN(namespace string, serviceName string) string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", serviceName, namespace)
+}
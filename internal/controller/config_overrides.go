@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/config/xml"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const HiveSiteFileName = "hive-site.xml"
+
+// getConfigOverrideFiles returns the files of the rolegroup ConfigMap which accept configOverrides.
+func getConfigOverrideFiles(roleName string) []string {
+	return []string{HiveSiteFileName, CoreSiteFileName, getLog4j2FileName(roleName)}
+}
+
+// validateConfigOverrides checks that the configOverrides of the role and of each rolegroup
+// only target files rendered by the operator.
+func validateConfigOverrides(roleName string, role *hivev1alpha1.RoleSpec) error {
+	if role == nil {
+		return nil
+	}
+
+	files := getConfigOverrideFiles(roleName)
+	check := func(overrides map[string]map[string]string, scope string) error {
+		for _, file := range slices.Sorted(maps.Keys(overrides)) {
+			if !slices.Contains(files, file) {
+				return fmt.Errorf("configOverrides of %s cannot override %s, supported files are %s",
+					scope, file, strings.Join(files, ", "))
+			}
+		}
+		return nil
+	}
+
+	if role.OverridesSpec != nil {
+		if err := check(role.ConfigOverrides, "role "+roleName); err != nil {
+			return err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(role.RoleGroups)) {
+		roleGroup := role.RoleGroups[name]
+		if roleGroup == nil || roleGroup.OverridesSpec == nil {
+			continue
+		}
+		if err := check(roleGroup.ConfigOverrides, "rolegroup "+roleName+"-"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyXMLOverrides sets the overrides in the configuration, it returns the overridden keys
+// which were set by the operator.
+func applyXMLOverrides(config *xml.XMLConfiguration, overrides map[string]string) []string {
+	overridden := []string{}
+	for _, key := range slices.Sorted(maps.Keys(overrides)) {
+		if _, ok := config.GetProperty(key); ok {
+			overridden = append(overridden, key)
+		}
+	}
+	config.AddPropertiesWithMap(overrides)
+	return overridden
+}
+
+// applyPropertiesOverrides replaces the values of the overridden keys in a properties file
+// and appends the other overrides, comments and the order of the keys are kept.
+// It returns the content and the overridden keys which were set by the operator.
+func applyPropertiesOverrides(content string, overrides map[string]string) (string, []string) {
+	if len(overrides) == 0 {
+		return content, nil
+	}
+
+	overridden := []string{}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "!") {
+			continue
+		}
+		key, _, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if value, ok := overrides[key]; ok {
+			lines[i] = key + " = " + value
+			if !slices.Contains(overridden, key) {
+				overridden = append(overridden, key)
+			}
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(overrides)) {
+		if !slices.Contains(overridden, key) {
+			lines = append(lines, key+" = "+overrides[key])
+		}
+	}
+	slices.Sort(overridden)
+	return strings.Join(lines, "\n") + "\n", overridden
+}
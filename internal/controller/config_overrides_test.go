@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/config/xml"
+)
+
+func TestApplyXMLOverrides(t *testing.T) {
+	config := xml.NewXMLConfigurationFromMap(map[string]string{
+		"hive.metastore.warehouse.dir": "/kubedoop/warehouse",
+		"fs.s3a.path.style.access":     "true",
+	})
+
+	overridden := applyXMLOverrides(config, map[string]string{
+		"fs.s3a.path.style.access":    "false",
+		"hive.metastore.event.db.ttl": "1d",
+	})
+
+	if expected := []string{"fs.s3a.path.style.access"}; !slices.Equal(overridden, expected) {
+		t.Errorf("applyXMLOverrides() = %v, expected %v", overridden, expected)
+	}
+	for key, expected := range map[string]string{
+		"hive.metastore.warehouse.dir": "/kubedoop/warehouse",
+		"fs.s3a.path.style.access":     "false",
+		"hive.metastore.event.db.ttl":  "1d",
+	} {
+		if property, ok := config.GetProperty(key); !ok || property.Value != expected {
+			t.Errorf("property %s = %q, expected %q", key, property.Value, expected)
+		}
+	}
+}
+
+func TestApplyPropertiesOverrides(t *testing.T) {
+	content := `# console appender
+appender.console.type = Console
+rootLogger.level=INFO
+! legacy comment
+`
+	tests := []struct {
+		name               string
+		overrides          map[string]string
+		expected           string
+		expectedOverridden []string
+	}{
+		{
+			name:     "without overrides",
+			expected: content,
+		},
+		{
+			name: "replace and append",
+			overrides: map[string]string{
+				"rootLogger.level":      "DEBUG",
+				"logger.hive.name":      "org.apache.hadoop.hive",
+				"appender.console.type": "Console",
+				"logger.hive.level":     "WARN",
+			},
+			expected: `# console appender
+appender.console.type = Console
+rootLogger.level = DEBUG
+! legacy comment
+logger.hive.level = WARN
+logger.hive.name = org.apache.hadoop.hive
+`,
+			expectedOverridden: []string{"appender.console.type", "rootLogger.level"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, overridden := applyPropertiesOverrides(content, tt.overrides)
+			if got != tt.expected {
+				t.Errorf("applyPropertiesOverrides() content =\n%s\nexpected\n%s", got, tt.expected)
+			}
+			if !slices.Equal(overridden, tt.expectedOverridden) {
+				t.Errorf("applyPropertiesOverrides() overridden = %v, expected %v", overridden, tt.expectedOverridden)
+			}
+		})
+	}
+}
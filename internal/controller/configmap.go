@@ -2,6 +2,9 @@ package controller
 
 import (
 	"context"
+	"maps"
+	"strconv"
+	"strings"
 
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/builder"
@@ -13,6 +16,7 @@ import (
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/constant"
 )
 
 var _ builder.ConfigBuilder = &ConfigMapBuilder{}
@@ -23,6 +27,15 @@ type ConfigMapBuilder struct {
 	ClusterConfig *hivev1alpha1.ClusterConfigSpec
 
 	RoleGroupConfig *hivev1alpha1.ConfigSpec
+
+	// MetastoreURIs are set in the hive-site.xml of roles connecting to the metastore.
+	MetastoreURIs []string
+
+	// ConfigOverrides are the merged configOverrides of the role and rolegroup, keyed by file name.
+	ConfigOverrides map[string]map[string]string
+
+	// overriddenKeys are the operator-managed keys replaced by ConfigOverrides, as <file>:<key>.
+	overriddenKeys []string
 }
 
 func NewConfigMapBuilder(
@@ -30,6 +43,8 @@ func NewConfigMapBuilder(
 	name string,
 	clusterConfig *hivev1alpha1.ClusterConfigSpec,
 	roleGroupConfig *hivev1alpha1.ConfigSpec,
+	metastoreURIs []string,
+	overrides *commonsv1alpha1.OverridesSpec,
 	options ...builder.Option,
 ) *ConfigMapBuilder {
 	opts := builder.Options{}
@@ -37,6 +52,11 @@ func NewConfigMapBuilder(
 		o(&opts)
 	}
 
+	var configOverrides map[string]map[string]string
+	if overrides != nil {
+		configOverrides = overrides.ConfigOverrides
+	}
+
 	return &ConfigMapBuilder{
 		ConfigMapBuilder: *builder.NewConfigMapBuilder(
 			client,
@@ -45,19 +65,29 @@ func NewConfigMapBuilder(
 		),
 		ClusterConfig:   clusterConfig,
 		RoleGroupConfig: roleGroupConfig,
+		MetastoreURIs:   metastoreURIs,
+		ConfigOverrides: configOverrides,
 	}
 }
 
 func (b *ConfigMapBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
-	var s3Connection *S3Connection
-	if b.ClusterConfig.S3 != nil {
-		if s, err := GetS3Connect(ctx, b.Client, b.ClusterConfig.S3); err != nil {
+	b.overriddenKeys = nil
+
+	s3Config, err := GetS3Config(ctx, b.Client, b.ClusterConfig.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	var hdfsConfig *HDFSConfig
+	if b.ClusterConfig.HDFS != nil {
+		if h, err := GetHDFSConfig(ctx, b.Client, b.ClusterConfig.HDFS); err != nil {
 			return nil, err
 		} else {
-			s3Connection = s
+			hdfsConfig = h
 		}
 	}
-	if err := b.addHiveSite(s3Connection); err != nil {
+
+	if err := b.addHiveSite(s3Config); err != nil {
 		return nil, err
 	}
 
@@ -65,7 +95,11 @@ func (b *ConfigMapBuilder) Build(ctx context.Context) (ctrlclient.Object, error)
 		return nil, err
 	}
 
-	if err := b.addCoreSite(); err != nil {
+	if err := b.addCoreSite(hdfsConfig); err != nil {
+		return nil, err
+	}
+
+	if err := b.addHdfsSite(hdfsConfig); err != nil {
 		return nil, err
 	}
 
@@ -73,7 +107,25 @@ func (b *ConfigMapBuilder) Build(ctx context.Context) (ctrlclient.Object, error)
 		return nil, err
 	}
 
-	return b.GetObject(), nil
+	obj := b.GetObject()
+	if len(b.overriddenKeys) > 0 {
+		log.Info("configOverrides replace operator-managed keys", "configmap", obj.Name, "keys", b.overriddenKeys)
+		// The annotations map is shared with the other builders of the rolegroup, so copy it before writing.
+		annotations := maps.Clone(obj.Annotations)
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[constant.AnnotationOverriddenConfigKeys] = strings.Join(b.overriddenKeys, ",")
+		obj.Annotations = annotations
+	}
+	return obj, nil
+}
+
+// addOverriddenKeys records the operator-managed keys of the file replaced by configOverrides.
+func (b *ConfigMapBuilder) addOverriddenKeys(file string, keys []string) {
+	for _, key := range keys {
+		b.overriddenKeys = append(b.overriddenKeys, file+":"+key)
+	}
 }
 
 func (b *ConfigMapBuilder) addVectorConfig(ctx context.Context) error {
@@ -95,7 +147,7 @@ func (b *ConfigMapBuilder) addVectorConfig(ctx context.Context) error {
 	return nil
 }
 
-func (b *ConfigMapBuilder) addHiveSite(s3Connection *S3Connection) error {
+func (b *ConfigMapBuilder) addHiveSite(s3Config *S3Config) error {
 	warehouseDir := hivev1alpha1.DefaultWarehouseDir
 	if b.RoleGroupConfig != nil {
 		warehouseDir = b.RoleGroupConfig.WarehouseDir
@@ -103,41 +155,91 @@ func (b *ConfigMapBuilder) addHiveSite(s3Connection *S3Connection) error {
 	config := xml.NewXMLConfiguration()
 	config.AddPropertyWithString("hive.metastore.warehouse.dir", warehouseDir, "Default is"+hivev1alpha1.DefaultWarehouseDir)
 
-	if s3Connection != nil {
-		s3Config := NewS3Config(s3Connection)
+	if b.RoleName == HiveServer2RoleName {
+		config.AddPropertiesWithMap(b.getHiveServer2Site())
+	}
+
+	// HiveServer2 uses the remote metastore, only the metastore accesses the database.
+	if b.RoleName == MetastoreRoleName {
+		var performance *hivev1alpha1.PerformanceSpec
+		if b.RoleGroupConfig != nil {
+			performance = b.RoleGroupConfig.Performance
+		}
+		config.AddPropertiesWithMap(NewPerformanceConfig(b.ClusterConfig.Database, performance).GetHiveSite())
+	}
+
+	if s3Config != nil {
 		config.AddPropertiesWithMap(s3Config.GetHiveSite())
 	}
 
-	if b.ClusterConfig.Authentication != nil {
-		krb5Config := NewKerberosConfig(
-			b.Client.GetOwnerNamespace(),
-			b.ClusterName,
-			b.RoleName,
-			b.ClusterConfig.Authentication.Kerberos.SecretClass,
-		)
+	if IsKerberosEnabled(b.ClusterConfig) {
+		krb5Config := NewKerberosConfig(b.ClusterConfig.Authentication.Kerberos, b.Client.GetOwnerNamespace(), b.Name, b.RoleName)
 		config.AddPropertiesWithMap(krb5Config.GetHiveSite())
 	}
 
+	if IsTlsEnabled(b.ClusterConfig) {
+		tlsConfig := NewTlsConfig(b.ClusterConfig.Authentication.Tls, b.Name, b.RoleName)
+		config.AddPropertiesWithMap(tlsConfig.GetHiveSite())
+	}
+
+	b.addOverriddenKeys(HiveSiteFileName, applyXMLOverrides(config, b.ConfigOverrides[HiveSiteFileName]))
+
 	s, err := config.Marshal()
 	if err != nil {
 		return err
 	}
-	b.AddItem("hive-site.xml", s)
+	b.AddItem(HiveSiteFileName, s)
 	return nil
 }
 
-// If kerberos enable and no hdfs as storage, then add kerberos config.
+// getHiveServer2Site returns the HiveServer2 listener settings and the metastore it connects to.
+func (b *ConfigMapBuilder) getHiveServer2Site() map[string]string {
+	return map[string]string{
+		"hive.metastore.uris":           strings.Join(b.MetastoreURIs, ","),
+		"hive.server2.thrift.bind.host": "0.0.0.0",
+		"hive.server2.thrift.port":      strconv.Itoa(constant.HiveServer2Port),
+		"hive.server2.webui.host":       "0.0.0.0",
+		"hive.server2.webui.port":       strconv.Itoa(constant.HiveServer2WebUIPort),
+	}
+}
+
+// addCoreSite merges the core-site.xml of the HDFS discovery ConfigMap with the kerberos config.
+// If kerberos enable and no hdfs as storage, then only add kerberos config.
 // Example: When use S3 as storage, kerberos is enabled.
-func (b *ConfigMapBuilder) addCoreSite() error {
-	if b.ClusterConfig.Authentication != nil {
-		config := xml.NewXMLConfiguration()
+func (b *ConfigMapBuilder) addCoreSite(hdfsConfig *HDFSConfig) error {
+	overrides := b.ConfigOverrides[CoreSiteFileName]
+	if hdfsConfig == nil && !IsKerberosEnabled(b.ClusterConfig) && len(overrides) == 0 {
+		return nil
+	}
+
+	config := xml.NewXMLConfiguration()
+	if hdfsConfig != nil {
+		config = hdfsConfig.CoreSite
+	}
+	if IsKerberosEnabled(b.ClusterConfig) {
 		config.AddPropertyWithString("hadoop.security.authentication", kerberosAuthType, "")
-		s, err := config.Marshal()
-		if err != nil {
-			return err
-		}
-		b.AddItem("core-site.xml", s)
 	}
+	b.addOverriddenKeys(CoreSiteFileName, applyXMLOverrides(config, overrides))
+
+	s, err := config.Marshal()
+	if err != nil {
+		return err
+	}
+	b.AddItem(CoreSiteFileName, s)
+	return nil
+}
+
+// addHdfsSite copies the hdfs-site.xml of the HDFS discovery ConfigMap.
+func (b *ConfigMapBuilder) addHdfsSite(hdfsConfig *HDFSConfig) error {
+	if hdfsConfig == nil {
+		return nil
+	}
+
+	s, err := hdfsConfig.HdfsSite.Marshal()
+	if err != nil {
+		return err
+	}
+	b.AddItem(HdfsSiteFileName, s)
 	return nil
 }
 
@@ -174,15 +276,28 @@ func (b *ConfigMapBuilder) addLog4j2() error {
 		return err
 	}
 
-	b.AddItem("metastore-log4j2.properties", s)
+	fileName := getLog4j2FileName(b.RoleName)
+	s, overridden := applyPropertiesOverrides(s, b.ConfigOverrides[fileName])
+	b.addOverriddenKeys(fileName, overridden)
+	b.AddItem(fileName, s)
 	return nil
 }
 
+// getLog4j2FileName returns the log4j2 configuration file name read by the role.
+func getLog4j2FileName(roleName string) string {
+	if roleName == HiveServer2RoleName {
+		return "hive-log4j2.properties"
+	}
+	return "metastore-log4j2.properties"
+}
+
 func NewConfigMapReconciler(
 	client *client.Client,
 	clusterConfig *hivev1alpha1.ClusterConfigSpec,
 	info reconciler.RoleGroupInfo,
 	config *hivev1alpha1.ConfigSpec,
+	metastoreURIs []string,
+	overrides *commonsv1alpha1.OverridesSpec,
 	options ...builder.Option,
 ) *reconciler.GenericResourceReconciler[*ConfigMapBuilder] {
 	cmBuilder := NewConfigMapBuilder(
@@ -190,6 +305,8 @@ func NewConfigMapReconciler(
 		info.GetFullName(),
 		clusterConfig,
 		config,
+		metastoreURIs,
+		overrides,
 		options...,
 	)
 	return reconciler.NewGenericResourceReconciler[*ConfigMapBuilder](
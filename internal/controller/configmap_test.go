@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/config/xml"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/constant"
+)
+
+func buildTestConfigMap(t *testing.T, roleName string, overrides *commonsv1alpha1.OverridesSpec) *corev1.ConfigMap {
+	t.Helper()
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: &hivev1alpha1.DatabaseSpec{
+			DatabaseType:      DatabaseTypePostgres,
+			Host:              "postgres",
+			DatabaseName:      "hive",
+			CredentialsSecret: "hive-credentials",
+		},
+	}
+	uris := GetMetastoreURIs("ns", "hive", &hivev1alpha1.RoleSpec{
+		RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{"default": {}},
+	})
+
+	b := NewConfigMapBuilder(
+		newTestClient(t),
+		"hive-"+roleName+"-default",
+		clusterConfig,
+		&hivev1alpha1.ConfigSpec{RoleGroupConfigSpec: &commonsv1alpha1.RoleGroupConfigSpec{}, WarehouseDir: "/warehouse"},
+		uris,
+		overrides,
+		func(o *builder.Options) {
+			o.ClusterName = "hive"
+			o.RoleName = roleName
+			o.RoleGroupName = "default"
+		},
+	)
+	obj, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj.(*corev1.ConfigMap)
+}
+
+func parseTestHiveSite(t *testing.T, cm *corev1.ConfigMap) *xml.XMLConfiguration {
+	t.Helper()
+	hiveSite, err := xml.NewXMLConfigurationFromString(cm.Data[HiveSiteFileName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hiveSite
+}
+
+func TestConfigMapBuilderHiveServer2(t *testing.T) {
+	cm := buildTestConfigMap(t, HiveServer2RoleName, &commonsv1alpha1.OverridesSpec{
+		ConfigOverrides: map[string]map[string]string{
+			HiveSiteFileName: {"hive.server2.webui.port": "10003"},
+		},
+	})
+	hiveSite := parseTestHiveSite(t, cm)
+
+	expected := map[string]string{
+		"hive.metastore.warehouse.dir":  "/warehouse",
+		"hive.metastore.uris":           "thrift://hive-metastore-default.ns.svc.cluster.local:9083",
+		"hive.server2.thrift.bind.host": "0.0.0.0",
+		"hive.server2.thrift.port":      "10000",
+		"hive.server2.webui.host":       "0.0.0.0",
+		"hive.server2.webui.port":       "10003",
+	}
+	for key, value := range expected {
+		if property, ok := hiveSite.GetProperty(key); !ok || property.Value != value {
+			t.Errorf("%s = %q, expected %q", key, property.Value, value)
+		}
+	}
+	// HiveServer2 connects to the remote metastore, not to the database.
+	if _, ok := hiveSite.GetProperty("datanucleus.connectionPoolingType"); ok {
+		t.Error("hive-site.xml of hiveserver2 contains the database settings of the metastore")
+	}
+
+	if _, ok := cm.Data["hive-log4j2.properties"]; !ok {
+		t.Errorf("ConfigMap does not contain hive-log4j2.properties, keys are %v", cm.Data)
+	}
+	if got := cm.Annotations[constant.AnnotationOverriddenConfigKeys]; got != "hive-site.xml:hive.server2.webui.port" {
+		t.Errorf("overridden keys = %q, expected hive-site.xml:hive.server2.webui.port", got)
+	}
+}
+
+func TestConfigMapBuilderMetastore(t *testing.T) {
+	cm := buildTestConfigMap(t, MetastoreRoleName, nil)
+	hiveSite := parseTestHiveSite(t, cm)
+
+	if property, ok := hiveSite.GetProperty("datanucleus.connectionPool.maxPoolSize"); !ok || property.Value != "10" {
+		t.Errorf("datanucleus.connectionPool.maxPoolSize = %q, expected 10", property.Value)
+	}
+	for _, key := range []string{"hive.metastore.uris", "hive.server2.thrift.port"} {
+		if _, ok := hiveSite.GetProperty(key); ok {
+			t.Errorf("hive-site.xml of the metastore contains %s", key)
+		}
+	}
+	if _, ok := cm.Data["metastore-log4j2.properties"]; !ok {
+		t.Errorf("ConfigMap does not contain metastore-log4j2.properties, keys are %v", cm.Data)
+	}
+	if _, ok := cm.Annotations[constant.AnnotationOverriddenConfigKeys]; ok {
+		t.Error("ConfigMap is annotated with overridden keys without configOverrides")
+	}
+}
+
+func TestRoleGroupOverriddenKeysOnlyAnnotateConfigMap(t *testing.T) {
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby},
+	}
+	roleInfo := reconciler.RoleInfo{
+		ClusterInfo: reconciler.ClusterInfo{
+			GVK:         &metav1.GroupVersionKind{Group: hivev1alpha1.GroupVersion.Group, Version: hivev1alpha1.GroupVersion.Version, Kind: "HiveMetastore"},
+			ClusterName: "hive",
+		},
+		RoleName: MetastoreRoleName,
+	}
+	roleInfo.AddAnnotation("example.com/team", "data")
+	r := NewNodeRoleReconciler(newTestClient(t), false, clusterConfig, roleInfo,
+		util.NewImage(hivev1alpha1.DefaultProductName, "0.0.0-dev", hivev1alpha1.DefaultProductVersion), nil, nil)
+
+	reconcilers, err := r.GetImageResourceWithRoleGroup(
+		context.Background(),
+		reconciler.RoleGroupInfo{RoleInfo: roleInfo, RoleGroupName: "default"},
+		&hivev1alpha1.ConfigSpec{RoleGroupConfigSpec: &commonsv1alpha1.RoleGroupConfigSpec{}, WarehouseDir: "/warehouse"},
+		&commonsv1alpha1.OverridesSpec{
+			ConfigOverrides: map[string]map[string]string{HiveSiteFileName: {"hive.metastore.warehouse.dir": "/other"}},
+		},
+		ptr.To[int32](1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objs := []ctrlclient.Object{}
+	for _, rec := range reconcilers {
+		var b builder.ObjectBuilder
+		switch rec := rec.(type) {
+		case *reconciler.GenericResourceReconciler[*ConfigMapBuilder]:
+			b = rec.GetBuilder()
+		case *reconciler.StatefulSet:
+			b = rec.GetBuilder()
+		case *reconciler.Service:
+			b = rec.GetBuilder()
+		default:
+			continue
+		}
+		obj, err := b.Build(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, obj)
+	}
+	if len(objs) != 3 {
+		t.Fatalf("built %d objects, expected the ConfigMap, the StatefulSet and the Service", len(objs))
+	}
+
+	for _, obj := range objs {
+		annotations := obj.GetAnnotations()
+		if _, ok := obj.(*corev1.ConfigMap); ok {
+			if annotations[constant.AnnotationOverriddenConfigKeys] == "" {
+				t.Errorf("ConfigMap is not annotated with the overridden keys")
+			}
+			continue
+		}
+		if _, ok := annotations[constant.AnnotationOverriddenConfigKeys]; ok {
+			t.Errorf("%T is annotated with the overridden keys", obj)
+		}
+		if annotations["example.com/team"] != "data" {
+			t.Errorf("%T lost the annotations of the rolegroup: %v", obj, annotations)
+		}
+		if sts, ok := obj.(*appsv1.StatefulSet); ok {
+			if _, ok := sts.Spec.Template.Annotations[constant.AnnotationOverriddenConfigKeys]; ok {
+				t.Error("pod template is annotated with the overridden keys")
+			}
+		}
+	}
+}
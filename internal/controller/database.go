@@ -0,0 +1,365 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	DatabaseTypeDerby    = "derby"
+	DatabaseTypeMysql    = "mysql"
+	DatabaseTypeMariadb  = "mariadb"
+	DatabaseTypePostgres = "postgres"
+	DatabaseTypeOracle   = "oracle"
+	DatabaseTypeMssql    = "mssql"
+
+	DatabaseUsernameKey = "username"
+	DatabasePasswordKey = "password"
+
+	databaseCredentialsVolumeName = "database-credentials"
+	derbyDataVolumeName           = "derby-data"
+
+	defaultDerbyCapacity = "1Gi"
+)
+
+var (
+	DatabaseCredentialsDir = path.Join(constants.KubedoopSecretDir, "database")
+
+	// DefaultDerbyDatabaseName is the path of the embedded derby database, on the PVC mounted at the data dir.
+	// Derby refuses to create a database in an existing directory, so it is a subdirectory of the mount.
+	DefaultDerbyDatabaseName = path.Join(constants.KubedoopDataDir, "metastore_db")
+)
+
+// DatabaseDriver describes how the metastore connects to a type of database.
+type DatabaseDriver struct {
+	// DriverClass is the JDBC driver class.
+	DriverClass string
+	// SchemaType is the `-dbType` of schematool.
+	SchemaType  string
+	DefaultPort int32
+}
+
+var databaseDrivers = map[string]DatabaseDriver{
+	DatabaseTypeDerby:    {DriverClass: "org.apache.derby.jdbc.EmbeddedDriver", SchemaType: "derby"},
+	DatabaseTypeMysql:    {DriverClass: "com.mysql.cj.jdbc.Driver", SchemaType: "mysql", DefaultPort: 3306},
+	DatabaseTypeMariadb:  {DriverClass: "org.mariadb.jdbc.Driver", SchemaType: "mysql", DefaultPort: 3306},
+	DatabaseTypePostgres: {DriverClass: "org.postgresql.Driver", SchemaType: "postgres", DefaultPort: 5432},
+	DatabaseTypeOracle:   {DriverClass: "oracle.jdbc.OracleDriver", SchemaType: "oracle", DefaultPort: 1521},
+	DatabaseTypeMssql:    {DriverClass: "com.microsoft.sqlserver.jdbc.SQLServerDriver", SchemaType: "mssql", DefaultPort: 1433},
+}
+
+// GetDatabaseDriver returns the driver of the database type, unknown types are an error
+// instead of falling back to an embedded derby database.
+func GetDatabaseDriver(databaseType string) (*DatabaseDriver, error) {
+	driver, ok := databaseDrivers[databaseType]
+	if !ok {
+		return nil, fmt.Errorf("unknown database type %q, supported types are %s",
+			databaseType, strings.Join(slices.Sorted(maps.Keys(databaseDrivers)), ", "))
+	}
+	return &driver, nil
+}
+
+// DatabaseConfig is the resolved connection of the metastore database.
+type DatabaseConfig struct {
+	Spec   *hivev1alpha1.DatabaseSpec
+	Driver *DatabaseDriver
+	URL    string
+}
+
+func NewDatabaseConfig(database *hivev1alpha1.DatabaseSpec) (*DatabaseConfig, error) {
+	driver, err := GetDatabaseDriver(database.DatabaseType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDatabaseTls(database); err != nil {
+		return nil, err
+	}
+
+	url, err := getJdbcURL(database, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	if database.DatabaseType != DatabaseTypeDerby {
+		if database.CredentialsSecret == "" && database.Credentials == nil {
+			return nil, fmt.Errorf("database of type %s requires either credentialsSecret or credentials", database.DatabaseType)
+		}
+		if database.CredentialsSecret != "" && database.Credentials != nil {
+			return nil, fmt.Errorf("database credentialsSecret and credentials are mutually exclusive")
+		}
+	}
+
+	return &DatabaseConfig{
+		Spec:   database,
+		Driver: driver,
+		URL:    url,
+	}, nil
+}
+
+// IsEmbedded reports whether the database runs inside the metastore pod.
+func (c *DatabaseConfig) IsEmbedded() bool {
+	return c.Spec.DatabaseType == DatabaseTypeDerby
+}
+
+// getJdbcURL returns the raw connString if set, otherwise renders the URL from the structured fields.
+func getJdbcURL(database *hivev1alpha1.DatabaseSpec, driver *DatabaseDriver) (string, error) {
+	if database.ConnString != "" {
+		return database.ConnString, nil
+	}
+
+	if database.DatabaseType == DatabaseTypeDerby {
+		name := database.DatabaseName
+		if name == "" {
+			name = DefaultDerbyDatabaseName
+		}
+		return "jdbc:derby:" + name + ";create=true", nil
+	}
+
+	if database.Host == "" {
+		return "", fmt.Errorf("database of type %s requires either connString or host", database.DatabaseType)
+	}
+	if database.DatabaseName == "" {
+		return "", fmt.Errorf("database of type %s requires either connString or databaseName", database.DatabaseType)
+	}
+
+	port := database.Port
+	if port == 0 {
+		port = driver.DefaultPort
+	}
+	address := database.Host + ":" + strconv.Itoa(int(port))
+
+	params := maps.Clone(database.Parameters)
+	if params == nil {
+		params = map[string]string{}
+	}
+	setTlsParams(params, database)
+	sslMode := getSSLMode(database)
+
+	switch database.DatabaseType {
+	case DatabaseTypeMysql:
+		setSSLModeParam(params, "sslMode", sslMode, map[string]string{
+			"disable": "DISABLED", "require": "REQUIRED", "verify-ca": "VERIFY_CA", "verify-full": "VERIFY_IDENTITY",
+		})
+		return "jdbc:mysql://" + address + "/" + database.DatabaseName + encodeQueryParams(params), nil
+	case DatabaseTypeMariadb:
+		setSSLModeParam(params, "sslMode", sslMode, map[string]string{
+			"disable": "disable", "require": "trust", "verify-ca": "verify-ca", "verify-full": "verify-full",
+		})
+		return "jdbc:mariadb://" + address + "/" + database.DatabaseName + encodeQueryParams(params), nil
+	case DatabaseTypePostgres:
+		setSSLModeParam(params, "sslmode", sslMode, map[string]string{
+			"disable": "disable", "require": "require", "verify-ca": "verify-ca", "verify-full": "verify-full",
+		})
+		return "jdbc:postgresql://" + address + "/" + database.DatabaseName + encodeQueryParams(params), nil
+	case DatabaseTypeOracle:
+		// TCPS is used for any SSL mode, the server certificate is verified against the JVM truststore
+		// or the truststore built from the tls CA.
+		protocol := "//"
+		if sslMode != "" && sslMode != "disable" {
+			protocol = "tcps://"
+		}
+		return "jdbc:oracle:thin:@" + protocol + address + "/" + database.DatabaseName + encodeQueryParams(params), nil
+	case DatabaseTypeMssql:
+		switch sslMode {
+		case "disable":
+			setDefault(params, "encrypt", "false")
+		case "require":
+			setDefault(params, "encrypt", "true")
+			setDefault(params, "trustServerCertificate", "true")
+		case "verify-ca", "verify-full":
+			setDefault(params, "encrypt", "true")
+			setDefault(params, "trustServerCertificate", "false")
+		}
+		params["databaseName"] = database.DatabaseName
+		jdbcURL := "jdbc:sqlserver://" + address
+		for _, key := range slices.Sorted(maps.Keys(params)) {
+			jdbcURL += ";" + key + "=" + params[key]
+		}
+		return jdbcURL, nil
+	default:
+		return "", fmt.Errorf("cannot render a JDBC URL for database type %s", database.DatabaseType)
+	}
+}
+
+func setSSLModeParam(params map[string]string, key string, sslMode string, values map[string]string) {
+	if value, ok := values[sslMode]; ok {
+		setDefault(params, key, value)
+	}
+}
+
+// setDefault sets the param unless it is given explicitly in the extra params.
+func setDefault(params map[string]string, key, value string) {
+	if _, ok := params[key]; !ok {
+		params[key] = value
+	}
+}
+
+func encodeQueryParams(params map[string]string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	return "?" + values.Encode()
+}
+
+// GetEnv returns the JDO connection options and the schematool database type.
+// The credentials are not passed through the env or the JVM arguments, see GetContainerCommandArgs.
+func (c *DatabaseConfig) GetEnv() []corev1.EnvVar {
+	jvmOpts := []string{
+		"-Djavax.jdo.option.ConnectionURL=" + c.URL,
+		"-Djavax.jdo.option.ConnectionDriverName=" + c.Driver.DriverClass,
+	}
+
+	return []corev1.EnvVar{
+		{
+			Name:  "HADOOP_CLIENT_OPTS",
+			Value: strings.Join(jvmOpts, " "),
+		},
+		{
+			Name:  "DB_DRIVER",
+			Value: c.Driver.SchemaType,
+		},
+	}
+}
+
+// getCredentialsKeys returns the file names of the username and password in the credentials volume.
+// The keys of a plain Secret are fixed, the keys provisioned by a SecretClass are configurable.
+func (c *DatabaseConfig) getCredentialsKeys() (string, string) {
+	usernameKey, passwordKey := DatabaseUsernameKey, DatabasePasswordKey
+	if credentials := c.Spec.Credentials; credentials != nil {
+		if credentials.UsernameKey != "" {
+			usernameKey = credentials.UsernameKey
+		}
+		if credentials.PasswordKey != "" {
+			passwordKey = credentials.PasswordKey
+		}
+	}
+	return usernameKey, passwordKey
+}
+
+func (c *DatabaseConfig) GetVolumes() []corev1.Volume {
+	if c.IsEmbedded() {
+		return nil
+	}
+
+	return append(c.getCredentialsVolumes(), c.getTlsVolumes()...)
+}
+
+func (c *DatabaseConfig) getCredentialsVolumes() []corev1.Volume {
+	if c.Spec.Credentials != nil {
+		return []corev1.Volume{newCredentialsVolume(databaseCredentialsVolumeName, &c.Spec.Credentials.Credentials)}
+	}
+
+	return []corev1.Volume{
+		{
+			Name: databaseCredentialsVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: c.Spec.CredentialsSecret,
+					Items: []corev1.KeyToPath{
+						{Key: DatabaseUsernameKey, Path: DatabaseUsernameKey},
+						{Key: DatabasePasswordKey, Path: DatabasePasswordKey},
+					},
+					DefaultMode: ptr.To[int32](0400),
+				},
+			},
+		},
+	}
+}
+
+// GetVolumeClaimTemplates returns the PVC of the embedded derby database.
+func (c *DatabaseConfig) GetVolumeClaimTemplates() []corev1.PersistentVolumeClaim {
+	if !c.IsEmbedded() {
+		return nil
+	}
+
+	capacity := resource.MustParse(defaultDerbyCapacity)
+	var storageClass *string
+	if storage := c.Spec.Storage; storage != nil {
+		if !storage.Capacity.IsZero() {
+			capacity = storage.Capacity
+		}
+		if storage.StorageClass != "" {
+			storageClass = ptr.To(storage.StorageClass)
+		}
+	}
+
+	return []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: derbyDataVolumeName,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: storageClass,
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: capacity,
+					},
+				},
+			},
+		},
+	}
+}
+
+func (c *DatabaseConfig) GetVolumeMounts() []corev1.VolumeMount {
+	if c.IsEmbedded() {
+		return []corev1.VolumeMount{
+			{
+				Name:      derbyDataVolumeName,
+				MountPath: constants.KubedoopDataDir,
+			},
+		}
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      databaseCredentialsVolumeName,
+			MountPath: DatabaseCredentialsDir,
+			ReadOnly:  true,
+		},
+	}
+	return append(volumeMounts, c.getTlsVolumeMounts()...)
+}
+
+// GetContainerCommandArgs appends the credentials read from the mounted files to the hive-site.xml
+// copied into the container. The file is local to the container, so the credentials are neither
+// written to the ConfigMap nor exposed in the env or the arguments of any process.
+func (c *DatabaseConfig) GetContainerCommandArgs() string {
+	if c.IsEmbedded() {
+		return ""
+	}
+
+	hiveSite := path.Join(constants.KubedoopConfigDir, "hive-site.xml")
+	usernameKey, passwordKey := c.getCredentialsKeys()
+	args := `
+xml_escape() {
+    sed -e 's/&/\&amp;/g' -e 's/</\&lt;/g' -e 's/>/\&gt;/g' -e 's/"/\&quot;/g' -e "s/'/\&apos;/g"
+}
+sed -i '/<\/configuration>/d' ` + hiveSite + `
+{
+    echo "<property><name>javax.jdo.option.ConnectionUserName</name><value>$(xml_escape < ` + path.Join(DatabaseCredentialsDir, usernameKey) + `)</value></property>"
+    echo "<property><name>javax.jdo.option.ConnectionPassword</name><value>$(xml_escape < ` + path.Join(DatabaseCredentialsDir, passwordKey) + `)</value></property>"
+    echo "</configuration>"
+} >> ` + hiveSite + `
+`
+	return util.IndentTab4Spaces(args) + c.getTlsContainerCommandArgs()
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	waitForDatabaseContainerName = "wait-for-database"
+
+	defaultDatabaseWaitTimeout = 5 * time.Minute
+	// databaseDialTimeout bounds a single connection attempt, of the init container and of the controller.
+	databaseDialTimeout = 3 * time.Second
+)
+
+// GetAddress returns the host and port of the database server, from the structured fields
+// or parsed from the connString.
+func (c *DatabaseConfig) GetAddress() (string, int32, error) {
+	if c.Spec.ConnString == "" {
+		port := c.Spec.Port
+		if port == 0 {
+			port = c.Driver.DefaultPort
+		}
+		return c.Spec.Host, port, nil
+	}
+	return parseJdbcAddress(c.Spec.ConnString, c.Driver.DefaultPort)
+}
+
+// parseJdbcAddress extracts the first host and port of a JDBC URL, e.g.
+// jdbc:postgresql://host:port/db, jdbc:sqlserver://host:port;k=v or jdbc:oracle:thin:@host:port:sid.
+func parseJdbcAddress(connString string, defaultPort int32) (string, int32, error) {
+	rest := strings.TrimPrefix(connString, "jdbc:")
+	if i := strings.Index(rest, "@"); strings.HasPrefix(rest, "oracle:") && i >= 0 {
+		rest = rest[i+1:]
+		if j := strings.Index(rest, "://"); j >= 0 {
+			rest = rest[j+3:]
+		}
+		rest = strings.TrimPrefix(rest, "//")
+	} else {
+		i := strings.Index(rest, "//")
+		if i < 0 {
+			return "", 0, fmt.Errorf("cannot find the database address in connString %q", connString)
+		}
+		rest = rest[i+2:]
+	}
+
+	authority := rest
+	if end := strings.IndexAny(authority, "/?;"); end >= 0 {
+		authority = authority[:end]
+	}
+	authority = authority[strings.LastIndex(authority, "@")+1:]
+	// Only the first host of a multi-host URL is checked.
+	authority, _, _ = strings.Cut(authority, ",")
+
+	host, portStr, hasPort := strings.Cut(authority, ":")
+	if host == "" {
+		return "", 0, fmt.Errorf("cannot find the database host in connString %q", connString)
+	}
+	port := defaultPort
+	if hasPort {
+		// The oracle SID follows the port, e.g. host:port:sid.
+		portStr, _, _ = strings.Cut(portStr, ":")
+		p, err := strconv.ParseInt(portStr, 10, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid database port %q in connString: %w", portStr, err)
+		}
+		port = int32(p)
+	}
+	return host, port, nil
+}
+
+func (c *DatabaseConfig) getWaitTimeout() time.Duration {
+	if c.Spec.WaitTimeout != nil {
+		return c.Spec.WaitTimeout.Duration
+	}
+	return defaultDatabaseWaitTimeout
+}
+
+// GetWaitInitContainer returns the init container waiting until the database accepts TCP connections,
+// so an unreachable database fails the pod with a clear message instead of a crash loop of the product.
+// It returns nil for the embedded database or an address which cannot be parsed.
+func (c *DatabaseConfig) GetWaitInitContainer(image *util.Image) *corev1.Container {
+	if c.IsEmbedded() {
+		return nil
+	}
+	host, port, err := c.GetAddress()
+	if err != nil {
+		return nil
+	}
+
+	// The address is passed through the env, so it is never interpreted by the shell.
+	timeout := strconv.Itoa(int(c.getWaitTimeout().Seconds()))
+	args := `
+deadline=$((SECONDS + ` + timeout + `))
+until timeout ` + strconv.Itoa(int(databaseDialTimeout.Seconds())) + ` bash -c '</dev/tcp/$0/$1' "$DB_HOST" "$DB_PORT" 2>/dev/null; do
+    if [ "$SECONDS" -ge "$deadline" ]; then
+        echo "database $DB_HOST:$DB_PORT is not reachable after ` + timeout + `s" | tee /dev/termination-log >&2
+        exit 1
+    fi
+    echo "waiting for database $DB_HOST:$DB_PORT"
+    sleep 2
+done
+`
+
+	container := builder.NewContainer(waitForDatabaseContainerName, image)
+	container.SetCommand([]string{"bash", "-euo", "pipefail", "-c"}).
+		SetArgs([]string{args}).
+		AddEnvVars([]corev1.EnvVar{
+			{Name: "DB_HOST", Value: host},
+			{Name: "DB_PORT", Value: strconv.Itoa(int(port))},
+		})
+	return container.Build()
+}
+
+// CheckReachable opens a TCP connection to the database from the operator.
+func (c *DatabaseConfig) CheckReachable(ctx context.Context) error {
+	host, port, err := c.GetAddress()
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	dialer := net.Dialer{Timeout: databaseDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("%s database %s unreachable: %w", c.Spec.DatabaseType, address, err)
+	}
+	return conn.Close()
+}
+
+// DatabaseProbes records when the controller last probed the database of each cluster, so the
+// reconciliations triggered by the events of the owned resources do not all dial the database.
+// The zero value is ready to use.
+type DatabaseProbes struct {
+	mu   sync.Mutex
+	last map[types.NamespacedName]time.Time
+}
+
+// IsFresh reports whether the database of the cluster was probed less than interval ago.
+func (p *DatabaseProbes) IsFresh(key types.NamespacedName, now time.Time, interval time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	last, ok := p.last[key]
+	return ok && now.Sub(last) < interval
+}
+
+// Record records a probe of the database of the cluster.
+func (p *DatabaseProbes) Record(key types.NamespacedName, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil {
+		p.last = map[types.NamespacedName]time.Time{}
+	}
+	p.last[key] = now
+}
+
+// Forget drops the probes of a deleted cluster.
+func (p *DatabaseProbes) Forget(key types.NamespacedName) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.last, key)
+}
@@ -0,0 +1,43 @@
+package controller
+
+import "testing"
+
+func TestParseJdbcAddress(t *testing.T) {
+	tests := []struct {
+		name         string
+		connString   string
+		defaultPort  int32
+		expectedHost string
+		expectedPort int32
+		invalid      bool
+	}{
+		{name: "postgres", connString: "jdbc:postgresql://postgres:5433/hive?sslmode=require", defaultPort: 5432, expectedHost: "postgres", expectedPort: 5433},
+		{name: "default port", connString: "jdbc:mysql://mysql/hive", defaultPort: 3306, expectedHost: "mysql", expectedPort: 3306},
+		{name: "multiple hosts", connString: "jdbc:postgresql://pg1:5432,pg2:5432/hive", defaultPort: 5432, expectedHost: "pg1", expectedPort: 5432},
+		{name: "user info", connString: "jdbc:mariadb://hive@mariadb:3307/hive", defaultPort: 3306, expectedHost: "mariadb", expectedPort: 3307},
+		{name: "mssql", connString: "jdbc:sqlserver://mssql:1434;databaseName=hive", defaultPort: 1433, expectedHost: "mssql", expectedPort: 1434},
+		{name: "oracle sid", connString: "jdbc:oracle:thin:@oracle:1522:XE", defaultPort: 1521, expectedHost: "oracle", expectedPort: 1522},
+		{name: "oracle service", connString: "jdbc:oracle:thin:@//oracle:1521/XEPDB1", defaultPort: 1521, expectedHost: "oracle", expectedPort: 1521},
+		{name: "oracle tcps", connString: "jdbc:oracle:thin:@tcps://oracle:2484/XEPDB1", defaultPort: 1521, expectedHost: "oracle", expectedPort: 2484},
+		{name: "without address", connString: "jdbc:derby:metastore_db", invalid: true},
+		{name: "without host", connString: "jdbc:postgresql:///hive", invalid: true},
+		{name: "invalid port", connString: "jdbc:postgresql://postgres:port/hive", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, err := parseJdbcAddress(tt.connString, tt.defaultPort)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("parseJdbcAddress() = %s:%d, expected an error", host, port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJdbcAddress() error = %v", err)
+			}
+			if host != tt.expectedHost || port != tt.expectedPort {
+				t.Errorf("parseJdbcAddress() = %s:%d, expected %s:%d", host, port, tt.expectedHost, tt.expectedPort)
+			}
+		})
+	}
+}
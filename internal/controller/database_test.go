@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"testing"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func TestNewDatabaseConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		database *hivev1alpha1.DatabaseSpec
+		expected string
+		invalid  bool
+	}{
+		{
+			name:     "derby",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby},
+			expected: "jdbc:derby:" + DefaultDerbyDatabaseName + ";create=true",
+		},
+		{
+			name:     "derby databaseName",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby, DatabaseName: "/tmp/metastore_db"},
+			expected: "jdbc:derby:/tmp/metastore_db;create=true",
+		},
+		{
+			name: "mysql",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeMysql, Host: "mysql", DatabaseName: "hive", SSLMode: "verify-full",
+				CredentialsSecret: "hive-credentials",
+			},
+			expected: "jdbc:mysql://mysql:3306/hive?sslMode=VERIFY_IDENTITY",
+		},
+		{
+			name: "mariadb",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeMariadb, Host: "mariadb", Port: 3307, DatabaseName: "hive", SSLMode: "require",
+				CredentialsSecret: "hive-credentials",
+			},
+			expected: "jdbc:mariadb://mariadb:3307/hive?sslMode=trust",
+		},
+		{
+			name: "postgres",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypePostgres, Host: "postgres", DatabaseName: "hive",
+				Parameters:        map[string]string{"currentSchema": "hive", "sslmode": "prefer"},
+				SSLMode:           "require",
+				CredentialsSecret: "hive-credentials",
+			},
+			expected: "jdbc:postgresql://postgres:5432/hive?currentSchema=hive&sslmode=prefer",
+		},
+		{
+			name: "oracle",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeOracle, Host: "oracle", DatabaseName: "XEPDB1", CredentialsSecret: "hive-credentials",
+			},
+			expected: "jdbc:oracle:thin:@//oracle:1521/XEPDB1",
+		},
+		{
+			name: "oracle tcps",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeOracle, Host: "oracle", DatabaseName: "XEPDB1", SSLMode: "require",
+				CredentialsSecret: "hive-credentials",
+			},
+			expected: "jdbc:oracle:thin:@tcps://oracle:1521/XEPDB1",
+		},
+		{
+			name: "mssql",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeMssql, Host: "mssql", DatabaseName: "hive", SSLMode: "disable",
+				CredentialsSecret: "hive-credentials",
+			},
+			expected: "jdbc:sqlserver://mssql:1433;databaseName=hive;encrypt=false",
+		},
+		{
+			name: "connString",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypePostgres, ConnString: "jdbc:postgresql://pg1:5432,pg2:5432/hive", Host: "ignored",
+				Credentials: &hivev1alpha1.DatabaseCredentialsSpec{},
+			},
+			expected: "jdbc:postgresql://pg1:5432,pg2:5432/hive",
+		},
+		{
+			name:     "unknown type",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: "sqlite", ConnString: "jdbc:sqlite:hive.db"},
+			invalid:  true,
+		},
+		{
+			name:     "without host",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, DatabaseName: "hive", CredentialsSecret: "hive-credentials"},
+			invalid:  true,
+		},
+		{
+			name:     "without databaseName",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, Host: "postgres", CredentialsSecret: "hive-credentials"},
+			invalid:  true,
+		},
+		{
+			name:     "without credentials",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, Host: "postgres", DatabaseName: "hive"},
+			invalid:  true,
+		},
+		{
+			name: "credentialsSecret and credentials",
+			database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypePostgres, Host: "postgres", DatabaseName: "hive",
+				CredentialsSecret: "hive-credentials", Credentials: &hivev1alpha1.DatabaseCredentialsSpec{},
+			},
+			invalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewDatabaseConfig(tt.database)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("NewDatabaseConfig() = %s, expected an error", config.URL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewDatabaseConfig() error = %v", err)
+			}
+			if config.URL != tt.expected {
+				t.Errorf("NewDatabaseConfig() URL = %s, expected %s", config.URL, tt.expected)
+			}
+		})
+	}
+}
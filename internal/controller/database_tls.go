@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	databaseTlsVolumeName        = "database-tls-ca"
+	databaseTruststoreVolumeName = "database-truststore"
+
+	// databaseTruststorePassword protects the generated truststore, which only holds public certificates.
+	databaseTruststorePassword = "changeit"
+
+	defaultDatabaseTlsSSLMode = "verify-full"
+)
+
+var (
+	DatabaseTlsDir         = path.Join(constants.KubedoopSecretDir, databaseTlsVolumeName)
+	DatabaseTruststoreFile = path.Join(constants.KubedoopRoot, databaseTruststoreVolumeName, "truststore.p12")
+)
+
+// validateDatabaseTls checks that the CA has exactly one source and the database supports TLS.
+func validateDatabaseTls(database *hivev1alpha1.DatabaseSpec) error {
+	tls := database.Tls
+	if tls == nil {
+		return nil
+	}
+	if database.DatabaseType == DatabaseTypeDerby {
+		return fmt.Errorf("database tls is not supported by the embedded derby database")
+	}
+	if (tls.SecretClass == "") == (tls.Secret == "") {
+		return fmt.Errorf("database tls must set exactly one of secretClass and secret")
+	}
+	if database.SSLMode == "disable" {
+		return fmt.Errorf("database tls cannot be used with sslMode disable")
+	}
+	return nil
+}
+
+// getSSLMode returns the SSL mode of the database, the server is fully verified by default when a CA is given.
+func getSSLMode(database *hivev1alpha1.DatabaseSpec) string {
+	if database.SSLMode == "" && database.Tls != nil {
+		return defaultDatabaseTlsSSLMode
+	}
+	return database.SSLMode
+}
+
+// usesDatabaseTruststore reports whether the driver reads the CA from a Java truststore,
+// postgres and mariadb read the PEM file directly.
+func usesDatabaseTruststore(databaseType string) bool {
+	switch databaseType {
+	case DatabaseTypeMysql, DatabaseTypeOracle, DatabaseTypeMssql:
+		return true
+	}
+	return false
+}
+
+// setTlsParams adds the driver specific parameters pointing to the mounted CA.
+func setTlsParams(params map[string]string, database *hivev1alpha1.DatabaseSpec) {
+	if database.Tls == nil {
+		return
+	}
+
+	caFile := path.Join(DatabaseTlsDir, tlsCACertKey)
+	switch database.DatabaseType {
+	case DatabaseTypeMysql:
+		setDefault(params, "trustCertificateKeyStoreUrl", "file:"+DatabaseTruststoreFile)
+		setDefault(params, "trustCertificateKeyStoreType", "PKCS12")
+		setDefault(params, "trustCertificateKeyStorePassword", databaseTruststorePassword)
+	case DatabaseTypeMariadb:
+		setDefault(params, "serverSslCert", caFile)
+	case DatabaseTypePostgres:
+		setDefault(params, "sslrootcert", caFile)
+	case DatabaseTypeOracle:
+		setDefault(params, "javax.net.ssl.trustStore", DatabaseTruststoreFile)
+		setDefault(params, "javax.net.ssl.trustStoreType", "PKCS12")
+		setDefault(params, "javax.net.ssl.trustStorePassword", databaseTruststorePassword)
+		if getSSLMode(database) == "verify-full" {
+			setDefault(params, "oracle.net.ssl_server_dn_match", "true")
+		}
+	case DatabaseTypeMssql:
+		setDefault(params, "trustStore", DatabaseTruststoreFile)
+		setDefault(params, "trustStoreType", "PKCS12")
+		setDefault(params, "trustStorePassword", databaseTruststorePassword)
+	}
+}
+
+func (c *DatabaseConfig) getTlsVolumes() []corev1.Volume {
+	tls := c.Spec.Tls
+	if tls == nil {
+		return nil
+	}
+
+	caVolume := newCAVolume(databaseTlsVolumeName, tls.SecretClass)
+	if tls.Secret != "" {
+		caVolume = corev1.Volume{
+			Name: databaseTlsVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: tls.Secret,
+					Items:      []corev1.KeyToPath{{Key: tlsCACertKey, Path: tlsCACertKey}},
+				},
+			},
+		}
+	}
+
+	volumes := []corev1.Volume{caVolume}
+	if usesDatabaseTruststore(c.Spec.DatabaseType) {
+		volumes = append(volumes, corev1.Volume{
+			Name: databaseTruststoreVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					SizeLimit: ptr.To(resource.MustParse("5Mi")),
+				},
+			},
+		})
+	}
+	return volumes
+}
+
+func (c *DatabaseConfig) getTlsVolumeMounts() []corev1.VolumeMount {
+	if c.Spec.Tls == nil {
+		return nil
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      databaseTlsVolumeName,
+			MountPath: DatabaseTlsDir,
+			ReadOnly:  true,
+		},
+	}
+	if usesDatabaseTruststore(c.Spec.DatabaseType) {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      databaseTruststoreVolumeName,
+			MountPath: path.Dir(DatabaseTruststoreFile),
+		})
+	}
+	return volumeMounts
+}
+
+// getTlsContainerCommandArgs builds the truststore holding only the database CA.
+func (c *DatabaseConfig) getTlsContainerCommandArgs() string {
+	if c.Spec.Tls == nil || !usesDatabaseTruststore(c.Spec.DatabaseType) {
+		return ""
+	}
+
+	// The emptyDir survives container restarts, keytool refuses to import the alias twice.
+	args := `
+rm -f ` + DatabaseTruststoreFile + `
+keytool -importcert -noprompt -alias database-ca -file ` + path.Join(DatabaseTlsDir, tlsCACertKey) + ` \
+    -keystore ` + DatabaseTruststoreFile + ` -storetype pkcs12 -storepass ` + databaseTruststorePassword + `
+`
+	return util.IndentTab4Spaces(args)
+}
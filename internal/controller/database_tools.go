@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	// databaseClientConfigFile is the mysql option file written by getDatabaseClientSetup.
+	databaseClientConfigFile = "client.cnf"
+)
+
+var (
+	// defaultDatabaseToolImages are the upstream images providing the dump and restore tools of each
+	// database type. The embedded derby database is archived with the product image.
+	defaultDatabaseToolImages = map[string]string{
+		DatabaseTypePostgres: "docker.io/library/postgres:17",
+		DatabaseTypeMysql:    "docker.io/library/mysql:8.4",
+		DatabaseTypeMariadb:  "docker.io/library/mariadb:11.4",
+	}
+
+	// databaseDumpFileExtensions are the extensions of the dump of each database type.
+	databaseDumpFileExtensions = map[string]string{
+		DatabaseTypeDerby:    "tar.gz",
+		DatabaseTypePostgres: "pgdump",
+		DatabaseTypeMysql:    "sql.gz",
+		DatabaseTypeMariadb:  "sql.gz",
+	}
+
+	// mysqlSSLModes maps the SSL modes of the database spec to the ssl-mode option of the mysql client.
+	mysqlSSLModes = map[string]string{
+		"disable":     "DISABLED",
+		"require":     "REQUIRED",
+		"verify-ca":   "VERIFY_CA",
+		"verify-full": "VERIFY_IDENTITY",
+	}
+)
+
+// validateDatabaseTools checks that the database can be dumped and restored by the operator,
+// operation names the feature in the error, e.g. backup.
+func validateDatabaseTools(database *hivev1alpha1.DatabaseSpec, operation string) error {
+	if _, ok := databaseDumpFileExtensions[database.DatabaseType]; !ok {
+		return fmt.Errorf("%s does not support database type %s, supported types are %s",
+			operation, database.DatabaseType, slices.Sorted(maps.Keys(databaseDumpFileExtensions)))
+	}
+	if database.DatabaseType == DatabaseTypeDerby {
+		if database.ConnString != "" {
+			return fmt.Errorf("%s of the derby database requires databaseName instead of connString", operation)
+		}
+		if database.DatabaseName != "" && path.Dir(path.Clean(database.DatabaseName)) != path.Clean(constants.KubedoopDataDir) {
+			return fmt.Errorf("%s of the derby database requires a databaseName in %s", operation, constants.KubedoopDataDir)
+		}
+	} else if _, err := getDatabaseName(database); err != nil {
+		return fmt.Errorf("%s requires the name of the %s database: %w", operation, database.DatabaseType, err)
+	}
+	return nil
+}
+
+// getDatabaseToolImage returns the image providing the client tools of the database, the custom
+// image if set, and the product image for the embedded derby database. The product repository does
+// not publish the database images, so the default tool images are pulled from Docker Hub.
+func getDatabaseToolImage(database *hivev1alpha1.DatabaseSpec, custom string, productImage *util.Image) (string, corev1.PullPolicy) {
+	if database.DatabaseType == DatabaseTypeDerby {
+		return productImage.String(), productImage.GetPullPolicy()
+	}
+	if custom != "" {
+		return custom, productImage.GetPullPolicy()
+	}
+	return defaultDatabaseToolImages[database.DatabaseType], productImage.GetPullPolicy()
+}
+
+// getDatabaseName returns the databaseName of the spec, or the database of the path of the connString,
+// e.g. hive of jdbc:postgresql://host:5432/hive?sslmode=require.
+func getDatabaseName(database *hivev1alpha1.DatabaseSpec) (string, error) {
+	if database.ConnString == "" {
+		if database.DatabaseName == "" {
+			return "", fmt.Errorf("databaseName is not set")
+		}
+		return database.DatabaseName, nil
+	}
+
+	rest := strings.TrimPrefix(database.ConnString, "jdbc:")
+	i := strings.Index(rest, "//")
+	if i < 0 {
+		return "", fmt.Errorf("cannot find the database in connString %q", database.ConnString)
+	}
+	rest = rest[i+2:]
+	if end := strings.IndexAny(rest, "?;"); end >= 0 {
+		rest = rest[:end]
+	}
+	_, name, _ := strings.Cut(rest, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("cannot find the database in connString %q", database.ConnString)
+	}
+	return name, nil
+}
+
+// getDerbyDatabaseName returns the path of the embedded derby database.
+func getDerbyDatabaseName(database *hivev1alpha1.DatabaseSpec) string {
+	if database.DatabaseName != "" {
+		return database.DatabaseName
+	}
+	return DefaultDerbyDatabaseName
+}
+
+// getDerbyClaim returns the rolegroup and the PVC holding the embedded derby database, derby is limited
+// to a single metastore replica, so it is the PVC of the first pod of the only rolegroup with replicas.
+func getDerbyClaim(clusterName string, metastore *hivev1alpha1.RoleSpec) (string, string, error) {
+	if metastore != nil {
+		for _, name := range slices.Sorted(maps.Keys(metastore.RoleGroups)) {
+			if roleGroup := metastore.RoleGroups[name]; roleGroup != nil && roleGroup.Replicas > 0 {
+				statefulSetName := clusterName + "-" + MetastoreRoleName + "-" + name
+				return name, derbyDataVolumeName + "-" + statefulSetName + "-0", nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("the derby database requires a metastore replica")
+}
+
+// getDatabaseClientSetup returns the env and the script configuring the client tools of postgres, mysql
+// and mariadb. The credentials are written to a client config file in workDir, so they do not show up in
+// the arguments of the tools. The name of the database is passed as DB_NAME.
+func getDatabaseClientSetup(dbConfig *DatabaseConfig, workDir string) ([]corev1.EnvVar, string, error) {
+	database := dbConfig.Spec
+	host, port, err := dbConfig.GetAddress()
+	if err != nil {
+		return nil, "", err
+	}
+	databaseName, err := getDatabaseName(database)
+	if err != nil {
+		return nil, "", err
+	}
+
+	usernameKey, passwordKey := dbConfig.getCredentialsKeys()
+	usernameFile := path.Join(DatabaseCredentialsDir, usernameKey)
+	passwordFile := path.Join(DatabaseCredentialsDir, passwordKey)
+	caFile := path.Join(DatabaseTlsDir, tlsCACertKey)
+	sslMode := getSSLMode(database)
+
+	env := []corev1.EnvVar{
+		{Name: "DB_HOST", Value: host},
+		{Name: "DB_PORT", Value: strconv.Itoa(int(port))},
+		{Name: "DB_NAME", Value: databaseName},
+	}
+
+	switch database.DatabaseType {
+	case DatabaseTypePostgres:
+		passFile := path.Join(workDir, ".pgpass")
+		env = append(env,
+			corev1.EnvVar{Name: "PGHOST", Value: host},
+			corev1.EnvVar{Name: "PGPORT", Value: strconv.Itoa(int(port))},
+			corev1.EnvVar{Name: "PGDATABASE", Value: databaseName},
+			corev1.EnvVar{Name: "PGPASSFILE", Value: passFile},
+		)
+		if sslMode != "" {
+			env = append(env, corev1.EnvVar{Name: "PGSSLMODE", Value: sslMode})
+		}
+		if database.Tls != nil {
+			env = append(env, corev1.EnvVar{Name: "PGSSLROOTCERT", Value: caFile})
+		}
+		return env, `
+umask 077
+export PGUSER="$(cat ` + usernameFile + `)"
+printf '*:*:*:%s:%s\n' "$(sed -e 's/[\\:]/\\&/g' ` + usernameFile + `)" "$(sed -e 's/[\\:]/\\&/g' ` + passwordFile + `)" > ` + passFile + `
+`, nil
+	case DatabaseTypeMysql, DatabaseTypeMariadb:
+		sslOptions := ""
+		if database.Tls != nil {
+			sslOptions += `
+    echo "ssl-ca=` + caFile + `"`
+		}
+		if database.DatabaseType == DatabaseTypeMysql && sslMode != "" {
+			sslOptions += `
+    echo "ssl-mode=` + mysqlSSLModes[sslMode] + `"`
+		}
+		if database.DatabaseType == DatabaseTypeMariadb && (sslMode == "verify-ca" || sslMode == "verify-full") {
+			sslOptions += `
+    echo "ssl-verify-server-cert"`
+		}
+		return env, `
+umask 077
+cnf_escape() {
+    sed -e 's/[\\"]/\\&/g'
+}
+{
+    echo "[client]"
+    echo "host=$DB_HOST"
+    echo "port=$DB_PORT"
+    echo "user=\"$(cnf_escape < ` + usernameFile + `)\""
+    echo "password=\"$(cnf_escape < ` + passwordFile + `)\""` + sslOptions + `
+} > ` + path.Join(workDir, databaseClientConfigFile) + `
+`, nil
+	}
+	return nil, "", fmt.Errorf("database type %s has no client tools", database.DatabaseType)
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func TestGetDatabaseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		database *hivev1alpha1.DatabaseSpec
+		expected string
+		invalid  bool
+	}{
+		{name: "databaseName", database: &hivev1alpha1.DatabaseSpec{DatabaseName: "hive"}, expected: "hive"},
+		{name: "postgres", database: &hivev1alpha1.DatabaseSpec{ConnString: "jdbc:postgresql://postgres:5432/hive?sslmode=require"}, expected: "hive"},
+		{name: "mysql", database: &hivev1alpha1.DatabaseSpec{ConnString: "jdbc:mysql://mysql/metastore"}, expected: "metastore"},
+		{name: "connString takes precedence", database: &hivev1alpha1.DatabaseSpec{ConnString: "jdbc:mariadb://mariadb:3306/hive", DatabaseName: "other"}, expected: "hive"},
+		{name: "without databaseName", database: &hivev1alpha1.DatabaseSpec{}, invalid: true},
+		{name: "connString without database", database: &hivev1alpha1.DatabaseSpec{ConnString: "jdbc:postgresql://postgres:5432/"}, invalid: true},
+		{name: "connString without path", database: &hivev1alpha1.DatabaseSpec{ConnString: "jdbc:postgresql://postgres:5432"}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getDatabaseName(tt.database)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("getDatabaseName() = %s, expected an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("getDatabaseName() = %s, %v, expected %s", got, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateDatabaseToolsConnString(t *testing.T) {
+	database := &hivev1alpha1.DatabaseSpec{
+		DatabaseType:      DatabaseTypePostgres,
+		ConnString:        "jdbc:postgresql://postgres:5432/hive",
+		CredentialsSecret: "hive-credentials",
+	}
+	if err := validateDatabaseTools(database, "backup"); err != nil {
+		t.Errorf("validateDatabaseTools() = %v, expected no error", err)
+	}
+}
+
+func TestGetDatabaseToolImage(t *testing.T) {
+	postgres := &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres}
+	tests := []struct {
+		name               string
+		database           *hivev1alpha1.DatabaseSpec
+		custom             string
+		productImage       *util.Image
+		expected           string
+		expectedPullPolicy corev1.PullPolicy
+	}{
+		{
+			name:               "default",
+			database:           postgres,
+			productImage:       util.NewImage("hive", "0.0.0-dev", "4.0.1"),
+			expected:           "docker.io/library/postgres:17",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:     "pull policy of the product image",
+			database: postgres,
+			productImage: util.NewImage("hive", "0.0.0-dev", "4.0.1", func(o *util.ImageOptions) {
+				o.Repo = "registry.local:5000/kubedoop"
+				o.PullPolicy = corev1.PullAlways
+			}),
+			expected:           "docker.io/library/postgres:17",
+			expectedPullPolicy: corev1.PullAlways,
+		},
+		{
+			name:     "custom product image",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeMysql},
+			productImage: util.NewImage("hive", "0.0.0-dev", "4.0.1", func(o *util.ImageOptions) {
+				o.Custom = "registry.local/mirror/hive:4.0.1"
+			}),
+			expected:           "docker.io/library/mysql:8.4",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:               "custom",
+			database:           postgres,
+			custom:             "registry.local/tools/pg:16",
+			productImage:       util.NewImage("hive", "0.0.0-dev", "4.0.1"),
+			expected:           "registry.local/tools/pg:16",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+		{
+			name:               "derby",
+			database:           &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby},
+			custom:             "registry.local/tools/pg:16",
+			productImage:       util.NewImage("hive", "0.0.0-dev", "4.0.1"),
+			expected:           "quay.io/zncdatadev/hive:4.0.1-kubedoop0.0.0-dev",
+			expectedPullPolicy: corev1.PullIfNotPresent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, pullPolicy := getDatabaseToolImage(tt.database, tt.custom, tt.productImage)
+			if image != tt.expected || pullPolicy != tt.expectedPullPolicy {
+				t.Errorf("getDatabaseToolImage() = %s, %s, expected %s, %s", image, pullPolicy, tt.expected, tt.expectedPullPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/util/version"
+)
+
+// unknownBuildVersion is the version of a binary built without the version ldflags.
+const unknownBuildVersion = "N/A"
+
+// getDefaultKubedoopVersion returns the kubedoop version of the product images released with this operator.
+func getDefaultKubedoopVersion() string {
+	return version.BuildVersion
+}
+
+// DefaultSpec fills the unset fields of the spec with the values the operator would use, so the stored
+// object shows what runs. The versions of the image are pinned on creation, an upgrade of the operator
+// does not change the Hive version of existing clusters. Setting a default twice does not change the spec.
+func DefaultSpec(spec *hivev1alpha1.HiveMetastoreSpec) {
+	spec.Image = defaultImage(spec.Image)
+
+	if spec.ClusterConfig != nil && spec.ClusterConfig.Database != nil {
+		defaultDatabase(spec.ClusterConfig.Database)
+	}
+
+	for _, role := range []*hivev1alpha1.RoleSpec{spec.Metastore, spec.HiveServer2} {
+		if role == nil {
+			continue
+		}
+		if role.Config == nil {
+			role.Config = &hivev1alpha1.ConfigSpec{}
+		}
+		if role.Config.WarehouseDir == "" {
+			role.Config.WarehouseDir = hivev1alpha1.DefaultWarehouseDir
+		}
+	}
+}
+
+func defaultImage(image *hivev1alpha1.ImageSpec) *hivev1alpha1.ImageSpec {
+	if image == nil {
+		image = &hivev1alpha1.ImageSpec{}
+	}
+	if image.Repo == "" {
+		image.Repo = hivev1alpha1.DefaultRepository
+	}
+	if image.PullPolicy == "" {
+		image.PullPolicy = corev1.PullIfNotPresent
+	}
+	if image.ProductVersion == "" {
+		image.ProductVersion = hivev1alpha1.DefaultProductVersion
+	}
+	// A development build has no kubedoop version to pin, the operator keeps resolving it.
+	if kubedoopVersion := getDefaultKubedoopVersion(); image.KubedoopVersion == "" && kubedoopVersion != unknownBuildVersion {
+		image.KubedoopVersion = kubedoopVersion
+	}
+	return image
+}
+
+// defaultDatabase fills the defaults of the database type, unknown types are left to the validation.
+func defaultDatabase(database *hivev1alpha1.DatabaseSpec) {
+	driver, err := GetDatabaseDriver(database.DatabaseType)
+	if err != nil {
+		return
+	}
+
+	if database.DatabaseType == DatabaseTypeDerby {
+		if database.ConnString == "" && database.DatabaseName == "" {
+			database.DatabaseName = DefaultDerbyDatabaseName
+		}
+		if database.Storage == nil {
+			database.Storage = &commonsv1alpha1.StorageResource{}
+		}
+		if database.Storage.Capacity.IsZero() {
+			database.Storage.Capacity = resource.MustParse(defaultDerbyCapacity)
+		}
+		return
+	}
+
+	// The structured fields are not used with a raw connString.
+	if database.ConnString == "" && database.Port == 0 {
+		database.Port = driver.DefaultPort
+	}
+	if database.SSLMode == "" && database.Tls != nil {
+		database.SSLMode = defaultDatabaseTlsSSLMode
+	}
+}
+
+// getImage returns the product image of the spec, unset versions fall back to the defaults of the operator.
+func getImage(spec *hivev1alpha1.ImageSpec) *util.Image {
+	if spec == nil {
+		spec = &hivev1alpha1.ImageSpec{}
+	}
+
+	productVersion := spec.ProductVersion
+	if productVersion == "" {
+		productVersion = hivev1alpha1.DefaultProductVersion
+	}
+	kubedoopVersion := spec.KubedoopVersion
+	if kubedoopVersion == "" {
+		kubedoopVersion = getDefaultKubedoopVersion()
+	}
+
+	return util.NewImage(
+		hivev1alpha1.DefaultProductName,
+		kubedoopVersion,
+		productVersion,
+		func(options *util.ImageOptions) {
+			options.Custom = spec.Custom
+			options.Repo = spec.Repo
+			options.PullPolicy = spec.PullPolicy
+		},
+	)
+}
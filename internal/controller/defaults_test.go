@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/util/version"
+)
+
+func setTestBuildVersion(t *testing.T, buildVersion string) {
+	t.Helper()
+	previous := version.BuildVersion
+	version.BuildVersion = buildVersion
+	t.Cleanup(func() { version.BuildVersion = previous })
+}
+
+func TestDefaultSpec(t *testing.T) {
+	setTestBuildVersion(t, "0.1.0")
+	spec := &hivev1alpha1.HiveMetastoreSpec{
+		ClusterConfig: &hivev1alpha1.ClusterConfigSpec{
+			Database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, Host: "postgres", DatabaseName: "hive"},
+		},
+		Metastore:   &hivev1alpha1.RoleSpec{},
+		HiveServer2: &hivev1alpha1.RoleSpec{Config: &hivev1alpha1.ConfigSpec{WarehouseDir: "/warehouse"}},
+	}
+
+	DefaultSpec(spec)
+
+	expectedImage := &hivev1alpha1.ImageSpec{
+		Repo:            hivev1alpha1.DefaultRepository,
+		PullPolicy:      corev1.PullIfNotPresent,
+		ProductVersion:  hivev1alpha1.DefaultProductVersion,
+		KubedoopVersion: "0.1.0",
+	}
+	if !equality.Semantic.DeepEqual(spec.Image, expectedImage) {
+		t.Errorf("image = %+v, expected %+v", spec.Image, expectedImage)
+	}
+	if port := spec.ClusterConfig.Database.Port; port != 5432 {
+		t.Errorf("database port = %d, expected 5432", port)
+	}
+	if dir := spec.Metastore.Config.WarehouseDir; dir != hivev1alpha1.DefaultWarehouseDir {
+		t.Errorf("metastore warehouseDir = %s, expected %s", dir, hivev1alpha1.DefaultWarehouseDir)
+	}
+	if dir := spec.HiveServer2.Config.WarehouseDir; dir != "/warehouse" {
+		t.Errorf("hiveserver2 warehouseDir = %s, expected /warehouse", dir)
+	}
+
+	defaulted := spec.DeepCopy()
+	DefaultSpec(defaulted)
+	if !equality.Semantic.DeepEqual(defaulted, spec) {
+		t.Errorf("DefaultSpec() changed a defaulted spec:\n%+v\nexpected\n%+v", defaulted, spec)
+	}
+}
+
+func TestDefaultSpecKeepsPinnedVersions(t *testing.T) {
+	setTestBuildVersion(t, "0.2.0")
+	spec := &hivev1alpha1.HiveMetastoreSpec{
+		Image: &hivev1alpha1.ImageSpec{ProductVersion: "3.1.3", KubedoopVersion: "0.1.0"},
+	}
+
+	DefaultSpec(spec)
+
+	if spec.Image.ProductVersion != "3.1.3" || spec.Image.KubedoopVersion != "0.1.0" {
+		t.Errorf("image versions = %s, %s, expected the pinned 3.1.3, 0.1.0", spec.Image.ProductVersion, spec.Image.KubedoopVersion)
+	}
+}
+
+func TestDefaultSpecDevelopmentBuild(t *testing.T) {
+	setTestBuildVersion(t, unknownBuildVersion)
+	spec := &hivev1alpha1.HiveMetastoreSpec{}
+
+	DefaultSpec(spec)
+
+	if spec.Image.KubedoopVersion != "" {
+		t.Errorf("kubedoop version = %s, expected it to be unset for a development build", spec.Image.KubedoopVersion)
+	}
+}
+
+func TestDefaultDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		database *hivev1alpha1.DatabaseSpec
+		expected *hivev1alpha1.DatabaseSpec
+	}{
+		{
+			name:     "derby",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby},
+			expected: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeDerby,
+				DatabaseName: DefaultDerbyDatabaseName,
+				Storage:      &commonsv1alpha1.StorageResource{Capacity: resource.MustParse(defaultDerbyCapacity)},
+			},
+		},
+		{
+			name:     "derby connString",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby, ConnString: "jdbc:derby:/data/db;create=true"},
+			expected: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeDerby,
+				ConnString:   "jdbc:derby:/data/db;create=true",
+				Storage:      &commonsv1alpha1.StorageResource{Capacity: resource.MustParse(defaultDerbyCapacity)},
+			},
+		},
+		{
+			name:     "mysql tls",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeMysql, Tls: &hivev1alpha1.DatabaseTlsSpec{Secret: "ca"}},
+			expected: &hivev1alpha1.DatabaseSpec{
+				DatabaseType: DatabaseTypeMysql,
+				Port:         3306,
+				SSLMode:      defaultDatabaseTlsSSLMode,
+				Tls:          &hivev1alpha1.DatabaseTlsSpec{Secret: "ca"},
+			},
+		},
+		{
+			name:     "postgres connString",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, ConnString: "jdbc:postgresql://postgres/hive"},
+			expected: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, ConnString: "jdbc:postgresql://postgres/hive"},
+		},
+		{
+			name:     "unknown type",
+			database: &hivev1alpha1.DatabaseSpec{DatabaseType: "sqlite"},
+			expected: &hivev1alpha1.DatabaseSpec{DatabaseType: "sqlite"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultDatabase(tt.database)
+			if !equality.Semantic.DeepEqual(tt.database, tt.expected) {
+				t.Errorf("defaultDatabase() = %+v, expected %+v", tt.database, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/config/xml"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+// Keys of the discovery ConfigMap.
+const (
+	DiscoveryMetastoreURIsKey     = "HIVE"
+	DiscoveryHiveSiteKey          = "hive-site.xml"
+	DiscoverySASLEnabledKey       = "HIVE_METASTORE_SASL_ENABLED"
+	DiscoveryKerberosPrincipalKey = "HIVE_METASTORE_KERBEROS_PRINCIPAL"
+	DiscoveryKerberosRealmKey     = "HIVE_METASTORE_KERBEROS_REALM"
+	DiscoveryKerberosServiceKey   = "HIVE_METASTORE_KERBEROS_SERVICE_NAME"
+	DiscoveryTlsSecretClassKey    = "HIVE_METASTORE_TLS_SECRET_CLASS"
+	DiscoveryTlsCACertKey         = tlsCACertKey
+)
+
+var _ builder.ConfigBuilder = &DiscoveryConfigMapBuilder{}
+
+// DiscoveryConfigMapBuilder builds the discovery ConfigMap of a cluster, named after the HiveMetastore.
+// Clients consume it to connect to the metastore instead of guessing the rolegroup service names.
+// With TLS, clients trust the published CA, or mount a volume of the published SecretClass.
+type DiscoveryConfigMapBuilder struct {
+	builder.ConfigMapBuilder
+
+	ClusterConfig *hivev1alpha1.ClusterConfigSpec
+
+	MetastoreURIs []string
+}
+
+func NewDiscoveryConfigMapBuilder(
+	client *client.Client,
+	name string,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	metastoreURIs []string,
+	options ...builder.Option,
+) *DiscoveryConfigMapBuilder {
+	return &DiscoveryConfigMapBuilder{
+		ConfigMapBuilder: *builder.NewConfigMapBuilder(
+			client,
+			name,
+			options...,
+		),
+		ClusterConfig: clusterConfig,
+		MetastoreURIs: metastoreURIs,
+	}
+}
+
+func (b *DiscoveryConfigMapBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
+	uris := strings.Join(b.MetastoreURIs, ",")
+	b.AddItem(DiscoveryMetastoreURIsKey, uris)
+
+	config := xml.NewXMLConfiguration()
+	config.AddPropertyWithString("hive.metastore.uris", uris, "")
+
+	if IsKerberosEnabled(b.ClusterConfig) {
+		if err := b.addKerberos(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+
+	if IsTlsEnabled(b.ClusterConfig) {
+		secretClass := b.ClusterConfig.Authentication.Tls.SecretClass
+		config.AddPropertyWithString("hive.metastore.use.SSL", "true", "")
+		b.AddItem(DiscoveryTlsSecretClassKey, secretClass)
+
+		ca, err := GetTlsCACert(ctx, b.Client, secretClass)
+		if err != nil {
+			return nil, err
+		}
+		if ca != "" {
+			b.AddItem(DiscoveryTlsCACertKey, ca)
+		}
+	}
+
+	s, err := config.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	b.AddItem(DiscoveryHiveSiteKey, s)
+
+	return b.GetObject(), nil
+}
+
+// addKerberos publishes the realm and the principals of the metastore, in the order of the URIs,
+// which are the principals clients request tickets for. hive-site.xml keeps `_HOST`, Hive replaces it
+// with the host of the URI the client connects to.
+func (b *DiscoveryConfigMapBuilder) addKerberos(ctx context.Context, config *xml.XMLConfiguration) error {
+	kerberos := b.ClusterConfig.Authentication.Kerberos
+	realm, err := GetKerberosRealm(ctx, b.Client, kerberos.SecretClass)
+	if err != nil {
+		return err
+	}
+	if realm == "" {
+		return fmt.Errorf("cannot resolve the kerberos realm of SecretClass %s", kerberos.SecretClass)
+	}
+
+	krb5Config := NewKerberosConfig(kerberos, b.Client.GetOwnerNamespace(), "", MetastoreRoleName)
+	krb5Config.Realm = realm
+
+	principals := make([]string, 0, len(b.MetastoreURIs))
+	for _, uri := range b.MetastoreURIs {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return err
+		}
+		principals = append(principals, krb5Config.GetPrincipal(krb5Config.MetastoreServiceName, u.Hostname()))
+	}
+
+	clientSite := krb5Config.GetClientHiveSite()
+	config.AddPropertiesWithMap(clientSite)
+	b.AddItem(DiscoverySASLEnabledKey, clientSite["hive.metastore.sasl.enabled"])
+	b.AddItem(DiscoveryKerberosRealmKey, realm)
+	b.AddItem(DiscoveryKerberosServiceKey, krb5Config.MetastoreServiceName)
+	b.AddItem(DiscoveryKerberosPrincipalKey, strings.Join(principals, ","))
+	return nil
+}
+
+func NewDiscoveryConfigMapReconciler(
+	client *client.Client,
+	clusterInfo reconciler.ClusterInfo,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	metastoreURIs []string,
+) *reconciler.GenericResourceReconciler[*DiscoveryConfigMapBuilder] {
+	b := NewDiscoveryConfigMapBuilder(
+		client,
+		clusterInfo.ClusterName,
+		clusterConfig,
+		metastoreURIs,
+		func(o *builder.Options) {
+			o.ClusterName = clusterInfo.ClusterName
+			o.Labels = clusterInfo.GetLabels()
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+
+	return reconciler.NewGenericResourceReconciler(
+		client,
+		b,
+	)
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+// newTestClient returns a client of a fake API server holding the objects, owned by a HiveMetastore `hive` in `ns`.
+func newTestClient(t *testing.T, objs ...ctrlclient.Object) *client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := hivev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := s3v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypeWithName(secretClassGVK, &unstructured.Unstructured{})
+
+	owner := &hivev1alpha1.HiveMetastore{ObjectMeta: metav1.ObjectMeta{Name: "hive", Namespace: "ns"}}
+	return client.NewClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(), owner)
+}
+
+func newTestKerberosSecretClass(name string, realm string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(secretClassGVK)
+	obj.SetName(name)
+	_ = unstructured.SetNestedField(obj.Object, realm, "spec", "backend", "kerberosKeytab", "realmName")
+	return obj
+}
+
+func TestDiscoveryConfigMapBuilderKerberos(t *testing.T) {
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Authentication: &hivev1alpha1.AuthenticationSpec{
+			Kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", MetastoreServiceName: "hive"},
+		},
+	}
+	uris := GetMetastoreURIs("ns", "hive", &hivev1alpha1.RoleSpec{
+		RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{"default": {}, "extra": {}},
+	})
+
+	b := NewDiscoveryConfigMapBuilder(newTestClient(t, newTestKerberosSecretClass("kerberos", "EXAMPLE.COM")), "hive", clusterConfig, uris)
+	obj, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := obj.(*corev1.ConfigMap).Data
+
+	expected := map[string]string{
+		DiscoveryMetastoreURIsKey:   "thrift://hive-metastore-default.ns.svc.cluster.local:9083,thrift://hive-metastore-extra.ns.svc.cluster.local:9083",
+		DiscoverySASLEnabledKey:     "true",
+		DiscoveryKerberosRealmKey:   "EXAMPLE.COM",
+		DiscoveryKerberosServiceKey: "hive",
+		DiscoveryKerberosPrincipalKey: "hive/hive-metastore-default.ns.svc.cluster.local@EXAMPLE.COM," +
+			"hive/hive-metastore-extra.ns.svc.cluster.local@EXAMPLE.COM",
+	}
+	for key, value := range expected {
+		if data[key] != value {
+			t.Errorf("%s = %q, expected %q", key, data[key], value)
+		}
+	}
+	if !strings.Contains(data[DiscoveryHiveSiteKey], "hive/_HOST@EXAMPLE.COM") {
+		t.Errorf("hive-site.xml does not contain the client principal:\n%s", data[DiscoveryHiveSiteKey])
+	}
+	if strings.Contains(data[DiscoveryHiveSiteKey], kerberosRealmPlaceholder) {
+		t.Errorf("hive-site.xml contains the realm placeholder:\n%s", data[DiscoveryHiveSiteKey])
+	}
+}
+
+func TestDiscoveryConfigMapBuilderKerberosUnknownRealm(t *testing.T) {
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Authentication: &hivev1alpha1.AuthenticationSpec{
+			Kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos"},
+		},
+	}
+
+	b := NewDiscoveryConfigMapBuilder(newTestClient(t), "hive", clusterConfig, nil)
+	if _, err := b.Build(context.Background()); err == nil {
+		t.Error("Build() succeeded without the kerberos SecretClass")
+	}
+}
+
+func TestDiscoveryConfigMapBuilderTls(t *testing.T) {
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Authentication: &hivev1alpha1.AuthenticationSpec{
+			Tls: &hivev1alpha1.TlsSpec{SecretClass: "tls"},
+		},
+	}
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls-ca", Namespace: "kubedoop-operators"},
+		Data:       map[string][]byte{tlsCACertKey: []byte("-----BEGIN CERTIFICATE-----")},
+	}
+	c := newTestClient(t, newTestAutoTlsSecretClass("tls", caSecret.Namespace, caSecret.Name), caSecret)
+
+	b := NewDiscoveryConfigMapBuilder(c, "hive", clusterConfig, []string{"thrift://hive-metastore-default.ns.svc.cluster.local:9083"})
+	obj, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := obj.(*corev1.ConfigMap).Data
+
+	if data[DiscoveryTlsSecretClassKey] != "tls" {
+		t.Errorf("%s = %q, expected tls", DiscoveryTlsSecretClassKey, data[DiscoveryTlsSecretClassKey])
+	}
+	if data[DiscoveryTlsCACertKey] != "-----BEGIN CERTIFICATE-----" {
+		t.Errorf("%s = %q, expected the CA of the SecretClass", DiscoveryTlsCACertKey, data[DiscoveryTlsCACertKey])
+	}
+	if !strings.Contains(data[DiscoveryHiveSiteKey], "hive.metastore.use.SSL") {
+		t.Errorf("hive-site.xml does not enable SSL:\n%s", data[DiscoveryHiveSiteKey])
+	}
+}
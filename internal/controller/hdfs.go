@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/config/xml"
+	corev1 "k8s.io/api/core/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	CoreSiteFileName = "core-site.xml"
+	HdfsSiteFileName = "hdfs-site.xml"
+)
+
+// HDFSConfig holds the client configuration read from the HDFS discovery ConfigMap.
+type HDFSConfig struct {
+	CoreSite *xml.XMLConfiguration
+	HdfsSite *xml.XMLConfiguration
+}
+
+// GetHDFSConfig reads the core-site.xml and hdfs-site.xml of the HDFS discovery ConfigMap.
+func GetHDFSConfig(ctx context.Context, client *client.Client, hdfs *hivev1alpha1.HDFSSpec) (*HDFSConfig, error) {
+	cm := &corev1.ConfigMap{}
+	if err := client.GetWithOwnerNamespace(ctx, hdfs.ConfigMap, cm); err != nil {
+		return nil, err
+	}
+
+	coreSite, err := parseHDFSConfigFile(cm, CoreSiteFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	hdfsSite, err := parseHDFSConfigFile(cm, HdfsSiteFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HDFSConfig{
+		CoreSite: coreSite,
+		HdfsSite: hdfsSite,
+	}, nil
+}
+
+func parseHDFSConfigFile(cm *corev1.ConfigMap, key string) (*xml.XMLConfiguration, error) {
+	data, ok := cm.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("HDFS discovery configmap %s does not contain %s", cm.Name, key)
+	}
+	return xml.NewXMLConfigurationFromString(data)
+}
@@ -1,21 +1,34 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
 
+	"github.com/zncdatadev/operator-go/pkg/client"
 	"github.com/zncdatadev/operator-go/pkg/constants"
 	"github.com/zncdatadev/operator-go/pkg/util"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
 )
 
 const (
 	kerberosVolumeName = "kerberos"
 	kerberosAuthType   = "kerberos"
 	hadoopOptsEnvName  = "HADOOP_OPTS"
+
+	// kerberosRealmPlaceholder is replaced by the realm of krb5.conf when the container starts.
+	kerberosRealmPlaceholder = "${env.KERBEROS_REALM}"
+	// kerberosHostPattern is replaced by Hive with the host the client connects to.
+	kerberosHostPattern = "_HOST"
 )
 
 var (
@@ -23,40 +36,110 @@ var (
 )
 
 type KerberosConfig struct {
-	Namespace   string
-	ClusterName string
-	RoleName    string
-
+	Namespace           string
 	KerberosSecretClass string
-	HdfsEnabled         bool
+	// Realm of the principals, `${env.KERBEROS_REALM}` is replaced by the realm of krb5.conf in the pods.
+	Realm string
+
+	// MetastoreServiceName and HiveServer2ServiceName are the service parts of the principals of the roles.
+	MetastoreServiceName   string
+	HiveServer2ServiceName string
+
+	// ServiceName is the rolegroup service clients connect through, the servers log in with its principal.
+	ServiceName string
+	RoleName    string
+	HdfsEnabled bool
 }
 
 func NewKerberosConfig(
+	kerberos *hivev1alpha1.KerberosSpec,
 	namespace string,
-	clustername string,
-	rolename string,
-	krb5SecretClass string,
+	serviceName string,
+	roleName string,
 ) *KerberosConfig {
 	return &KerberosConfig{
-		Namespace:           namespace,
-		ClusterName:         clustername,
-		RoleName:            rolename,
-		KerberosSecretClass: krb5SecretClass,
+		Namespace:              namespace,
+		KerberosSecretClass:    kerberos.SecretClass,
+		Realm:                  kerberosRealmPlaceholder,
+		MetastoreServiceName:   GetKerberosServiceName(kerberos, MetastoreRoleName),
+		HiveServer2ServiceName: GetKerberosServiceName(kerberos, HiveServer2RoleName),
+		ServiceName:            serviceName,
+		RoleName:               roleName,
 	}
 }
 
+// GetKerberosServiceName returns the service part of the principals of the role, it defaults to the role name.
+func GetKerberosServiceName(kerberos *hivev1alpha1.KerberosSpec, roleName string) string {
+	switch {
+	case roleName == MetastoreRoleName && kerberos.MetastoreServiceName != "":
+		return kerberos.MetastoreServiceName
+	case roleName == HiveServer2RoleName && kerberos.HiveServer2ServiceName != "":
+		return kerberos.HiveServer2ServiceName
+	}
+	return roleName
+}
+
+// GetKerberosRealm returns the realm of a kerberosKeytab SecretClass,
+// or an empty string if the SecretClass does not exist or has another backend.
+func GetKerberosRealm(ctx context.Context, client *client.Client, secretClass string) (string, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(secretClassGVK)
+	if err := client.Get(ctx, ctrlclient.ObjectKey{Name: secretClass}, obj); err != nil {
+		if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	realm, _, _ := unstructured.NestedString(obj.Object, "spec", "backend", "kerberosKeytab", "realmName")
+	return realm, nil
+}
+
+// GetHiveSite returns the kerberos settings of the servers. The servers log in as
+// `<service>/<rolegroup service FQDN>@REALM` rather than with `_HOST`: the servers would replace `_HOST`
+// with the FQDN of their pod, while clients connect through the rolegroup service and request a ticket
+// for the FQDN of the service. The keytab is issued for the service scope, so it holds that principal.
 func (c *KerberosConfig) GetHiveSite() map[string]string {
+	keytab := path.Join(constants.KubedoopKerberosDir, "keytab")
+	host := GetServiceFQDN(c.Namespace, c.ServiceName)
+	if c.RoleName == HiveServer2RoleName {
+		return map[string]string{
+			"hive.metastore.sasl.enabled":                    "true",
+			"hive.metastore.kerberos.principal":              c.GetPrincipal(c.MetastoreServiceName, kerberosHostPattern),
+			"hive.server2.authentication":                    "KERBEROS",
+			"hive.server2.authentication.kerberos.principal": c.GetPrincipal(c.getServiceName(), host),
+			"hive.server2.authentication.kerberos.keytab":    keytab,
+			"hive.server2.authentication.spnego.principal":   c.GetPrincipal("HTTP", host),
+			"hive.server2.authentication.spnego.keytab":      keytab,
+		}
+	}
+	return map[string]string{
+		"hive.metastore.sasl.enabled":         "true",
+		"hive.metastore.kerberos.principal":   c.GetPrincipal(c.getServiceName(), host),
+		"hive.metastore.kerberos.keytab.file": keytab,
+	}
+}
+
+// GetClientHiveSite returns the settings clients need to connect to the kerberized metastore.
+// Hive replaces `_HOST` with the host of the metastore URI the client connects to.
+func (c *KerberosConfig) GetClientHiveSite() map[string]string {
 	return map[string]string{
-		"hive.metastore.sasl.enabled":              "true",
-		"hive.metastore.kerberos.principal":        c.getPrincipal(c.RoleName),
-		"hive.metastore.client.kerberos.principal": c.getPrincipal(c.RoleName),
-		"hive.metastore.kerberos.keytab.file":      path.Join(constants.KubedoopKerberosDir, "keytab"),
+		"hive.metastore.sasl.enabled":       "true",
+		"hive.metastore.kerberos.principal": c.GetPrincipal(c.MetastoreServiceName, kerberosHostPattern),
 	}
 }
 
-func (c *KerberosConfig) getPrincipal(service string) string {
-	host := fmt.Sprintf("%s.%s.svc.cluster.local", c.ClusterName, c.Namespace)
-	return fmt.Sprintf("%s/%s@${env.KERBEROS_REALM}", service, host)
+// getServiceName returns the service part of the principals of the role of the config.
+func (c *KerberosConfig) getServiceName() string {
+	if c.RoleName == HiveServer2RoleName {
+		return c.HiveServer2ServiceName
+	}
+	return c.MetastoreServiceName
+}
+
+// GetPrincipal returns the principal of the service on the host in the realm of the config.
+func (c *KerberosConfig) GetPrincipal(service string, host string) string {
+	return fmt.Sprintf("%s/%s@%s", service, host, c.Realm)
 }
 
 func (c *KerberosConfig) GetCoreSite() map[string]string {
@@ -79,6 +162,17 @@ func (c *KerberosConfig) GetEnv() []corev1.EnvVar {
 }
 
 func (c *KerberosConfig) GetVolumes() []corev1.Volume {
+	// The keytab holds the principals of the rolegroup service the servers log in with,
+	// and of the pod FQDN for tools run inside the pod with `_HOST` principals.
+	scopes := []string{
+		string(constants.PodScope),
+		fmt.Sprintf("%s=%s", constants.ServiceScope, c.ServiceName),
+	}
+	serviceNames := []string{c.getServiceName()}
+	if c.RoleName == HiveServer2RoleName {
+		serviceNames = append(serviceNames, "HTTP")
+	}
+
 	return []corev1.Volume{
 		{
 			Name: kerberosVolumeName,
@@ -88,8 +182,8 @@ func (c *KerberosConfig) GetVolumes() []corev1.Volume {
 						ObjectMeta: metav1.ObjectMeta{
 							Annotations: map[string]string{
 								constants.AnnotationSecretsClass:                c.KerberosSecretClass,
-								constants.AnnotationSecretsScope:                fmt.Sprintf("service=%s", c.ClusterName),
-								constants.AnnotationSecretsKerberosServiceNames: strings.Join([]string{c.RoleName, "HTTP"}, constants.CommonDelimiter),
+								constants.AnnotationSecretsScope:                strings.Join(scopes, constants.CommonDelimiter),
+								constants.AnnotationSecretsKerberosServiceNames: strings.Join(serviceNames, constants.CommonDelimiter),
 							},
 						},
 						Spec: corev1.PersistentVolumeClaimSpec{
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func TestKerberosConfigGetHiveSite(t *testing.T) {
+	tests := []struct {
+		name     string
+		kerberos *hivev1alpha1.KerberosSpec
+		service  string
+		role     string
+		expected map[string]string
+	}{
+		{
+			name:     "metastore",
+			kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos"},
+			service:  "hive-metastore-default",
+			role:     MetastoreRoleName,
+			expected: map[string]string{
+				"hive.metastore.sasl.enabled":         "true",
+				"hive.metastore.kerberos.principal":   "metastore/hive-metastore-default.ns.svc.cluster.local@${env.KERBEROS_REALM}",
+				"hive.metastore.kerberos.keytab.file": "/kubedoop/kerberos/keytab",
+			},
+		},
+		{
+			name:     "metastore with service name",
+			kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", MetastoreServiceName: "hive"},
+			service:  "hive-metastore-default",
+			role:     MetastoreRoleName,
+			expected: map[string]string{
+				"hive.metastore.sasl.enabled":         "true",
+				"hive.metastore.kerberos.principal":   "hive/hive-metastore-default.ns.svc.cluster.local@${env.KERBEROS_REALM}",
+				"hive.metastore.kerberos.keytab.file": "/kubedoop/kerberos/keytab",
+			},
+		},
+		{
+			name:     "hiveserver2 with service names",
+			kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", MetastoreServiceName: "hive", HiveServer2ServiceName: "hs2"},
+			service:  "hive-hiveserver2-default",
+			role:     HiveServer2RoleName,
+			expected: map[string]string{
+				"hive.metastore.sasl.enabled":                    "true",
+				"hive.metastore.kerberos.principal":              "hive/_HOST@${env.KERBEROS_REALM}",
+				"hive.server2.authentication":                    "KERBEROS",
+				"hive.server2.authentication.kerberos.principal": "hs2/hive-hiveserver2-default.ns.svc.cluster.local@${env.KERBEROS_REALM}",
+				"hive.server2.authentication.kerberos.keytab":    "/kubedoop/kerberos/keytab",
+				"hive.server2.authentication.spnego.principal":   "HTTP/hive-hiveserver2-default.ns.svc.cluster.local@${env.KERBEROS_REALM}",
+				"hive.server2.authentication.spnego.keytab":      "/kubedoop/kerberos/keytab",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewKerberosConfig(tt.kerberos, "ns", tt.service, tt.role).GetHiveSite()
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("GetHiveSite() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKerberosConfigGetVolumes(t *testing.T) {
+	tests := []struct {
+		name                 string
+		kerberos             *hivev1alpha1.KerberosSpec
+		role                 string
+		expectedServiceNames string
+	}{
+		{
+			name:                 "metastore",
+			kerberos:             &hivev1alpha1.KerberosSpec{SecretClass: "kerberos"},
+			role:                 MetastoreRoleName,
+			expectedServiceNames: "metastore",
+		},
+		{
+			name:                 "hiveserver2",
+			kerberos:             &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", HiveServer2ServiceName: "hive"},
+			role:                 HiveServer2RoleName,
+			expectedServiceNames: "hive,HTTP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volumes := NewKerberosConfig(tt.kerberos, "ns", "hive-"+tt.role+"-default", tt.role).GetVolumes()
+			if len(volumes) != 1 {
+				t.Fatalf("GetVolumes() returned %d volumes, expected 1", len(volumes))
+			}
+			annotations := volumes[0].Ephemeral.VolumeClaimTemplate.Annotations
+			if got, expected := annotations[constants.AnnotationSecretsScope], "pod,service=hive-"+tt.role+"-default"; got != expected {
+				t.Errorf("scope = %s, expected %s", got, expected)
+			}
+			if got := annotations[constants.AnnotationSecretsKerberosServiceNames]; got != tt.expectedServiceNames {
+				t.Errorf("kerberos service names = %s, expected %s", got, tt.expectedServiceNames)
+			}
+			if got := annotations[constants.AnnotationSecretsClass]; got != "kerberos" {
+				t.Errorf("secret class = %s, expected kerberos", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	LibrariesVolumeName = "libraries"
+
+	librariesFetchContainerName = "fetch-libraries"
+	librariesImageContainerName = "library-"
+	librariesS3VolumePrefix     = "library-s3-"
+	librariesS3CAVolumePrefix   = "library-ca-"
+)
+
+var (
+	// LibrariesDir is added to the classpath with HIVE_AUX_JARS_PATH, the hive scripts add every jar in it.
+	LibrariesDir = path.Join(constants.KubedoopRoot, "userlib")
+)
+
+// LibrariesConfig fetches the jars of the libraries into an emptyDir shared with the main container.
+// Jars in images are copied by an init container per image, jars from URLs and S3 buckets are
+// downloaded by a single init container with the product image, which also verifies all checksums.
+type LibrariesConfig struct {
+	Libraries []hivev1alpha1.LibrarySpec
+	// Buckets are the S3Buckets referenced by the libraries, keyed by name.
+	Buckets map[string]*S3Bucket
+}
+
+// GetLibrariesConfig resolves the S3Buckets of the libraries, it returns nil without libraries.
+func GetLibrariesConfig(ctx context.Context, client *client.Client, libraries []hivev1alpha1.LibrarySpec) (*LibrariesConfig, error) {
+	if len(libraries) == 0 {
+		return nil, nil
+	}
+
+	buckets := map[string]*S3Bucket{}
+	for _, library := range libraries {
+		if library.S3 == nil {
+			continue
+		}
+		if _, ok := buckets[library.S3.Bucket]; ok {
+			continue
+		}
+		bucket, err := GetS3Bucket(ctx, client, library.S3.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		buckets[library.S3.Bucket] = bucket
+	}
+
+	return &LibrariesConfig{Libraries: libraries, Buckets: buckets}, nil
+}
+
+// ValidateLibraries checks that each library has exactly one source and a unique name.
+func ValidateLibraries(libraries []hivev1alpha1.LibrarySpec) error {
+	names := map[string]bool{}
+	for _, library := range libraries {
+		sources := 0
+		if library.Image != nil {
+			sources++
+		}
+		if library.URL != "" {
+			sources++
+		}
+		if library.S3 != nil {
+			sources++
+		}
+		if sources != 1 {
+			return fmt.Errorf("library %s must set exactly one of image, url and s3", library.Name)
+		}
+		if names[library.Name] {
+			return fmt.Errorf("library %s is listed more than once", library.Name)
+		}
+		names[library.Name] = true
+	}
+	return nil
+}
+
+func getLibraryS3VolumeName(bucket *S3Bucket) string {
+	return librariesS3VolumePrefix + bucket.Name
+}
+
+func getLibraryS3MountPath(bucket *S3Bucket) string {
+	return path.Join(constants.KubedoopSecretDir, getLibraryS3VolumeName(bucket))
+}
+
+// getLibraryS3CAVolumeName returns the volume of the CA of the SecretClass, shared by the buckets verified with it.
+func getLibraryS3CAVolumeName(secretClass string) string {
+	return librariesS3CAVolumePrefix + secretClass
+}
+
+func getLibraryS3CAMountPath(secretClass string) string {
+	return path.Join(constants.KubedoopSecretDir, getLibraryS3CAVolumeName(secretClass))
+}
+
+// getCASecretClasses returns the sorted SecretClasses of the CAs verifying the bucket connections.
+func (c *LibrariesConfig) getCASecretClasses() []string {
+	secretClasses := []string{}
+	for _, bucket := range c.Buckets {
+		if secretClass := getS3CASecretClass(bucket.S3Connection); secretClass != "" && !slices.Contains(secretClasses, secretClass) {
+			secretClasses = append(secretClasses, secretClass)
+		}
+	}
+	slices.Sort(secretClasses)
+	return secretClasses
+}
+
+func (c *LibrariesConfig) GetVolumes() []corev1.Volume {
+	volumes := []corev1.Volume{
+		{
+			Name: LibrariesVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{
+					SizeLimit: ptr.To(resource.MustParse("1Gi")),
+				},
+			},
+		},
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Buckets)) {
+		bucket := c.Buckets[name]
+		volumes = append(volumes, newCredentialsVolume(getLibraryS3VolumeName(bucket), bucket.S3Connection.credential))
+	}
+	for _, secretClass := range c.getCASecretClasses() {
+		volumes = append(volumes, newCAVolume(getLibraryS3CAVolumeName(secretClass), secretClass))
+	}
+	return volumes
+}
+
+// GetVolumeMounts returns the mount of the fetched jars in the main container.
+func (c *LibrariesConfig) GetVolumeMounts() []corev1.VolumeMount {
+	return []corev1.VolumeMount{
+		{
+			Name:      LibrariesVolumeName,
+			MountPath: LibrariesDir,
+			ReadOnly:  true,
+		},
+	}
+}
+
+func (c *LibrariesConfig) GetEnv() []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name:  "HIVE_AUX_JARS_PATH",
+			Value: LibrariesDir,
+		},
+	}
+}
+
+// GetInitContainers returns the init containers fetching the jars, image is the product image
+// used to download and verify them.
+func (c *LibrariesConfig) GetInitContainers(image *util.Image) []corev1.Container {
+	librariesMount := corev1.VolumeMount{Name: LibrariesVolumeName, MountPath: LibrariesDir}
+
+	containers := []corev1.Container{}
+	for i, library := range c.Libraries {
+		if library.Image == nil {
+			continue
+		}
+		// The command is run without a shell, the image only has to provide `cp`.
+		containers = append(containers, corev1.Container{
+			Name:            librariesImageContainerName + strconv.Itoa(i),
+			Image:           library.Image.Image,
+			ImagePullPolicy: library.Image.PullPolicy,
+			Command:         []string{"cp", library.Image.Path, path.Join(LibrariesDir, library.Name)},
+			VolumeMounts:    []corev1.VolumeMount{librariesMount},
+		})
+	}
+
+	args := c.getFetchCommandArgs()
+	if args == "" {
+		return containers
+	}
+
+	volumeMounts := []corev1.VolumeMount{librariesMount}
+	for _, name := range slices.Sorted(maps.Keys(c.Buckets)) {
+		bucket := c.Buckets[name]
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      getLibraryS3VolumeName(bucket),
+			MountPath: getLibraryS3MountPath(bucket),
+			ReadOnly:  true,
+		})
+	}
+	for _, secretClass := range c.getCASecretClasses() {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      getLibraryS3CAVolumeName(secretClass),
+			MountPath: getLibraryS3CAMountPath(secretClass),
+			ReadOnly:  true,
+		})
+	}
+
+	fetch := builder.NewContainer(librariesFetchContainerName, image)
+	fetch.SetCommand([]string{"sh", "-euo", "pipefail", "-c"}).
+		SetArgs([]string{args}).
+		AddVolumeMounts(volumeMounts)
+
+	return append(containers, *fetch.Build())
+}
+
+// getFetchCommandArgs downloads the jars from URLs and S3 buckets, then verifies the checksums of all jars.
+func (c *LibrariesConfig) getFetchCommandArgs() string {
+	var args strings.Builder
+	for _, library := range c.Libraries {
+		file := path.Join(LibrariesDir, library.Name)
+		switch {
+		case library.URL != "":
+			fmt.Fprintf(&args, "curl -fsSL -o %s %s\n", file, shellQuote(library.URL))
+		case library.S3 != nil:
+			bucket := c.Buckets[library.S3.Bucket]
+			objectURL := getS3ObjectURL(bucket.S3Connection, bucket.BucketName, library.S3.Key)
+			fmt.Fprintf(&args, "%s -o %s %s\n",
+				getS3CurlCommand(bucket.S3Connection, getLibraryS3MountPath(bucket), getLibraryS3CAMountPath(getS3CASecretClass(bucket.S3Connection))),
+				file, shellQuote(objectURL.String()))
+		}
+	}
+
+	for _, library := range c.Libraries {
+		if library.SHA256 != "" {
+			fmt.Fprintf(&args, "echo %s | sha256sum -c -\n", shellQuote(library.SHA256+"  "+path.Join(LibrariesDir, library.Name)))
+		}
+	}
+
+	return args.String()
+}
+
+// shellQuote quotes a value as a single shell word.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func TestLibrariesConfigGetInitContainers(t *testing.T) {
+	jars := &S3Bucket{
+		Name:       "jars",
+		BucketName: "hive-jars",
+		S3Connection: &S3Connection{
+			Endpoint:  url.URL{Scheme: "https", Host: "minio:9000"},
+			PathStyle: true,
+			tls:       newTestS3CATls("minio-ca"),
+		},
+	}
+	config := &LibrariesConfig{
+		Libraries: []hivev1alpha1.LibrarySpec{
+			{
+				Name:  "postgresql.jar",
+				Image: &hivev1alpha1.LibraryImageSpec{Image: "drivers:1.0", Path: "/jars/postgresql.jar", PullPolicy: corev1.PullIfNotPresent},
+			},
+			{Name: "udf.jar", URL: "https://example.com/udf's.jar", SHA256: "abc"},
+			{Name: "serde.jar", S3: &hivev1alpha1.LibraryS3Spec{Bucket: "jars", Key: "/libs/serde.jar"}},
+		},
+		Buckets: map[string]*S3Bucket{"jars": jars},
+	}
+
+	containers := config.GetInitContainers(&util.Image{Custom: "hive:4.0.1"})
+	if len(containers) != 2 {
+		t.Fatalf("GetInitContainers() returned %d containers, expected 2", len(containers))
+	}
+
+	imageContainer := findContainer(t, containers, librariesImageContainerName+"0")
+	if imageContainer.Image != "drivers:1.0" || imageContainer.ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("image container = %s %s, expected drivers:1.0 IfNotPresent", imageContainer.Image, imageContainer.ImagePullPolicy)
+	}
+	if expected := []string{"cp", "/jars/postgresql.jar", LibrariesDir + "/postgresql.jar"}; !slices.Equal(imageContainer.Command, expected) {
+		t.Errorf("image container command = %v, expected %v", imageContainer.Command, expected)
+	}
+
+	fetch := findContainer(t, containers, librariesFetchContainerName)
+	if fetch.Image != "hive:4.0.1" {
+		t.Errorf("fetch image = %s, expected the product image", fetch.Image)
+	}
+	args := strings.Join(fetch.Args, "\n")
+	for _, expected := range []string{
+		"curl -fsSL -o " + LibrariesDir + `/udf.jar 'https://example.com/udf'\''s.jar'`,
+		"--cacert " + getLibraryS3CAMountPath("minio-ca") + "/" + tlsCACertKey,
+		"-o " + LibrariesDir + "/serde.jar 'https://minio:9000/hive-jars/libs/serde.jar'",
+		"echo 'abc  " + LibrariesDir + "/udf.jar' | sha256sum -c -",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("fetch args do not contain %q:\n%s", expected, args)
+		}
+	}
+	if strings.Contains(args, "postgresql.jar") {
+		t.Errorf("fetch args download the library of the image:\n%s", args)
+	}
+
+	mounts := map[string]string{}
+	for _, mount := range fetch.VolumeMounts {
+		mounts[mount.Name] = mount.MountPath
+	}
+	expectedMounts := map[string]string{
+		LibrariesVolumeName:                  LibrariesDir,
+		getLibraryS3VolumeName(jars):         getLibraryS3MountPath(jars),
+		getLibraryS3CAVolumeName("minio-ca"): getLibraryS3CAMountPath("minio-ca"),
+	}
+	for name, mountPath := range expectedMounts {
+		if mounts[name] != mountPath {
+			t.Errorf("volume %s mounted at %q, expected %q", name, mounts[name], mountPath)
+		}
+	}
+}
+
+func TestLibrariesConfigGetInitContainersOnlyImages(t *testing.T) {
+	config := &LibrariesConfig{
+		Libraries: []hivev1alpha1.LibrarySpec{
+			{Name: "a.jar", Image: &hivev1alpha1.LibraryImageSpec{Image: "jars:1", Path: "/a.jar"}},
+			{Name: "b.jar", Image: &hivev1alpha1.LibraryImageSpec{Image: "jars:2", Path: "/b.jar"}},
+		},
+	}
+
+	containers := config.GetInitContainers(&util.Image{Custom: "hive:4.0.1"})
+	names := []string{}
+	for _, container := range containers {
+		names = append(names, container.Name)
+	}
+	if expected := []string{librariesImageContainerName + "0", librariesImageContainerName + "1"}; !slices.Equal(names, expected) {
+		t.Errorf("init containers = %v, expected %v without the fetch container", names, expected)
+	}
+}
@@ -18,6 +18,10 @@ type RoleReconciler struct {
 	reconciler.BaseRoleReconciler[*hivev1alpha1.RoleSpec]
 	ClusterConfig *hivev1alpha1.ClusterConfigSpec
 	Image         *util.Image
+
+	// MetastoreURIs are the thrift URIs of the metastore rolegroups of the cluster,
+	// used by the roles connecting to the metastore.
+	MetastoreURIs []string
 }
 
 func NewNodeRoleReconciler(
@@ -26,6 +30,7 @@ func NewNodeRoleReconciler(
 	clusterConfig *hivev1alpha1.ClusterConfigSpec,
 	roleInfo reconciler.RoleInfo,
 	image *util.Image,
+	metastoreURIs []string,
 	spec *hivev1alpha1.RoleSpec,
 ) *RoleReconciler {
 	return &RoleReconciler{
@@ -37,6 +42,7 @@ func NewNodeRoleReconciler(
 		),
 		ClusterConfig: clusterConfig,
 		Image:         image,
+		MetastoreURIs: metastoreURIs,
 	}
 }
 
@@ -96,9 +102,13 @@ func (r *RoleReconciler) GetImageResourceWithRoleGroup(
 		r.ClusterConfig,
 		info,
 		config,
+		r.MetastoreURIs,
+		overrides,
 		options,
 	)
 
+	ports := GetContainerPorts(info.RoleName)
+
 	var commonsRoleGroupConfig *commonsv1alpha1.RoleGroupConfigSpec
 	if config != nil {
 		commonsRoleGroupConfig = config.RoleGroupConfigSpec
@@ -108,7 +118,8 @@ func (r *RoleReconciler) GetImageResourceWithRoleGroup(
 		r.Client,
 		info,
 		r.ClusterConfig,
-		ContainerPort,
+		cm.GetBuilder(),
+		ports,
 		r.Image,
 		replicas,
 		r.ClusterStopped(),
@@ -123,7 +134,7 @@ func (r *RoleReconciler) GetImageResourceWithRoleGroup(
 	svc := reconciler.NewServiceReconciler(
 		r.Client,
 		info.GetFullName(),
-		ContainerPort,
+		ports,
 		func(o *builder.ServiceBuilderOptions) {
 			o.ClusterName = info.ClusterName
 			o.RoleName = info.RoleName
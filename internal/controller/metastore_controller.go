@@ -18,13 +18,24 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
 	"github.com/zncdatadev/operator-go/pkg/client"
 	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -33,19 +44,31 @@ import (
 
 var log = logf.Log.WithName("hive-metastore-controller")
 
+// databaseUnreachableRequeueAfter is the interval of the reachability check while the database is unreachable.
+const databaseUnreachableRequeueAfter = 30 * time.Second
+
+// restoreRequeueAfter is the interval of the checks while the cluster is stopped for a restore.
+const restoreRequeueAfter = 10 * time.Second
+
 // HiveMetastoreReconciler reconciles a HiveMetastore object
 type HiveMetastoreReconciler struct {
 	ctrlclient.Client
 	Scheme *runtime.Scheme
+
+	databaseProbes DatabaseProbes
 }
 
 // +kubebuilder:rbac:groups=hive.kubedoop.dev,resources=hivemetastores,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=hive.kubedoop.dev,resources=hivemetastores/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=hive.kubedoop.dev,resources=hivemetastores/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=secrets.kubedoop.dev,resources=secretclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=s3.kubedoop.dev,resources=s3connections,verbs=get;list;watch
 // +kubebuilder:rbac:groups=s3.kubedoop.dev,resources=s3buckets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
@@ -58,6 +81,7 @@ func (r *HiveMetastoreReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.V(3).Info("Cannot find HiveMetastore instance, may have been deleted")
+			r.databaseProbes.Forget(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		log.V(1).Error(err, "Got error when trying to fetch HiveMetastore instance. Error: %v", err)
@@ -81,16 +105,102 @@ func (r *HiveMetastoreReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	reconciler := NewClusterReconciler(resourceClient, clusterInfo, &instance.Spec)
 
+	result, err := r.run(ctx, instance, reconciler)
+
+	statusUpdater := NewStatusUpdater(r.Client, instance)
+	statusUpdater.Restore = reconciler.Restore
+	statusUpdater.DatabaseProbes = &r.databaseProbes
+	if statusErr := statusUpdater.Update(ctx, err); statusErr != nil {
+		log.Error(statusErr, "Failed to update HiveMetastore status", "Name", instance.Name)
+		if err == nil {
+			return ctrl.Result{}, statusErr
+		}
+	}
+
+	// An invalid spec is reported in the status, retrying cannot fix it.
+	// The next change of the spec triggers a new reconciliation.
+	var specErr *InvalidSpecError
+	if errors.As(err, &specErr) {
+		log.Info("HiveMetastore spec is invalid, waiting for a change", "Name", instance.Name, "reason", specErr.Reason, "message", specErr.Message)
+		return ctrl.Result{}, nil
+	}
+
+	// The reachability of the database is only probed while reconciling, keep probing until it recovers.
+	if err == nil && result.IsZero() && apimeta.IsStatusConditionFalse(instance.Status.Conditions, hivev1alpha1.ConditionTypeDatabaseReachable) {
+		result.RequeueAfter = databaseUnreachableRequeueAfter
+	}
+
+	return result, err
+}
+
+func (r *HiveMetastoreReconciler) run(ctx context.Context, instance *hivev1alpha1.HiveMetastore, reconciler *ClusterReconciler) (ctrl.Result, error) {
+	if err := ValidateSpec(reconciler.Spec); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	restore, err := ObserveRestore(ctx, r.Client, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	reconciler.Restore = restore
+
 	if err := reconciler.RegisterResource(ctx); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return reconciler.Run(ctx)
+	result, err := reconciler.Run(ctx)
+	if err != nil || !result.IsZero() || restore == nil {
+		return result, err
+	}
+
+	switch restore.Phase {
+	case hivev1alpha1.RestoreStopping, hivev1alpha1.RestoreRestoring:
+		// The pods are not owned by the HiveMetastore, their deletion is polled.
+		return ctrl.Result{RequeueAfter: restoreRequeueAfter}, nil
+	case hivev1alpha1.RestoreUpgrading:
+		// The schema Job is registered before the roles, so a ready cluster runs the upgraded schema.
+		if !reconciler.IsPaused(ctx) {
+			restore.Phase = hivev1alpha1.RestoreCompleted
+			restore.Message = fmt.Sprintf("Restored %s", restore.Source)
+			restore.CompletionTime = ptr.To(metav1.Now())
+		}
+	}
+	return result, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Generated resources are owned by the HiveMetastore, so changes to them are reverted,
+// and referenced resources are mapped back to the clusters using them through field indexes.
 func (r *HiveMetastoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := setupIndexes(context.Background(), mgr); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&hivev1alpha1.HiveMetastore{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&batchv1.Job{}).
+		Owns(&batchv1.CronJob{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Service{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Watches(
+			&s3v1alpha1.S3Connection{},
+			enqueueReferencingClusters(mgr.GetClient(), S3ConnectionIndexKey),
+		).
+		Watches(
+			&s3v1alpha1.S3Bucket{},
+			enqueueReferencingClusters(mgr.GetClient(), S3BucketIndexKey),
+		).
+		// Only the metadata of the Secrets is cached, the handler maps them by name and class label.
+		Watches(
+			&corev1.Secret{},
+			enqueueSecretReferencingClusters(mgr.GetClient()),
+			builder.OnlyMetadata,
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			enqueueReferencingClusters(mgr.GetClient(), ConfigMapIndexKey),
+		).
 		Complete(r)
 }
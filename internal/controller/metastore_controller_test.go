@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -75,6 +76,14 @@ var _ = Describe("HiveMetastore controller", func() {
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the status is populated")
+			resource := &hivev1alpha1.HiveMetastore{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+			Expect(resource.Status.RoleGroups).To(HaveKey(MetastoreRoleName + "-" + testRoleGroupName))
+			Expect(apimeta.FindStatusCondition(resource.Status.Conditions, hivev1alpha1.ConditionTypeAvailable)).NotTo(BeNil())
+			Expect(apimeta.FindStatusCondition(resource.Status.Conditions, hivev1alpha1.ConditionTypeDegraded)).NotTo(BeNil())
 		})
 	})
 })
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/zncdatadev/operator-go/pkg/util"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	connectionPoolHikariCP = "HikariCP"
+	connectionPoolNone     = "None"
+
+	defaultMaxPoolSize         = 20
+	defaultPostgresMaxPoolSize = 10
+	defaultCacheType           = "soft"
+
+	// secondaryPoolSize is the fixed size of the pool of the secondary DataNucleus connection factory,
+	// used for the schema and value generation.
+	secondaryPoolSize = 2
+	// txnPoolCount is the number of pools of the TxnHandler, the transaction and the mutex pool,
+	// each sized by the maxPoolSize of DataNucleus.
+	txnPoolCount = 2
+)
+
+// PerformanceConfig is the performance section of a rolegroup with the defaults of the database type applied.
+type PerformanceConfig struct {
+	PoolType    string
+	MaxPoolSize int32
+	DirectSQL   bool
+	Cache       bool
+	CacheType   string
+}
+
+func NewPerformanceConfig(database *hivev1alpha1.DatabaseSpec, spec *hivev1alpha1.PerformanceSpec) *PerformanceConfig {
+	c := &PerformanceConfig{
+		PoolType:    connectionPoolHikariCP,
+		MaxPoolSize: defaultMaxPoolSize,
+		DirectSQL:   true,
+		CacheType:   defaultCacheType,
+	}
+	switch database.DatabaseType {
+	case DatabaseTypeDerby:
+		// The embedded database lives in the metastore process, a pool only adds overhead.
+		c.PoolType = connectionPoolNone
+	case DatabaseTypePostgres:
+		// Each postgres connection is a server process.
+		c.MaxPoolSize = defaultPostgresMaxPoolSize
+	}
+
+	if spec == nil {
+		return c
+	}
+	if pool := spec.ConnectionPool; pool != nil {
+		if pool.Type != "" {
+			c.PoolType = pool.Type
+		}
+		if pool.MaxPoolSize != nil {
+			c.MaxPoolSize = *pool.MaxPoolSize
+		}
+	}
+	if spec.DirectSQL != nil {
+		c.DirectSQL = *spec.DirectSQL
+	}
+	if cache := spec.Cache; cache != nil {
+		c.Cache = cache.Enabled
+		if cache.Type != "" {
+			c.CacheType = cache.Type
+		}
+	}
+	return c
+}
+
+// GetConnections returns the maximum number of database connections of a metastore pod. The pod opens
+// the primary DataNucleus pool, the secondary pool of the schema and value generation, and the two pools
+// of the TxnHandler, so it opens (1 + txnPoolCount) * maxPoolSize + secondaryPoolSize connections.
+// Without a pool a connection is opened per request, which is only used by the embedded derby database.
+func (c *PerformanceConfig) GetConnections() int32 {
+	if c.PoolType == connectionPoolNone {
+		return 1
+	}
+	return (1+txnPoolCount)*c.MaxPoolSize + secondaryPoolSize
+}
+
+func (c *PerformanceConfig) GetHiveSite() map[string]string {
+	cacheType := "none"
+	if c.Cache {
+		cacheType = c.CacheType
+	}
+
+	config := map[string]string{
+		"datanucleus.connectionPoolingType": "NONE",
+		"hive.metastore.try.direct.sql":     strconv.FormatBool(c.DirectSQL),
+		"hive.metastore.try.direct.sql.ddl": strconv.FormatBool(c.DirectSQL),
+		"datanucleus.cache.level2":          strconv.FormatBool(c.Cache),
+		"datanucleus.cache.level2.type":     cacheType,
+	}
+	if c.PoolType != connectionPoolNone {
+		config["datanucleus.connectionPoolingType"] = c.PoolType
+		config["datanucleus.connectionPool.maxPoolSize"] = strconv.Itoa(int(c.MaxPoolSize))
+	}
+	return config
+}
+
+// GetMetastoreConnections returns the maximum number of database connections of all metastore pods,
+// the connections of a pod of each rolegroup times its replicas. The replicas of a stopped cluster are counted,
+// they come back when it is started.
+func GetMetastoreConnections(database *hivev1alpha1.DatabaseSpec, metastore *hivev1alpha1.RoleSpec) (int32, error) {
+	if metastore == nil {
+		return 0, nil
+	}
+
+	var connections int32
+	for _, name := range slices.Sorted(maps.Keys(metastore.RoleGroups)) {
+		roleGroup := metastore.RoleGroups[name]
+		if roleGroup == nil {
+			continue
+		}
+		config, err := util.MergeObject(metastore.Config, roleGroup.Config)
+		if err != nil {
+			return 0, err
+		}
+		var spec *hivev1alpha1.PerformanceSpec
+		if config != nil {
+			spec = config.Performance
+		}
+		connections += NewPerformanceConfig(database, spec).GetConnections() * roleGroup.Replicas
+	}
+	return connections, nil
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"maps"
+	"testing"
+
+	"k8s.io/utils/ptr"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func TestPerformanceConfigGetConnections(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		spec     *hivev1alpha1.PerformanceSpec
+		expected int32
+	}{
+		{name: "derby", database: DatabaseTypeDerby, expected: 1},
+		{name: "postgres default", database: DatabaseTypePostgres, expected: 3*defaultPostgresMaxPoolSize + 2},
+		{name: "mysql default", database: DatabaseTypeMysql, expected: 3*defaultMaxPoolSize + 2},
+		{
+			name:     "custom pool size",
+			database: DatabaseTypePostgres,
+			spec: &hivev1alpha1.PerformanceSpec{
+				ConnectionPool: &hivev1alpha1.ConnectionPoolSpec{MaxPoolSize: ptr.To[int32](4)},
+			},
+			expected: 14,
+		},
+		{
+			name:     "without pool",
+			database: DatabaseTypePostgres,
+			spec: &hivev1alpha1.PerformanceSpec{
+				ConnectionPool: &hivev1alpha1.ConnectionPoolSpec{Type: connectionPoolNone},
+			},
+			expected: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := NewPerformanceConfig(&hivev1alpha1.DatabaseSpec{DatabaseType: tt.database}, tt.spec)
+			if connections := config.GetConnections(); connections != tt.expected {
+				t.Errorf("GetConnections() = %d, expected %d", connections, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetMetastoreConnections(t *testing.T) {
+	metastore := &hivev1alpha1.RoleSpec{
+		Config: &hivev1alpha1.ConfigSpec{
+			Performance: &hivev1alpha1.PerformanceSpec{
+				ConnectionPool: &hivev1alpha1.ConnectionPoolSpec{MaxPoolSize: ptr.To[int32](4)},
+			},
+		},
+		RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{
+			"default": {Replicas: 2},
+			"large": {
+				Replicas: 1,
+				Config: &hivev1alpha1.ConfigSpec{
+					Performance: &hivev1alpha1.PerformanceSpec{
+						ConnectionPool: &hivev1alpha1.ConnectionPoolSpec{MaxPoolSize: ptr.To[int32](8)},
+					},
+				},
+			},
+		},
+	}
+
+	connections, err := GetMetastoreConnections(&hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres}, metastore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two pods of 3*4+2 connections, and one pod of 3*8+2 connections.
+	if expected := int32(2*14 + 26); connections != expected {
+		t.Errorf("GetMetastoreConnections() = %d, expected %d", connections, expected)
+	}
+}
+
+func TestPerformanceConfigGetHiveSite(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		spec     *hivev1alpha1.PerformanceSpec
+		expected map[string]string
+	}{
+		{
+			name:     "derby",
+			database: DatabaseTypeDerby,
+			expected: map[string]string{
+				"datanucleus.connectionPoolingType": "NONE",
+				"hive.metastore.try.direct.sql":     "true",
+				"hive.metastore.try.direct.sql.ddl": "true",
+				"datanucleus.cache.level2":          "false",
+				"datanucleus.cache.level2.type":     "none",
+			},
+		},
+		{
+			name:     "postgres",
+			database: DatabaseTypePostgres,
+			expected: map[string]string{
+				"datanucleus.connectionPoolingType":      connectionPoolHikariCP,
+				"datanucleus.connectionPool.maxPoolSize": "10",
+				"hive.metastore.try.direct.sql":          "true",
+				"hive.metastore.try.direct.sql.ddl":      "true",
+				"datanucleus.cache.level2":               "false",
+				"datanucleus.cache.level2.type":          "none",
+			},
+		},
+		{
+			name:     "custom",
+			database: DatabaseTypeMysql,
+			spec: &hivev1alpha1.PerformanceSpec{
+				ConnectionPool: &hivev1alpha1.ConnectionPoolSpec{Type: "DBCP", MaxPoolSize: ptr.To[int32](5)},
+				DirectSQL:      ptr.To(false),
+				Cache:          &hivev1alpha1.DataNucleusCacheSpec{Enabled: true, Type: "weak"},
+			},
+			expected: map[string]string{
+				"datanucleus.connectionPoolingType":      "DBCP",
+				"datanucleus.connectionPool.maxPoolSize": "5",
+				"hive.metastore.try.direct.sql":          "false",
+				"hive.metastore.try.direct.sql.ddl":      "false",
+				"datanucleus.cache.level2":               "true",
+				"datanucleus.cache.level2.type":          "weak",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hiveSite := NewPerformanceConfig(&hivev1alpha1.DatabaseSpec{DatabaseType: tt.database}, tt.spec).GetHiveSite()
+			if !maps.Equal(hiveSite, tt.expected) {
+				t.Errorf("GetHiveSite() = %v, expected %v", hiveSite, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	client "github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/constant"
+)
+
+const (
+	RestoreComponentName = "restore"
+
+	restoreVolumeName            = "restore"
+	restoreS3VolumeName          = "restore-s3-credentials"
+	restoreS3CAVolumeName        = "restore-s3-ca"
+	restoreDownloadContainerName = "download"
+	restoreContainerName         = "restore"
+	restoreJobBackoffLimit       = 1
+)
+
+var (
+	RestoreDir = path.Join(constants.KubedoopRoot, "restore")
+
+	restoreDumpFile         = path.Join(RestoreDir, "dump")
+	restoreS3CredentialsDir = path.Join(constants.KubedoopSecretDir, restoreS3VolumeName)
+	restoreS3CADir          = path.Join(constants.KubedoopSecretDir, restoreS3CAVolumeName)
+)
+
+// GetRestoreSource returns the URI of the restored backup, it identifies a restore in the status.
+func GetRestoreSource(restore *hivev1alpha1.RestoreSpec) string {
+	return "s3://" + restore.Bucket + "/" + restore.Key
+}
+
+// GetRestoreJobName returns the name of the Job restoring the source, each source is restored by its own Job.
+func GetRestoreJobName(clusterName string, source string) string {
+	hash := sha256.Sum256([]byte(source))
+	return fmt.Sprintf("%s-%s-%s", clusterName, RestoreComponentName, hex.EncodeToString(hash[:])[:8])
+}
+
+// GetRestoreJobLabels returns the labels selecting the restore Jobs of a cluster.
+func GetRestoreJobLabels(clusterInfo reconciler.ClusterInfo) map[string]string {
+	labels := clusterInfo.GetLabels()
+	labels[constants.LabelKubernetesComponent] = RestoreComponentName
+	return labels
+}
+
+// ValidateRestore checks that the database can be restored from the configured source.
+func ValidateRestore(clusterConfig *hivev1alpha1.ClusterConfigSpec) error {
+	restore := clusterConfig.RestoreFrom
+	if restore == nil {
+		return nil
+	}
+	if err := validateDatabaseTools(clusterConfig.Database, "restore"); err != nil {
+		return err
+	}
+	if !HasS3Connection(restore.S3) {
+		return fmt.Errorf("restore requires an inline or referenced s3 connection")
+	}
+	return nil
+}
+
+// isRestoreStopping reports whether the cluster is kept stopped by the restore: while the pods
+// stop and the backup is restored, and after a failed restore, which may have left a partial database.
+func isRestoreStopping(status *hivev1alpha1.RestoreStatus) bool {
+	if status == nil {
+		return false
+	}
+	switch status.Phase {
+	case hivev1alpha1.RestoreStopping, hivev1alpha1.RestoreRestoring, hivev1alpha1.RestoreFailed:
+		return true
+	}
+	return false
+}
+
+// ObserveRestore returns the restore status of the cluster, advanced from the previous status with
+// the observed pods and restore Job. It returns nil without restoreFrom.
+// The transition from Upgrading to Completed is made by the caller, once the cluster is ready.
+func ObserveRestore(ctx context.Context, c ctrlclient.Client, instance *hivev1alpha1.HiveMetastore) (*hivev1alpha1.RestoreStatus, error) {
+	restore := instance.Spec.ClusterConfig.RestoreFrom
+	if restore == nil {
+		return nil, nil
+	}
+
+	source := GetRestoreSource(restore)
+	status := &hivev1alpha1.RestoreStatus{
+		Source:    source,
+		Phase:     hivev1alpha1.RestoreStopping,
+		StartTime: ptr.To(metav1.Now()),
+	}
+	if previous := instance.Status.Restore; previous != nil && previous.Source == source && previous.Phase != "" {
+		status = previous.DeepCopy()
+	}
+
+	switch status.Phase {
+	case hivev1alpha1.RestoreUpgrading, hivev1alpha1.RestoreCompleted, hivev1alpha1.RestoreFailed:
+		return status, nil
+	}
+
+	jobName := GetRestoreJobName(instance.Name, source)
+	job := &batchv1.Job{}
+	if err := c.Get(ctx, ctrlclient.ObjectKey{Namespace: instance.Namespace, Name: jobName}, job); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		// The Job is created in the Restoring phase, it is created again if it was deleted.
+		if status.Phase == hivev1alpha1.RestoreRestoring {
+			return status, nil
+		}
+
+		running, err := countClusterPods(ctx, c, instance)
+		if err != nil {
+			return nil, err
+		}
+		if running > 0 {
+			status.Phase = hivev1alpha1.RestoreStopping
+			status.Message = fmt.Sprintf("Waiting for %d pods to stop", running)
+			return status, nil
+		}
+		status.Phase = hivev1alpha1.RestoreRestoring
+		status.Message = fmt.Sprintf("Restoring %s", source)
+		return status, nil
+	}
+
+	status.JobName = job.Name
+	if failed, message := isJobFailed(job); failed {
+		podMessage, err := getJobPodMessage(ctx, c, instance.Namespace, job.Name, corev1.PodFailed,
+			restoreDownloadContainerName, restoreContainerName)
+		if err != nil {
+			return nil, err
+		}
+		if podMessage != "" {
+			message = podMessage
+		}
+		status.Phase = hivev1alpha1.RestoreFailed
+		status.Message = message
+		status.CompletionTime = getJobConditionTime(job, batchv1.JobFailed)
+	} else if job.Status.Succeeded > 0 {
+		status.Phase = hivev1alpha1.RestoreUpgrading
+		status.Message = "Upgrading the schema and starting the cluster"
+	} else {
+		status.Phase = hivev1alpha1.RestoreRestoring
+		status.Message = fmt.Sprintf("Restoring %s", source)
+	}
+	return status, nil
+}
+
+// countClusterPods returns the number of metastore and HiveServer2 pods, including terminating pods.
+func countClusterPods(ctx context.Context, c ctrlclient.Client, instance *hivev1alpha1.HiveMetastore) (int, error) {
+	count := 0
+	for _, roleName := range []string{MetastoreRoleName, HiveServer2RoleName} {
+		pods := &corev1.PodList{}
+		if err := c.List(ctx, pods,
+			ctrlclient.InNamespace(instance.Namespace),
+			ctrlclient.MatchingLabels{
+				constants.LabelKubernetesInstance:  instance.Name,
+				constants.LabelKubernetesComponent: roleName,
+			},
+		); err != nil {
+			return 0, err
+		}
+		count += len(pods.Items)
+	}
+	return count, nil
+}
+
+var _ builder.JobBuilder = &RestoreJobBuilder{}
+
+// RestoreJobBuilder builds the Job downloading the backup in an init container,
+// then restoring it into the database of the stopped cluster.
+type RestoreJobBuilder struct {
+	builder.Job
+	ClusterConfig *hivev1alpha1.ClusterConfigSpec
+	Metastore     *hivev1alpha1.RoleSpec
+}
+
+func NewRestoreJobBuilder(
+	client *client.Client,
+	name string,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	metastore *hivev1alpha1.RoleSpec,
+	image *util.Image,
+	options ...builder.Option,
+) *RestoreJobBuilder {
+	return &RestoreJobBuilder{
+		Job: builder.Job{
+			BaseWorkloadBuilder: *builder.NewBaseWorkloadBuilder(
+				client,
+				name,
+				image,
+				nil,
+				nil,
+				options...,
+			),
+		},
+		ClusterConfig: clusterConfig,
+		Metastore:     metastore,
+	}
+}
+
+func (b *RestoreJobBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
+	restore := b.ClusterConfig.RestoreFrom
+
+	dbConfig, err := NewDatabaseConfig(b.ClusterConfig.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Connection, err := GetS3Connect(ctx, b.Client, restore.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	if waitContainer := dbConfig.GetWaitInitContainer(b.GetImage()); waitContainer != nil {
+		b.AddInitContainer(waitContainer)
+	}
+	b.AddInitContainer(b.getDownloadContainer(s3Connection))
+
+	container, err := b.getRestoreContainer(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.AddContainer(container)
+
+	b.AddVolumes([]corev1.Volume{
+		{
+			Name: restoreVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+		newCredentialsVolume(restoreS3VolumeName, s3Connection.credential),
+	})
+	if secretClass := getS3CASecretClass(s3Connection); secretClass != "" {
+		b.AddVolumes([]corev1.Volume{newCAVolume(restoreS3CAVolumeName, secretClass)})
+	}
+	b.AddVolumes(dbConfig.GetVolumes())
+	b.SetRestPolicy(ptr.To(corev1.RestartPolicyNever))
+
+	obj, err := b.GetObject()
+	if err != nil {
+		return nil, err
+	}
+
+	// The metastore is stopped, so the ReadWriteOnce PVC of derby can be mounted anywhere.
+	if dbConfig.IsEmbedded() {
+		_, claimName, err := getDerbyClaim(b.ClusterName, b.Metastore)
+		if err != nil {
+			return nil, err
+		}
+		podSpec := &obj.Spec.Template.Spec
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: derbyDataVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claimName,
+				},
+			},
+		})
+		podSpec.SecurityContext = &corev1.PodSecurityContext{
+			FSGroup: ptr.To[int64](constant.KubedoopGroupID),
+		}
+	}
+
+	obj.Spec.BackoffLimit = ptr.To[int32](restoreJobBackoffLimit)
+	return obj, nil
+}
+
+func (b *RestoreJobBuilder) getDownloadContainer(s3Connection *S3Connection) *corev1.Container {
+	restore := b.ClusterConfig.RestoreFrom
+	objectURL := getS3ObjectURL(s3Connection, restore.Bucket, restore.Key)
+
+	args := getS3CurlCommand(s3Connection, restoreS3CredentialsDir, restoreS3CADir) + " -o " + restoreDumpFile + " " + shellQuote(objectURL.String()) + "\n"
+
+	container := builder.NewContainer(restoreDownloadContainerName, b.GetImage())
+	container.SetCommand([]string{"sh", "-euo", "pipefail", "-c"}).
+		SetArgs([]string{args}).
+		AddVolumeMounts([]corev1.VolumeMount{
+			{Name: restoreVolumeName, MountPath: RestoreDir},
+			{Name: restoreS3VolumeName, MountPath: restoreS3CredentialsDir, ReadOnly: true},
+		})
+	if getS3CASecretClass(s3Connection) != "" {
+		container.AddVolumeMount(&corev1.VolumeMount{Name: restoreS3CAVolumeName, MountPath: restoreS3CADir, ReadOnly: true})
+	}
+
+	obj := container.Build()
+	obj.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	return obj
+}
+
+// getRestoreContainer restores the downloaded dump, replacing the existing metastore tables.
+func (b *RestoreJobBuilder) getRestoreContainer(dbConfig *DatabaseConfig) (*corev1.Container, error) {
+	restore := b.ClusterConfig.RestoreFrom
+	image, pullPolicy := getDatabaseToolImage(dbConfig.Spec, restore.Image, b.GetImage())
+	container := &corev1.Container{
+		Name:            restoreContainerName,
+		Image:           image,
+		ImagePullPolicy: pullPolicy,
+		Command:         []string{"bash", "-euo", "pipefail", "-c"},
+		VolumeMounts: append([]corev1.VolumeMount{
+			{Name: restoreVolumeName, MountPath: RestoreDir},
+		}, dbConfig.GetVolumeMounts()...),
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+	done := `
+echo "restored ` + GetRestoreSource(restore) + `" | tee /dev/termination-log
+`
+
+	if dbConfig.IsEmbedded() {
+		// The archive holds a single directory, it is extracted into the configured database name.
+		name := getDerbyDatabaseName(dbConfig.Spec)
+		container.VolumeMounts = []corev1.VolumeMount{
+			{Name: restoreVolumeName, MountPath: RestoreDir},
+			{Name: derbyDataVolumeName, MountPath: constants.KubedoopDataDir},
+		}
+		container.Args = []string{`
+rm -rf ` + name + `
+mkdir -p ` + name + `
+tar xzf ` + restoreDumpFile + ` -C ` + name + ` --strip-components=1
+` + done}
+		return container, nil
+	}
+
+	env, setup, err := getDatabaseClientSetup(dbConfig, RestoreDir)
+	if err != nil {
+		return nil, err
+	}
+	container.Env = env
+
+	switch dbConfig.Spec.DatabaseType {
+	case DatabaseTypePostgres:
+		container.Args = []string{setup + `
+pg_restore --clean --if-exists --no-owner --no-privileges --exit-on-error -d "$PGDATABASE" ` + restoreDumpFile + `
+` + done}
+	case DatabaseTypeMysql, DatabaseTypeMariadb:
+		// The dump drops each table before recreating it.
+		container.Args = []string{setup + `
+mysql=$(command -v mariadb || command -v mysql)
+gzip -dc ` + restoreDumpFile + ` | "$mysql" --defaults-extra-file=` + path.Join(RestoreDir, databaseClientConfigFile) + ` "$DB_NAME"
+` + done}
+	}
+	return container, nil
+}
+
+var _ reconciler.Reconciler = &RestoreReconciler{}
+
+// RestoreReconciler creates the restore Job and waits for it, like the SchemaReconciler.
+type RestoreReconciler struct {
+	*reconciler.Job
+	// Labels select the restore Jobs of the cluster, the Jobs of previous restores are deleted with them.
+	Labels map[string]string
+}
+
+func NewRestoreReconciler(
+	client *client.Client,
+	clusterInfo reconciler.ClusterInfo,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	metastore *hivev1alpha1.RoleSpec,
+	image *util.Image,
+) *RestoreReconciler {
+	labels := GetRestoreJobLabels(clusterInfo)
+	b := NewRestoreJobBuilder(
+		client,
+		GetRestoreJobName(clusterInfo.ClusterName, GetRestoreSource(clusterConfig.RestoreFrom)),
+		clusterConfig,
+		metastore,
+		image,
+		func(o *builder.Options) {
+			o.ClusterName = clusterInfo.ClusterName
+			o.RoleName = RestoreComponentName
+			o.Labels = labels
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+
+	return &RestoreReconciler{
+		Job:    reconciler.NewJob(client, b),
+		Labels: labels,
+	}
+}
+
+func (r *RestoreReconciler) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	obj, err := r.GetBuilder().Build(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The Job name changes with the source, an existing Job is never updated.
+	if err := r.Client.CreateDoesNotExist(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	job := obj.(*batchv1.Job)
+	if failed, message := isJobFailed(job); failed {
+		return ctrl.Result{}, fmt.Errorf("restore job %s failed: %s", job.Name, message)
+	}
+	if job.Status.Succeeded > 0 {
+		return ctrl.Result{}, deleteStaleJobs(ctx, r.Client, r.Labels, job.Name)
+	}
+
+	log.Info("Waiting for restore job to complete", "namespace", job.Namespace, "name", job.Name)
+	return ctrl.Result{RequeueAfter: r.ReadyRequeueAfter}, nil
+}
+
+func (r *RestoreReconciler) Ready(ctx context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
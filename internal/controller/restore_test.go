@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/constant"
+)
+
+func buildTestRestoreJob(t *testing.T, database *hivev1alpha1.DatabaseSpec, restoreImage string) *batchv1.Job {
+	t.Helper()
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: database,
+		RestoreFrom: &hivev1alpha1.RestoreSpec{
+			S3:     newTestS3Spec(),
+			Bucket: "backups",
+			Key:    "hive/metastore-20260101T030000Z.pgdump",
+			Image:  restoreImage,
+		},
+	}
+	if err := ValidateRestore(clusterConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewRestoreJobBuilder(
+		newTestClient(t),
+		GetRestoreJobName("hive", GetRestoreSource(clusterConfig.RestoreFrom)),
+		clusterConfig,
+		newTestMetastoreRole(),
+		util.NewImage(hivev1alpha1.DefaultProductName, "0.0.0-dev", hivev1alpha1.DefaultProductVersion),
+		func(o *builder.Options) {
+			o.ClusterName = "hive"
+			o.RoleName = RestoreComponentName
+		},
+	)
+	obj, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj.(*batchv1.Job)
+}
+
+func TestGetRestoreJobName(t *testing.T) {
+	source := GetRestoreSource(&hivev1alpha1.RestoreSpec{Bucket: "backups", Key: "hive/metastore-1.pgdump"})
+	if source != "s3://backups/hive/metastore-1.pgdump" {
+		t.Errorf("GetRestoreSource() = %s, expected s3://backups/hive/metastore-1.pgdump", source)
+	}
+
+	name := GetRestoreJobName("hive", source)
+	if !strings.HasPrefix(name, "hive-restore-") || name != GetRestoreJobName("hive", source) {
+		t.Errorf("GetRestoreJobName() = %s, expected a stable name prefixed with hive-restore-", name)
+	}
+	if name == GetRestoreJobName("hive", "s3://backups/hive/metastore-2.pgdump") {
+		t.Errorf("GetRestoreJobName() = %s for different sources", name)
+	}
+}
+
+func TestRestoreJobBuilderPostgres(t *testing.T) {
+	job := buildTestRestoreJob(t, &hivev1alpha1.DatabaseSpec{
+		DatabaseType:      DatabaseTypePostgres,
+		Host:              "postgres",
+		DatabaseName:      "hive",
+		CredentialsSecret: "hive-credentials",
+	}, "registry.local/tools/postgres:16")
+
+	if *job.Spec.BackoffLimit != restoreJobBackoffLimit {
+		t.Errorf("backoff limit = %d, expected %d", *job.Spec.BackoffLimit, restoreJobBackoffLimit)
+	}
+
+	podSpec := job.Spec.Template.Spec
+	findContainer(t, podSpec.InitContainers, waitForDatabaseContainerName)
+	download := findContainer(t, podSpec.InitContainers, restoreDownloadContainerName)
+	expected := "-o " + restoreDumpFile + " 'http://minio:9000/backups/hive/metastore-20260101T030000Z.pgdump'"
+	if !strings.Contains(download.Args[0], expected) {
+		t.Errorf("download args do not contain %s:\n%s", expected, download.Args[0])
+	}
+
+	restore := findContainer(t, podSpec.Containers, restoreContainerName)
+	if restore.Image != "registry.local/tools/postgres:16" {
+		t.Errorf("restore image = %s, expected the image of the spec", restore.Image)
+	}
+	for _, expected := range []string{
+		`pg_restore --clean --if-exists --no-owner --no-privileges --exit-on-error -d "$PGDATABASE" ` + restoreDumpFile,
+		"restored s3://backups/hive/metastore-20260101T030000Z.pgdump",
+	} {
+		if !strings.Contains(restore.Args[0], expected) {
+			t.Errorf("restore args do not contain %s:\n%s", expected, restore.Args[0])
+		}
+	}
+
+	findVolume(t, podSpec.Volumes, restoreVolumeName)
+	findVolume(t, podSpec.Volumes, restoreS3VolumeName)
+	findVolume(t, podSpec.Volumes, databaseCredentialsVolumeName)
+}
+
+func TestRestoreJobBuilderDerby(t *testing.T) {
+	database := &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby, Storage: &commonsv1alpha1.StorageResource{}}
+	job := buildTestRestoreJob(t, database, "")
+
+	podSpec := job.Spec.Template.Spec
+	volume := findVolume(t, podSpec.Volumes, derbyDataVolumeName)
+	if claim := volume.PersistentVolumeClaim; claim == nil || claim.ClaimName != "derby-data-hive-metastore-default-0" || claim.ReadOnly {
+		t.Errorf("derby volume = %+v, expected the writable PVC of the metastore pod", volume.VolumeSource)
+	}
+	if podSpec.SecurityContext == nil || podSpec.SecurityContext.FSGroup == nil || *podSpec.SecurityContext.FSGroup != constant.KubedoopGroupID {
+		t.Errorf("pod security context = %+v, expected fsGroup %d", podSpec.SecurityContext, constant.KubedoopGroupID)
+	}
+	for _, c := range podSpec.InitContainers {
+		if c.Name == waitForDatabaseContainerName {
+			t.Error("restore of the embedded derby database waits for a database server")
+		}
+	}
+
+	restore := findContainer(t, podSpec.Containers, restoreContainerName)
+	expected := "tar xzf " + restoreDumpFile + " -C " + DefaultDerbyDatabaseName + " --strip-components=1"
+	if !strings.Contains(restore.Args[0], expected) {
+		t.Errorf("restore args do not contain %s:\n%s", expected, restore.Args[0])
+	}
+}
+
+func TestRestoreReconcilerDeletesPreviousJobs(t *testing.T) {
+	clusterInfo := reconciler.ClusterInfo{
+		GVK:         &metav1.GroupVersionKind{Group: hivev1alpha1.GroupVersion.Group, Version: hivev1alpha1.GroupVersion.Version, Kind: "HiveMetastore"},
+		ClusterName: "hive",
+	}
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: &hivev1alpha1.DatabaseSpec{
+			DatabaseType:      DatabaseTypePostgres,
+			Host:              "postgres",
+			DatabaseName:      "hive",
+			CredentialsSecret: "hive-credentials",
+		},
+		RestoreFrom: &hivev1alpha1.RestoreSpec{
+			S3:     newTestS3Spec(),
+			Bucket: "backups",
+			Key:    "hive/metastore-20260102T030000Z.pgdump",
+		},
+	}
+	labels := GetRestoreJobLabels(clusterInfo)
+	current := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: GetRestoreJobName("hive", GetRestoreSource(clusterConfig.RestoreFrom)), Namespace: "ns", Labels: labels},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+	previous := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: GetRestoreJobName("hive", "s3://backups/hive/metastore-20260101T030000Z.pgdump"), Namespace: "ns", Labels: labels},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+	c := newTestClient(t, current, previous)
+
+	r := NewRestoreReconciler(c, clusterInfo, clusterConfig, newTestMetastoreRole(),
+		util.NewImage(hivev1alpha1.DefaultProductName, "0.0.0-dev", hivev1alpha1.DefaultProductVersion))
+	result, err := r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsZero() {
+		t.Errorf("result = %v, expected the restore to be completed", result)
+	}
+
+	if err := c.Client.Get(context.Background(), ctrlclient.ObjectKeyFromObject(previous), &batchv1.Job{}); !apierrors.IsNotFound(err) {
+		t.Errorf("previous restore job is kept: %v", err)
+	}
+	if err := c.Client.Get(context.Background(), ctrlclient.ObjectKeyFromObject(current), &batchv1.Job{}); err != nil {
+		t.Errorf("current restore job: %v", err)
+	}
+}
@@ -3,8 +3,11 @@ package controller
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net/url"
 	"path"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -16,6 +19,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 
 	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
 )
@@ -24,14 +28,36 @@ const (
 	S3AccessKeyName = "ACCESS_KEY"
 	S3SecretKeyName = "SECRET_KEY"
 
-	S3VolumeName = "s3-credentials"
+	S3VolumeName           = "s3-credentials"
+	S3CAVolumeName         = "s3-tls-ca"
+	S3TruststoreVolumeName = "s3-truststore"
+	S3BucketVolumePrefix   = "s3-bucket-"
+
+	// defaultS3Region is used to sign requests to connections without a region, e.g. MinIO.
+	defaultS3Region = "us-east-1"
+
+	// s3TruststorePassword protects the generated truststore, which only holds public certificates.
+	s3TruststorePassword = "changeit"
+)
+
+var (
+	S3TruststoreFile = path.Join(constants.KubedoopRoot, "s3-truststore", "truststore.p12")
+
+	envNameInvalidChars = regexp.MustCompile(`[^A-Z0-9_]`)
 )
 
-// TODO: Add the tls verification
 type S3Connection struct {
 	Endpoint   url.URL
 	PathStyle  bool
+	Region     string
 	credential *commonsv1alpha1.Credentials
+	tls        *v1alpha1.Tls
+}
+
+// HasS3Connection reports whether the S3 spec configures a default connection,
+// a spec may only reference buckets.
+func HasS3Connection(s3 *hivev1alpha1.S3Spec) bool {
+	return s3 != nil && (s3.Inline != nil || s3.Reference != "")
 }
 
 func GetS3Connect(ctx context.Context, client *client.Client, s3 *hivev1alpha1.S3Spec) (*S3Connection, error) {
@@ -44,8 +70,17 @@ func GetS3Connect(ctx context.Context, client *client.Client, s3 *hivev1alpha1.S
 		s3ConnectionSpec = &obj.Spec
 	}
 
+	return newS3Connection(s3ConnectionSpec), nil
+}
+
+func newS3Connection(s3ConnectionSpec *v1alpha1.S3ConnectionSpec) *S3Connection {
+	scheme := "http"
+	if s3ConnectionSpec.Tls != nil {
+		scheme = "https"
+	}
+
 	endpoint := url.URL{
-		Scheme: "http",
+		Scheme: scheme,
 		Host:   s3ConnectionSpec.Host,
 	}
 	if s3ConnectionSpec.Port != 0 {
@@ -55,8 +90,10 @@ func GetS3Connect(ctx context.Context, client *client.Client, s3 *hivev1alpha1.S
 	return &S3Connection{
 		Endpoint:   endpoint,
 		PathStyle:  s3ConnectionSpec.PathStyle,
+		Region:     s3ConnectionSpec.Region,
 		credential: s3ConnectionSpec.Credentials,
-	}, nil
+		tls:        s3ConnectionSpec.Tls,
+	}
 }
 
 func GetRefreenceS3Connection(ctx context.Context, client *client.Client, name string) (*v1alpha1.S3Connection, error) {
@@ -67,14 +104,154 @@ func GetRefreenceS3Connection(ctx context.Context, client *client.Client, name s
 	return s3Connection, nil
 }
 
+// S3Bucket is a bucket referenced by the cluster, resolved with its own connection.
+type S3Bucket struct {
+	// Name is the name of the S3Bucket object.
+	Name         string
+	BucketName   string
+	S3Connection *S3Connection
+}
+
+// GetS3Buckets resolves the S3Bucket objects referenced by the S3 spec.
+func GetS3Buckets(ctx context.Context, client *client.Client, s3 *hivev1alpha1.S3Spec) ([]*S3Bucket, error) {
+	buckets := make([]*S3Bucket, 0, len(s3.Buckets))
+	for _, name := range s3.Buckets {
+		bucket, err := GetS3Bucket(ctx, client, name)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// GetS3Bucket resolves a S3Bucket object with its inline or referenced connection.
+func GetS3Bucket(ctx context.Context, client *client.Client, name string) (*S3Bucket, error) {
+	obj := &v1alpha1.S3Bucket{}
+	if err := client.GetWithOwnerNamespace(ctx, name, obj); err != nil {
+		return nil, err
+	}
+
+	connection := obj.Spec.Connection
+	if connection == nil {
+		return nil, fmt.Errorf("s3 bucket %s has no connection", name)
+	}
+	s3ConnectionSpec := connection.Inline
+	if connection.Reference != "" {
+		ref, err := GetRefreenceS3Connection(ctx, client, connection.Reference)
+		if err != nil {
+			return nil, err
+		}
+		s3ConnectionSpec = &ref.Spec
+	}
+	if s3ConnectionSpec == nil {
+		return nil, fmt.Errorf("s3 bucket %s has neither an inline nor a referenced connection", name)
+	}
+
+	bucketName := obj.Spec.BucketName
+	if bucketName == "" {
+		bucketName = name
+	}
+
+	return &S3Bucket{
+		Name:         name,
+		BucketName:   bucketName,
+		S3Connection: newS3Connection(s3ConnectionSpec),
+	}, nil
+}
+
+// getS3ObjectURL returns the URL of an object, in path style or virtual-hosted style depending on the connection.
+func getS3ObjectURL(connection *S3Connection, bucketName string, key string) url.URL {
+	endpoint := connection.Endpoint
+	key = strings.TrimPrefix(key, "/")
+	if connection.PathStyle {
+		endpoint.Path = "/" + bucketName + "/" + key
+	} else {
+		endpoint.Host = bucketName + "." + endpoint.Host
+		endpoint.Path = "/" + key
+	}
+	return endpoint
+}
+
+// getS3CurlCommand returns a curl command signing its request with the credentials mounted at credentialsDir.
+// The credentials are passed to curl through its config on stdin, so they do not show up in its arguments.
+// The endpoint is verified with the CA mounted at caDir when the connection has a CA SecretClass.
+func getS3CurlCommand(connection *S3Connection, credentialsDir string, caDir string) string {
+	region := connection.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	tlsOption := ""
+	switch {
+	case isS3VerificationDisabled(connection):
+		tlsOption = "--insecure "
+	case getS3CASecretClass(connection) != "":
+		tlsOption = "--cacert " + path.Join(caDir, tlsCACertKey) + " "
+	}
+	return fmt.Sprintf("printf 'user = \"%%s:%%s\"\\n' \"$(cat %s)\" \"$(cat %s)\" | curl -fsSL %s--aws-sigv4 %s -K -",
+		path.Join(credentialsDir, S3AccessKeyName), path.Join(credentialsDir, S3SecretKeyName),
+		tlsOption, shellQuote("aws:amz:"+region+":s3"))
+}
+
+// getS3CASecretClass returns the SecretClass of the CA verifying the endpoint of the connection,
+// or an empty string when the default CAs are used.
+func getS3CASecretClass(connection *S3Connection) string {
+	if connection == nil {
+		return ""
+	}
+	tls := connection.tls
+	if tls == nil || tls.Verification == nil || tls.Verification.Server == nil || tls.Verification.Server.CACert == nil {
+		return ""
+	}
+	return tls.Verification.Server.CACert.SecretClass
+}
+
+// isS3VerificationDisabled reports whether the endpoint certificate of the connection is explicitly not verified.
+func isS3VerificationDisabled(connection *S3Connection) bool {
+	if connection == nil {
+		return false
+	}
+	tls := connection.tls
+	return tls != nil && tls.Verification != nil && tls.Verification.None != nil
+}
+
+// GetS3Config resolves the default connection and the buckets of the S3 spec.
+func GetS3Config(ctx context.Context, client *client.Client, s3 *hivev1alpha1.S3Spec) (*S3Config, error) {
+	if s3 == nil {
+		return nil, nil
+	}
+
+	var s3Connection *S3Connection
+	if HasS3Connection(s3) {
+		s, err := GetS3Connect(ctx, client, s3)
+		if err != nil {
+			return nil, err
+		}
+		s3Connection = s
+	}
+
+	buckets, err := GetS3Buckets(ctx, client, s3)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewS3Config(s3Connection, buckets), nil
+}
+
+// S3Config renders the S3A settings of the default connection and of each referenced bucket.
+// The default connection passes its credentials through the AWS environment variables,
+// the buckets through `${env.*}` references resolved by Hadoop, so no secret is written to the ConfigMap.
 type S3Config struct {
+	// S3Connection is the default connection, it is nil when only buckets are referenced.
 	S3Connection *S3Connection
+	Buckets      []*S3Bucket
 }
 
 func NewS3Config(
 	s3Connection *S3Connection,
+	buckets []*S3Bucket,
 ) *S3Config {
-	return &S3Config{S3Connection: s3Connection}
+	return &S3Config{S3Connection: s3Connection, Buckets: buckets}
 }
 
 func (s *S3Config) GetMountPath() string {
@@ -89,24 +266,116 @@ func (s *S3Config) GetEndpoint() string {
 	return s.S3Connection.Endpoint.String()
 }
 
-func (s *S3Config) GetHiveSite() map[string]string {
+// getConnections returns the default connection, if any, and the connections of the buckets.
+func (s *S3Config) getConnections() []*S3Connection {
+	connections := make([]*S3Connection, 0, len(s.Buckets)+1)
+	if s.S3Connection != nil {
+		connections = append(connections, s.S3Connection)
+	}
+	for _, bucket := range s.Buckets {
+		connections = append(connections, bucket.S3Connection)
+	}
+	return connections
+}
+
+// GetCASecretClasses returns the sorted SecretClasses of the CAs verifying the endpoints of the default
+// connection and of the bucket connections. They are all imported into the truststore of the JVM,
+// which is shared by the connections. It is empty when the JVM default truststore is used.
+func (s *S3Config) GetCASecretClasses() []string {
+	secretClasses := []string{}
+	for _, connection := range s.getConnections() {
+		if secretClass := getS3CASecretClass(connection); secretClass != "" && !slices.Contains(secretClasses, secretClass) {
+			secretClasses = append(secretClasses, secretClass)
+		}
+	}
+	slices.Sort(secretClasses)
+	return secretClasses
+}
+
+// IsVerificationDisabled reports whether the endpoint certificate of a connection is explicitly not verified.
+// The AWS SDK option is global, so it disables the verification of all connections.
+func (s *S3Config) IsVerificationDisabled() bool {
+	return slices.ContainsFunc(s.getConnections(), isS3VerificationDisabled)
+}
+
+// getS3CAVolumeName returns the volume of the CA of the SecretClass, e.g. s3-tls-ca-tls.
+func getS3CAVolumeName(secretClass string) string {
+	return S3CAVolumeName + "-" + secretClass
+}
 
-	sslEnabled := s.S3Connection.Endpoint.Scheme == "https"
+func getS3CAMountPath(secretClass string) string {
+	return path.Join(constants.KubedoopSecretDir, getS3CAVolumeName(secretClass))
+}
 
+func (s *S3Config) GetHiveSite() map[string]string {
 	properties := map[string]string{
-		"fs.s3a.endpoint":                s.GetEndpoint(),
-		"fs.s3a.path.style.access":       "true",
-		"fs.s3a.connection.ssl.enabled":  strconv.FormatBool(sslEnabled),
 		"fs.s3a.impl":                    "org.apache.hadoop.fs.s3a.S3AFileSystem",
 		"fs.AbstractFileSystem.s3a.impl": "org.apache.hadoop.fs.s3a.S3A",
 	}
+
+	if s.S3Connection != nil {
+		maps.Copy(properties, getS3AConnectionProperties("fs.s3a.", s.S3Connection))
+	}
+
+	for _, bucket := range s.Buckets {
+		prefix := "fs.s3a.bucket." + bucket.BucketName + "."
+		maps.Copy(properties, getS3AConnectionProperties(prefix, bucket.S3Connection))
+		properties[prefix+"aws.credentials.provider"] = "org.apache.hadoop.fs.s3a.SimpleAWSCredentialsProvider"
+		properties[prefix+"access.key"] = "${env." + getS3BucketEnvName(bucket, S3AccessKeyName) + "}"
+		properties[prefix+"secret.key"] = "${env." + getS3BucketEnvName(bucket, S3SecretKeyName) + "}"
+	}
 	return properties
 }
 
+// getS3AConnectionProperties returns the endpoint settings of a connection,
+// prefix is `fs.s3a.` for the default connection or `fs.s3a.bucket.<name>.` for a bucket.
+func getS3AConnectionProperties(prefix string, s3Connection *S3Connection) map[string]string {
+	sslEnabled := s3Connection.Endpoint.Scheme == "https"
+
+	properties := map[string]string{
+		prefix + "endpoint":               s3Connection.Endpoint.String(),
+		prefix + "path.style.access":      strconv.FormatBool(s3Connection.PathStyle),
+		prefix + "connection.ssl.enabled": strconv.FormatBool(sslEnabled),
+	}
+	if s3Connection.Region != "" {
+		properties[prefix+"endpoint.region"] = s3Connection.Region
+	}
+	return properties
+}
+
+func getS3BucketVolumeName(bucket *S3Bucket) string {
+	return S3BucketVolumePrefix + bucket.Name
+}
+
+func getS3BucketMountPath(bucket *S3Bucket) string {
+	return path.Join(constants.KubedoopSecretDir, getS3BucketVolumeName(bucket))
+}
+
+// getS3BucketEnvName returns the env var holding a credential of the bucket, e.g. S3_BUCKET_MY_BUCKET_ACCESS_KEY.
+func getS3BucketEnvName(bucket *S3Bucket, key string) string {
+	name := envNameInvalidChars.ReplaceAllString(strings.ToUpper(bucket.Name), "_")
+	return "S3_BUCKET_" + name + "_" + key
+}
+
 func (s *S3Config) GetVolumes() []corev1.Volume {
+	volumes := []corev1.Volume{}
 
-	credential := s.S3Connection.credential
+	if s.S3Connection != nil {
+		volumes = append(volumes, newCredentialsVolume(s.GetVolumeName(), s.S3Connection.credential))
+	}
 
+	if secretClasses := s.GetCASecretClasses(); len(secretClasses) > 0 {
+		volumes = append(volumes, s.getCAVolumes(secretClasses)...)
+	}
+
+	for _, bucket := range s.Buckets {
+		volumes = append(volumes, newCredentialsVolume(getS3BucketVolumeName(bucket), bucket.S3Connection.credential))
+	}
+	return volumes
+}
+
+// newCredentialsVolume returns a secret-operator volume providing the credentials of the SecretClass.
+func newCredentialsVolume(name string, credential *commonsv1alpha1.Credentials) corev1.Volume {
 	secretClass := credential.SecretClass
 
 	annotations := map[string]string{
@@ -129,8 +398,8 @@ func (s *S3Config) GetVolumes() []corev1.Volume {
 
 		annotations[constants.AnnotationSecretsScope] = strings.Join(scopes, constants.CommonDelimiter)
 	}
-	secretVolume := corev1.Volume{
-		Name: s.GetVolumeName(),
+	return corev1.Volume{
+		Name: name,
 		VolumeSource: corev1.VolumeSource{
 			Ephemeral: &corev1.EphemeralVolumeSource{
 				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
@@ -150,23 +419,139 @@ func (s *S3Config) GetVolumes() []corev1.Volume {
 			},
 		},
 	}
-	return []corev1.Volume{secretVolume}
+}
+
+// getCAVolumes returns the CAs provisioned by secret-operator, and the volume
+// holding the truststore built from them at startup.
+func (s *S3Config) getCAVolumes(secretClasses []string) []corev1.Volume {
+	volumes := make([]corev1.Volume, 0, len(secretClasses)+1)
+	for _, secretClass := range secretClasses {
+		volumes = append(volumes, newCAVolume(getS3CAVolumeName(secretClass), secretClass))
+	}
+	return append(volumes, corev1.Volume{
+		Name: S3TruststoreVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				SizeLimit: ptr.To(resource.MustParse("5Mi")),
+			},
+		},
+	})
+}
+
+// newCAVolume returns a secret-operator volume providing the PEM encoded CA of the SecretClass.
+func newCAVolume(name string, secretClass string) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			Ephemeral: &corev1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+					ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{
+							constants.AnnotationSecretsClass:  secretClass,
+							constants.AnnotationSecretsScope:  string(constants.PodScope),
+							constants.AnnotationSecretsFormat: string(constants.TLSPEM),
+						},
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						StorageClassName: constants.SecretStorageClassPtr(),
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse("1Mi"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 }
 
 func (s *S3Config) GetVolumeMounts() []corev1.VolumeMount {
-	secretVolumeMount := &corev1.VolumeMount{
-		Name:      s.GetVolumeName(),
-		MountPath: s.GetMountPath(),
+	volumeMounts := []corev1.VolumeMount{}
+
+	if s.S3Connection != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      s.GetVolumeName(),
+			MountPath: s.GetMountPath(),
+		})
 	}
 
-	return []corev1.VolumeMount{*secretVolumeMount}
+	if secretClasses := s.GetCASecretClasses(); len(secretClasses) > 0 {
+		for _, secretClass := range secretClasses {
+			volumeMounts = append(volumeMounts, corev1.VolumeMount{
+				Name:      getS3CAVolumeName(secretClass),
+				MountPath: getS3CAMountPath(secretClass),
+			})
+		}
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      S3TruststoreVolumeName,
+			MountPath: path.Dir(S3TruststoreFile),
+		})
+	}
+
+	for _, bucket := range s.Buckets {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      getS3BucketVolumeName(bucket),
+			MountPath: getS3BucketMountPath(bucket),
+		})
+	}
+	return volumeMounts
+}
+
+// GetEnv returns the JVM options verifying the S3 endpoint certificate with the built truststore,
+// or disabling the verification.
+func (s *S3Config) GetEnv() []corev1.EnvVar {
+	var jvmOpts string
+	switch {
+	case s.IsVerificationDisabled():
+		jvmOpts = "-Dcom.amazonaws.sdk.disableCertChecking=true"
+	case len(s.GetCASecretClasses()) > 0:
+		jvmOpts = fmt.Sprintf("-Djavax.net.ssl.trustStore=%s -Djavax.net.ssl.trustStorePassword=%s -Djavax.net.ssl.trustStoreType=pkcs12",
+			S3TruststoreFile, s3TruststorePassword)
+	default:
+		return nil
+	}
+
+	return []corev1.EnvVar{
+		{
+			Name:  hadoopOptsEnvName,
+			Value: jvmOpts,
+		},
+	}
 }
 
 func (s *S3Config) GetContainerCommandArgs() string {
-	args := `
+	args := ""
+
+	if s.S3Connection != nil {
+		args += `
 export AWS_ACCESS_KEY_ID=$(cat ` + path.Join(s.GetMountPath(), S3AccessKeyName) + `)
 export AWS_SECRET_ACCESS_KEY=$(cat ` + path.Join(s.GetMountPath(), S3SecretKeyName) + `)
 `
+	}
+
+	// The truststore keeps the JVM default CAs, the S3 CAs are added to them.
+	// The emptyDir survives container restarts, keytool refuses to import the alias twice.
+	if secretClasses := s.GetCASecretClasses(); len(secretClasses) > 0 {
+		args += `
+rm -f ` + S3TruststoreFile + `
+keytool -importkeystore -noprompt -srckeystore "${JAVA_HOME}/lib/security/cacerts" -srcstorepass changeit \
+    -destkeystore ` + S3TruststoreFile + ` -deststoretype pkcs12 -deststorepass ` + s3TruststorePassword + `
+`
+		for _, secretClass := range secretClasses {
+			args += `keytool -importcert -noprompt -alias s3-ca-` + secretClass + ` -file ` + path.Join(getS3CAMountPath(secretClass), tlsCACertKey) + ` \
+    -keystore ` + S3TruststoreFile + ` -storetype pkcs12 -storepass ` + s3TruststorePassword + `
+`
+		}
+	}
+
+	for _, bucket := range s.Buckets {
+		args += `
+export ` + getS3BucketEnvName(bucket, S3AccessKeyName) + `=$(cat ` + path.Join(getS3BucketMountPath(bucket), S3AccessKeyName) + `)
+export ` + getS3BucketEnvName(bucket, S3SecretKeyName) + `=$(cat ` + path.Join(getS3BucketMountPath(bucket), S3SecretKeyName) + `)
+`
+	}
 
 	return util.IndentTab4Spaces(args)
 }
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func newTestS3ConnectionSpec(host string) *s3v1alpha1.S3ConnectionSpec {
+	return &s3v1alpha1.S3ConnectionSpec{
+		Credentials: &commonsv1alpha1.Credentials{SecretClass: "s3-credentials"},
+		Host:        host,
+		Port:        9000,
+	}
+}
+
+func TestGetS3Config(t *testing.T) {
+	connection := &s3v1alpha1.S3Connection{
+		ObjectMeta: metav1.ObjectMeta{Name: "minio", Namespace: "ns"},
+		Spec:       *newTestS3ConnectionSpec("minio"),
+	}
+	connection.Spec.PathStyle = true
+	bucket := &s3v1alpha1.S3Bucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "warehouse-bucket", Namespace: "ns"},
+		Spec: s3v1alpha1.S3BucketSpec{
+			BucketName: "warehouse",
+			Connection: &s3v1alpha1.S3BucketConnectionSpec{Inline: newTestS3ConnectionSpec("s3.example.com")},
+		},
+	}
+	bucket.Spec.Connection.Inline.Region = "eu-west-1"
+	bucket.Spec.Connection.Inline.Tls = &s3v1alpha1.Tls{}
+
+	s3Config, err := GetS3Config(context.Background(), newTestClient(t, connection, bucket), &hivev1alpha1.S3Spec{
+		Reference: "minio",
+		Buckets:   []string{"warehouse-bucket"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hiveSite := s3Config.GetHiveSite()
+	expected := map[string]string{
+		"fs.s3a.endpoint":                                  "http://minio:9000",
+		"fs.s3a.path.style.access":                         "true",
+		"fs.s3a.connection.ssl.enabled":                    "false",
+		"fs.s3a.bucket.warehouse.endpoint":                 "https://s3.example.com:9000",
+		"fs.s3a.bucket.warehouse.path.style.access":        "false",
+		"fs.s3a.bucket.warehouse.connection.ssl.enabled":   "true",
+		"fs.s3a.bucket.warehouse.endpoint.region":          "eu-west-1",
+		"fs.s3a.bucket.warehouse.access.key":               "${env.S3_BUCKET_WAREHOUSE_BUCKET_ACCESS_KEY}",
+		"fs.s3a.bucket.warehouse.secret.key":               "${env.S3_BUCKET_WAREHOUSE_BUCKET_SECRET_KEY}",
+		"fs.s3a.bucket.warehouse.aws.credentials.provider": "org.apache.hadoop.fs.s3a.SimpleAWSCredentialsProvider",
+	}
+	for key, value := range expected {
+		if hiveSite[key] != value {
+			t.Errorf("%s = %q, expected %q", key, hiveSite[key], value)
+		}
+	}
+	if _, ok := hiveSite["fs.s3a.endpoint.region"]; ok {
+		t.Errorf("fs.s3a.endpoint.region is set for a connection without region")
+	}
+
+	if volumes := s3Config.GetVolumes(); len(volumes) != 2 || volumes[1].Name != "s3-bucket-warehouse-bucket" {
+		t.Errorf("GetVolumes() = %v, expected the connection and the bucket credentials", volumes)
+	}
+}
+
+func TestGetS3ConfigMissingBucket(t *testing.T) {
+	_, err := GetS3Config(context.Background(), newTestClient(t), &hivev1alpha1.S3Spec{Buckets: []string{"missing"}})
+	if err == nil {
+		t.Error("GetS3Config() expected an error for a missing bucket")
+	}
+}
+
+func TestS3ConfigGetEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		tls      *s3v1alpha1.Tls
+		expected string
+	}{
+		{name: "http"},
+		{name: "web pki", tls: &s3v1alpha1.Tls{}},
+		{
+			name:     "verification disabled",
+			tls:      &s3v1alpha1.Tls{Verification: &commonsv1alpha1.TLSVerificationSpec{None: &commonsv1alpha1.NoneVerification{}}},
+			expected: "-Dcom.amazonaws.sdk.disableCertChecking=true",
+		},
+		{
+			name: "ca secretClass",
+			tls: &s3v1alpha1.Tls{Verification: &commonsv1alpha1.TLSVerificationSpec{
+				Server: &commonsv1alpha1.ServerVerification{CACert: &commonsv1alpha1.CACert{SecretClass: "tls"}},
+			}},
+			expected: "-Djavax.net.ssl.trustStore=" + S3TruststoreFile +
+				" -Djavax.net.ssl.trustStorePassword=changeit -Djavax.net.ssl.trustStoreType=pkcs12",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestS3ConnectionSpec("minio")
+			spec.Tls = tt.tls
+			env := NewS3Config(newS3Connection(spec), nil).GetEnv()
+
+			if tt.expected == "" {
+				if len(env) != 0 {
+					t.Errorf("GetEnv() = %v, expected no env", env)
+				}
+				return
+			}
+			if len(env) != 1 || env[0].Name != hadoopOptsEnvName || env[0].Value != tt.expected {
+				t.Errorf("GetEnv() = %v, expected %s=%s", env, hadoopOptsEnvName, tt.expected)
+			}
+		})
+	}
+}
+
+func newTestS3CATls(secretClass string) *s3v1alpha1.Tls {
+	return &s3v1alpha1.Tls{Verification: &commonsv1alpha1.TLSVerificationSpec{
+		Server: &commonsv1alpha1.ServerVerification{CACert: &commonsv1alpha1.CACert{SecretClass: secretClass}},
+	}}
+}
+
+func TestS3ConfigBucketCAs(t *testing.T) {
+	connection := newTestS3ConnectionSpec("minio")
+	connection.Tls = newTestS3CATls("minio-ca")
+	newBucket := func(name string, secretClass string) *S3Bucket {
+		spec := newTestS3ConnectionSpec(name + ".example.com")
+		spec.Tls = newTestS3CATls(secretClass)
+		return &S3Bucket{Name: name, BucketName: name, S3Connection: newS3Connection(spec)}
+	}
+	s3Config := NewS3Config(newS3Connection(connection), []*S3Bucket{
+		newBucket("warehouse", "ceph-ca"),
+		newBucket("archive", "minio-ca"),
+	})
+
+	if secretClasses := s3Config.GetCASecretClasses(); !slices.Equal(secretClasses, []string{"ceph-ca", "minio-ca"}) {
+		t.Errorf("GetCASecretClasses() = %v, expected the CAs of the connection and the buckets", secretClasses)
+	}
+
+	args := s3Config.GetContainerCommandArgs()
+	for _, secretClass := range []string{"ceph-ca", "minio-ca"} {
+		if !strings.Contains(args, "-alias s3-ca-"+secretClass+" -file "+path.Join(getS3CAMountPath(secretClass), tlsCACertKey)) {
+			t.Errorf("the CA of %s is not imported into the truststore:\n%s", secretClass, args)
+		}
+	}
+
+	volumes := map[string]bool{}
+	for _, volume := range s3Config.GetVolumes() {
+		volumes[volume.Name] = true
+	}
+	mounts := map[string]bool{}
+	for _, mount := range s3Config.GetVolumeMounts() {
+		mounts[mount.Name] = true
+	}
+	for _, name := range []string{getS3CAVolumeName("ceph-ca"), getS3CAVolumeName("minio-ca"), S3TruststoreVolumeName} {
+		if !volumes[name] || !mounts[name] {
+			t.Errorf("volume %s is not mounted", name)
+		}
+	}
+
+	// The verification of one connection cannot be disabled alone in the JVM.
+	disabled := newTestS3ConnectionSpec("insecure.example.com")
+	disabled.Tls = &s3v1alpha1.Tls{Verification: &commonsv1alpha1.TLSVerificationSpec{None: &commonsv1alpha1.NoneVerification{}}}
+	s3Config.Buckets = append(s3Config.Buckets, &S3Bucket{Name: "insecure", BucketName: "insecure", S3Connection: newS3Connection(disabled)})
+	if !s3Config.IsVerificationDisabled() {
+		t.Error("IsVerificationDisabled() = false, expected a bucket connection to disable the verification")
+	}
+}
+
+func TestGetS3CurlCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		tls      *s3v1alpha1.Tls
+		expected string
+	}{
+		{name: "http"},
+		{name: "web pki", tls: &s3v1alpha1.Tls{}},
+		{
+			name:     "verification disabled",
+			tls:      &s3v1alpha1.Tls{Verification: &commonsv1alpha1.TLSVerificationSpec{None: &commonsv1alpha1.NoneVerification{}}},
+			expected: "--insecure",
+		},
+		{name: "ca secretClass", tls: newTestS3CATls("tls"), expected: "--cacert /ca/" + tlsCACertKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestS3ConnectionSpec("minio")
+			spec.Tls = tt.tls
+			command := getS3CurlCommand(newS3Connection(spec), "/credentials", "/ca")
+
+			for _, option := range []string{"--insecure", "--cacert"} {
+				if strings.Contains(command, option) != strings.HasPrefix(tt.expected, option) {
+					t.Errorf("getS3CurlCommand() = %s, expected %q", command, tt.expected)
+				}
+			}
+			if tt.expected != "" && !strings.Contains(command, tt.expected) {
+				t.Errorf("getS3CurlCommand() = %s, expected %q", command, tt.expected)
+			}
+		})
+	}
+}
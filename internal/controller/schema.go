@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/builder"
+	client "github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	SchemaComponentName = "schema"
+
+	schemaJobBackoffLimit = 3
+
+	schemaConfigVolumeName = "config"
+)
+
+// IsSchemaJobEnabled reports whether the database schema is migrated by the schema Job.
+// Derby is embedded in each metastore pod, so its schema is created when the pod starts.
+func IsSchemaJobEnabled(database *hivev1alpha1.DatabaseSpec) bool {
+	if _, err := GetDatabaseDriver(database.DatabaseType); err != nil {
+		return false
+	}
+	return database.DatabaseType != DatabaseTypeDerby
+}
+
+// GetSchemaJobName returns the name of the schema Job for the given image and database.
+// Jobs are immutable, so a change of the product version, database, libraries or restored backup
+// creates a new Job, which runs the upgrade before the metastore is rolled out.
+func GetSchemaJobName(clusterName string, image *util.Image, clusterConfig *hivev1alpha1.ClusterConfigSpec, libraries []hivev1alpha1.LibrarySpec) string {
+	database := clusterConfig.Database
+	// The rendered URL covers the structured fields as well as a raw connString.
+	// An invalid database is reported by the builder, the name only needs to be stable for it.
+	jdbcURL := database.ConnString
+	if dbConfig, err := NewDatabaseConfig(database); err == nil {
+		jdbcURL = dbConfig.URL
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n", image.ProductVersion, image.KubedoopVersion, database.DatabaseType, jdbcURL)
+	// The restored dump may hold an older schema.
+	if clusterConfig.RestoreFrom != nil {
+		fmt.Fprintf(hash, "restore=%s\n", GetRestoreSource(clusterConfig.RestoreFrom))
+	}
+	for _, library := range libraries {
+		fmt.Fprintf(hash, "library=%s\n%s\n", library.Name, library.SHA256)
+		switch {
+		case library.Image != nil:
+			fmt.Fprintf(hash, "%s\n%s\n", library.Image.Image, library.Image.Path)
+		case library.S3 != nil:
+			fmt.Fprintf(hash, "%s\n%s\n", library.S3.Bucket, library.S3.Key)
+		default:
+			fmt.Fprintf(hash, "%s\n", library.URL)
+		}
+	}
+	return fmt.Sprintf("%s-%s-%s", clusterName, SchemaComponentName, hex.EncodeToString(hash.Sum(nil))[:8])
+}
+
+// GetSchemaJobLabels returns the labels selecting the schema Jobs of a cluster.
+func GetSchemaJobLabels(clusterInfo reconciler.ClusterInfo) map[string]string {
+	labels := clusterInfo.GetLabels()
+	labels[constants.LabelKubernetesComponent] = SchemaComponentName
+	return labels
+}
+
+var _ builder.JobBuilder = &SchemaJobBuilder{}
+
+// SchemaJobBuilder builds the Job running `schematool -initOrUpgradeSchema` against the configured database.
+type SchemaJobBuilder struct {
+	builder.Job
+	ClusterConfig *hivev1alpha1.ClusterConfigSpec
+	// Libraries of the metastore role, e.g. the JDBC driver of the database.
+	Libraries []hivev1alpha1.LibrarySpec
+}
+
+func NewSchemaJobBuilder(
+	client *client.Client,
+	name string,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	libraries []hivev1alpha1.LibrarySpec,
+	image *util.Image,
+	options ...builder.Option,
+) *SchemaJobBuilder {
+	return &SchemaJobBuilder{
+		Job: builder.Job{
+			BaseWorkloadBuilder: *builder.NewBaseWorkloadBuilder(
+				client,
+				name,
+				image,
+				nil,
+				nil,
+				options...,
+			),
+		},
+		ClusterConfig: clusterConfig,
+		Libraries:     libraries,
+	}
+}
+
+func (b *SchemaJobBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
+	dbConfig, err := NewDatabaseConfig(b.ClusterConfig.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	librariesConfig, err := GetLibrariesConfig(ctx, b.Client, b.Libraries)
+	if err != nil {
+		return nil, err
+	}
+
+	container := b.getMainContainer(dbConfig)
+	b.AddVolumes(b.getVolumes(dbConfig))
+	if waitContainer := dbConfig.GetWaitInitContainer(b.GetImage()); waitContainer != nil {
+		b.AddInitContainer(waitContainer)
+	}
+	if librariesConfig != nil {
+		container.Env = append(container.Env, librariesConfig.GetEnv()...)
+		container.VolumeMounts = append(container.VolumeMounts, librariesConfig.GetVolumeMounts()...)
+		b.AddInitContainers(librariesConfig.GetInitContainers(b.GetImage()))
+		b.AddVolumes(librariesConfig.GetVolumes())
+	}
+	b.AddContainer(container)
+	b.SetRestPolicy(ptr.To(corev1.RestartPolicyNever))
+
+	obj, err := b.GetObject()
+	if err != nil {
+		return nil, err
+	}
+
+	obj.Spec.BackoffLimit = ptr.To[int32](schemaJobBackoffLimit)
+	return obj, nil
+}
+
+func (b *SchemaJobBuilder) getMainContainer(dbConfig *DatabaseConfig) *corev1.Container {
+	container := builder.NewContainer(SchemaComponentName, b.GetImage())
+	container.SetCommand([]string{"sh", "-euo", "pipefail", "-c"}).
+		SetArgs(b.getCommandArgs(dbConfig)).
+		AddEnvVars(append(dbConfig.GetEnv(), corev1.EnvVar{
+			Name:  "HIVE_CONF_DIR",
+			Value: constants.KubedoopConfigDir,
+		})).
+		AddVolumeMounts(b.getVolumeMounts(dbConfig))
+
+	obj := container.Build()
+	// The schema version is written to the termination message on success,
+	// failures fall back to the tail of the log.
+	obj.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	return obj
+}
+
+func (b *SchemaJobBuilder) getVolumes(dbConfig *DatabaseConfig) []corev1.Volume {
+	volumes := []corev1.Volume{
+		{
+			Name: schemaConfigVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+	return append(volumes, dbConfig.GetVolumes()...)
+}
+
+func (b *SchemaJobBuilder) getVolumeMounts(dbConfig *DatabaseConfig) []corev1.VolumeMount {
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      schemaConfigVolumeName,
+			MountPath: constants.KubedoopConfigDir,
+		},
+	}
+	return append(volumeMounts, dbConfig.GetVolumeMounts()...)
+}
+
+// getCommandArgs initialises or upgrades the schema, then reports the resulting schema version.
+// The Job has no ConfigMap, schematool reads the credentials from a hive-site.xml written into an emptyDir.
+func (b *SchemaJobBuilder) getCommandArgs(dbConfig *DatabaseConfig) []string {
+	return []string{strings.Join([]string{
+		`
+printf '<?xml version="1.0"?>\n<configuration>\n</configuration>\n' > ` + path.Join(constants.KubedoopConfigDir, "hive-site.xml") + `
+`,
+		dbConfig.GetContainerCommandArgs(),
+		`
+bin/schematool -dbType "$DB_DRIVER" -initOrUpgradeSchema
+bin/schematool -dbType "$DB_DRIVER" -info | sed -n 's/^Metastore schema version:[[:space:]]*//p' > /dev/termination-log
+`,
+	}, "\n")}
+}
+
+var _ reconciler.Reconciler = &SchemaReconciler{}
+
+// SchemaReconciler creates the schema Job and holds back the following resources until it succeeded.
+// It is registered before the role reconcilers, and the cluster reconciler stops at the first
+// resource returning a non-zero result, so the StatefulSets are only updated once the schema is migrated.
+type SchemaReconciler struct {
+	*reconciler.Job
+	// Labels select the schema Jobs of the cluster, the Jobs of previous migrations are deleted with them.
+	Labels map[string]string
+}
+
+func NewSchemaReconciler(
+	client *client.Client,
+	clusterInfo reconciler.ClusterInfo,
+	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	libraries []hivev1alpha1.LibrarySpec,
+	image *util.Image,
+) *SchemaReconciler {
+	labels := GetSchemaJobLabels(clusterInfo)
+	b := NewSchemaJobBuilder(
+		client,
+		GetSchemaJobName(clusterInfo.ClusterName, image, clusterConfig, libraries),
+		clusterConfig,
+		libraries,
+		image,
+		func(o *builder.Options) {
+			o.ClusterName = clusterInfo.ClusterName
+			o.RoleName = SchemaComponentName
+			o.Labels = labels
+			o.Annotations = clusterInfo.GetAnnotations()
+		},
+	)
+
+	return &SchemaReconciler{
+		Job:    reconciler.NewJob(client, b),
+		Labels: labels,
+	}
+}
+
+func (r *SchemaReconciler) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	obj, err := r.GetBuilder().Build(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The Job name changes with its inputs, an existing Job is never updated.
+	if err := r.Client.CreateDoesNotExist(ctx, obj); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	job := obj.(*batchv1.Job)
+	if failed, message := isJobFailed(job); failed {
+		return ctrl.Result{}, fmt.Errorf("schema job %s failed: %s", job.Name, message)
+	}
+	if job.Status.Succeeded > 0 {
+		return ctrl.Result{}, deleteStaleJobs(ctx, r.Client, r.Labels, job.Name)
+	}
+
+	log.Info("Waiting for schema job to complete", "namespace", job.Namespace, "name", job.Name)
+	return ctrl.Result{RequeueAfter: r.ReadyRequeueAfter}, nil
+}
+
+func (r *SchemaReconciler) Ready(ctx context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
+
+// deleteStaleJobs deletes the Jobs selected by the labels except the current one, once it succeeded.
+// A TTL cannot be used instead, the current Job would be created and run again after its deletion.
+func deleteStaleJobs(ctx context.Context, c *client.Client, labels map[string]string, current string) error {
+	jobs := &batchv1.JobList{}
+	if err := c.Client.List(ctx, jobs, ctrlclient.InNamespace(c.GetOwnerNamespace()), ctrlclient.MatchingLabels(labels)); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Name == current {
+			continue
+		}
+		log.V(1).Info("Deleting stale job", "namespace", job.Namespace, "name", job.Name)
+		if err := c.Client.Delete(ctx, job, ctrlclient.PropagationPolicy(metav1.DeletePropagationBackground)); ctrlclient.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isJobFailed returns whether the Job has failed and the reason reported by the Job controller.
+func isJobFailed(job *batchv1.Job) (bool, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true, strings.TrimSpace(condition.Reason + ": " + condition.Message)
+		}
+	}
+	return false, ""
+}
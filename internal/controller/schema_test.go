@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func TestGetSchemaJobName(t *testing.T) {
+	image := util.NewImage(hivev1alpha1.DefaultProductName, "0.0.0-dev", hivev1alpha1.DefaultProductVersion)
+	newClusterConfig := func(mutate func(*hivev1alpha1.DatabaseSpec)) *hivev1alpha1.ClusterConfigSpec {
+		database := &hivev1alpha1.DatabaseSpec{
+			DatabaseType:      DatabaseTypePostgres,
+			Host:              "postgres",
+			DatabaseName:      "hive",
+			CredentialsSecret: "hive-credentials",
+		}
+		if mutate != nil {
+			mutate(database)
+		}
+		return &hivev1alpha1.ClusterConfigSpec{Database: database}
+	}
+	name := GetSchemaJobName("hive", image, newClusterConfig(nil), nil)
+
+	tests := []struct {
+		name   string
+		mutate func(*hivev1alpha1.DatabaseSpec)
+		same   bool
+	}{
+		{name: "unchanged", same: true},
+		{name: "credentials", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.CredentialsSecret = "other" }, same: true},
+		{name: "host", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.Host = "postgres-new" }},
+		{name: "port", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.Port = 5433 }},
+		{name: "databaseName", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.DatabaseName = "metastore" }},
+		{name: "sslMode", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.SSLMode = "require" }},
+		{name: "parameters", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.Parameters = map[string]string{"currentSchema": "hive"} }},
+		{name: "connString", mutate: func(d *hivev1alpha1.DatabaseSpec) { d.ConnString = "jdbc:postgresql://other:5432/hive" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetSchemaJobName("hive", image, newClusterConfig(tt.mutate), nil)
+			if (got == name) != tt.same {
+				t.Errorf("GetSchemaJobName() = %s, base %s, expected same=%v", got, name, tt.same)
+			}
+		})
+	}
+}
+
+func TestDeleteStaleJobs(t *testing.T) {
+	labels := map[string]string{constants.LabelKubernetesInstance: "hive", constants.LabelKubernetesComponent: SchemaComponentName}
+	newJob := func(name string, labels map[string]string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: labels}}
+	}
+	otherCluster := map[string]string{constants.LabelKubernetesInstance: "other", constants.LabelKubernetesComponent: SchemaComponentName}
+	c := newTestClient(t,
+		newJob("hive-schema-current", labels),
+		newJob("hive-schema-previous", labels),
+		newJob("other-schema-previous", otherCluster),
+	)
+
+	if err := deleteStaleJobs(context.Background(), c, labels, "hive-schema-current"); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := c.Client.List(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, job := range jobs.Items {
+		names = append(names, job.Name)
+	}
+	if expected := []string{"hive-schema-current", "other-schema-previous"}; !slices.Equal(names, expected) {
+		t.Errorf("jobs = %v, expected %v", names, expected)
+	}
+}
@@ -2,8 +2,13 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"maps"
 	"path"
+	"slices"
 	"strings"
 
 	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
@@ -14,7 +19,9 @@ import (
 	"github.com/zncdatadev/operator-go/pkg/util"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/ptr"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -41,19 +48,62 @@ var (
 			Name:          constant.MetricsPortName,
 		},
 	}
+
+	HiveServer2ContainerPort = []corev1.ContainerPort{
+		{
+			ContainerPort: constant.HiveServer2Port,
+			Protocol:      corev1.ProtocolTCP,
+			Name:          constant.HiveServer2PortName,
+		},
+		{
+			ContainerPort: constant.HiveServer2WebUIPort,
+			Protocol:      corev1.ProtocolTCP,
+			Name:          constant.HiveServer2WebUIPortName,
+		},
+		{
+			ContainerPort: constant.MetricsPort,
+			Protocol:      corev1.ProtocolTCP,
+			Name:          constant.MetricsPortName,
+		},
+	}
 )
 
+// GetContainerPorts returns the container ports of the given role.
+func GetContainerPorts(roleName string) []corev1.ContainerPort {
+	if roleName == HiveServer2RoleName {
+		return HiveServer2ContainerPort
+	}
+	return ContainerPort
+}
+
+// getServicePortName returns the name of the port serving the role's thrift protocol,
+// it is used by the probes of the main container.
+func getServicePortName(roleName string) string {
+	if roleName == HiveServer2RoleName {
+		return constant.HiveServer2PortName
+	}
+	return MetastorePortName
+}
+
 var _ builder.StatefulSetBuilder = &StatefulSetBuilder{}
 
 type StatefulSetBuilder struct {
 	builder.StatefulSet
 	ClusterConfig *hivev1alpha1.ClusterConfigSpec
+
+	// ConfigMapBuilder renders the rolegroup ConfigMap, its content is hashed
+	// into the pod template so that configuration changes roll the pods.
+	ConfigMapBuilder *ConfigMapBuilder
+
+	Ports []corev1.ContainerPort
 }
 
 func NewStatefulSetBuilder(
 	client *client.Client,
 	name string,
 	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	configMapBuilder *ConfigMapBuilder,
+	ports []corev1.ContainerPort,
 	replicas *int32,
 	image *util.Image,
 	overrides *commonsv1alpha1.OverridesSpec,
@@ -76,43 +126,177 @@ func NewStatefulSetBuilder(
 			roleGroupConfig,
 			options...,
 		),
-		ClusterConfig: clusterConfig,
+		ClusterConfig:    clusterConfig,
+		ConfigMapBuilder: configMapBuilder,
+		Ports:            ports,
 	}
 }
 
 func (b *StatefulSetBuilder) Build(ctx context.Context) (ctrlclient.Object, error) {
-	var s3Config *S3Config
-	if b.ClusterConfig.S3 != nil {
-		s3Connection, err := GetS3Connect(ctx, b.Client, b.ClusterConfig.S3)
+	s3Config, err := GetS3Config(ctx, b.Client, b.ClusterConfig.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	var kerberosConfig *KerberosConfig
+	if IsKerberosEnabled(b.ClusterConfig) {
+		kerberosConfig = NewKerberosConfig(b.ClusterConfig.Authentication.Kerberos, b.Client.GetOwnerNamespace(), b.Name, b.RoleName)
+		// The HDFS client config references the kerberos realm of the HDFS principals.
+		kerberosConfig.HdfsEnabled = b.ClusterConfig.HDFS != nil
+	}
+
+	var tlsConfig *TlsConfig
+	if IsTlsEnabled(b.ClusterConfig) {
+		tlsConfig = NewTlsConfig(b.ClusterConfig.Authentication.Tls, b.Name, b.RoleName)
+	}
+
+	// Only the metastore connects to the backing database.
+	var dbConfig *DatabaseConfig
+	if b.RoleName == MetastoreRoleName {
+		// database is required in ClusterConfig
+		dbConfig, err = NewDatabaseConfig(b.ClusterConfig.Database)
 		if err != nil {
 			return nil, err
 		}
-		s3Config = NewS3Config(s3Connection)
 	}
 
-	var kerberosConfig *KerberosConfig
-	if b.ClusterConfig.Authentication != nil {
-		kerberosConfig = NewKerberosConfig(
-			b.Client.GetOwnerNamespace(),
-			b.ClusterName,
-			b.RoleName,
-			b.ClusterConfig.Authentication.Kerberos.SecretClass,
-		)
+	librariesConfig, err := GetLibrariesConfig(ctx, b.Client, b.getLibraries())
+	if err != nil {
+		return nil, err
 	}
 
-	b.AddContainer(b.getMainContainer(kerberosConfig, s3Config).Build())
-	b.AddVolumes(b.getVolumes(s3Config, kerberosConfig))
+	b.AddContainer(b.getMainContainer(kerberosConfig, s3Config, tlsConfig, dbConfig, librariesConfig).Build())
+	b.AddVolumes(b.getVolumes(s3Config, kerberosConfig, tlsConfig, dbConfig))
+	if dbConfig != nil {
+		if waitContainer := dbConfig.GetWaitInitContainer(b.GetImage()); waitContainer != nil {
+			b.AddInitContainer(waitContainer)
+		}
+	}
+	if librariesConfig != nil {
+		b.AddInitContainers(librariesConfig.GetInitContainers(b.GetImage()))
+		b.AddVolumes(librariesConfig.GetVolumes())
+	}
+	if dbConfig != nil {
+		b.AddVolumeClaimTemplates(dbConfig.GetVolumeClaimTemplates())
+	}
 
 	obj, err := b.GetObject()
 	if err != nil {
 		return nil, err
 	}
 
+	// The embedded derby database is written to the PVC, which has to be writable by the product user.
+	if dbConfig != nil && dbConfig.IsEmbedded() {
+		securityContext := obj.Spec.Template.Spec.SecurityContext
+		if securityContext == nil {
+			securityContext = &corev1.PodSecurityContext{}
+		}
+		securityContext.FSGroup = ptr.To[int64](constant.KubedoopGroupID)
+		securityContext.FSGroupChangePolicy = ptr.To(corev1.FSGroupChangeOnRootMismatch)
+		obj.Spec.Template.Spec.SecurityContext = securityContext
+	}
+
 	b.setupVector(obj)
 
+	if err := b.setConfigHash(ctx, obj, s3Config); err != nil {
+		return nil, err
+	}
+
 	return obj, nil
 }
 
+// setConfigHash annotates the pod template with a hash of the rendered ConfigMap,
+// the resolved S3 connections and the resourceVersion of the database credentials secret.
+// Pods only copy the configuration at startup, so any change has to restart them.
+func (b *StatefulSetBuilder) setConfigHash(ctx context.Context, obj *appsv1.StatefulSet, s3Config *S3Config) error {
+	hash := sha256.New()
+
+	if b.ConfigMapBuilder != nil {
+		cm, err := b.ConfigMapBuilder.Build(ctx)
+		if err != nil {
+			return err
+		}
+		data := cm.(*corev1.ConfigMap).Data
+		for _, key := range slices.Sorted(maps.Keys(data)) {
+			fmt.Fprintf(hash, "%s=%s\n", key, data[key])
+		}
+	}
+
+	if s3Config != nil {
+		if s3Config.S3Connection != nil {
+			writeS3ConnectionHash(hash, "s3", s3Config.S3Connection)
+		}
+		for _, bucket := range s3Config.Buckets {
+			writeS3ConnectionHash(hash, "s3.bucket."+bucket.Name, bucket.S3Connection)
+		}
+	}
+
+	if err := b.writeDatabaseSecretsHash(ctx, hash); err != nil {
+		return err
+	}
+
+	// The pod template shares its annotations map with the object meta, so copy it before writing.
+	annotations := maps.Clone(obj.Spec.Template.Annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[constant.AnnotationConfigHash] = hex.EncodeToString(hash.Sum(nil))
+	obj.Spec.Template.Annotations = annotations
+	return nil
+}
+
+// writeDatabaseSecretsHash writes the resourceVersions of the Secrets the database credentials and CA are
+// mounted from. The Secrets of a credentials SecretClass are found by the class label secret-operator
+// searches for in the namespace of the pod.
+func (b *StatefulSetBuilder) writeDatabaseSecretsHash(ctx context.Context, w io.Writer) error {
+	database := b.ClusterConfig.Database
+	secretNames := map[string]string{"database.credentials": database.CredentialsSecret}
+	if database.Tls != nil {
+		secretNames["database.tls"] = database.Tls.Secret
+	}
+	for _, key := range slices.Sorted(maps.Keys(secretNames)) {
+		if secretNames[key] == "" {
+			continue
+		}
+		// The Get of the operator-go client resolves the kind from the scheme, which does not know
+		// PartialObjectMetadata, so the metadata is read with the controller-runtime client.
+		secret := newSecretMetadata()
+		secretKey := ctrlclient.ObjectKey{Namespace: b.Client.GetOwnerNamespace(), Name: secretNames[key]}
+		if err := b.Client.GetCtrlClient().Get(ctx, secretKey, secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%s=%s\n", key, secret.ResourceVersion)
+	}
+
+	if database.Credentials != nil {
+		secrets := &metav1.PartialObjectMetadataList{}
+		secrets.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("SecretList"))
+		if err := b.Client.GetCtrlClient().List(
+			ctx,
+			secrets,
+			ctrlclient.InNamespace(b.Client.GetOwnerNamespace()),
+			ctrlclient.MatchingLabels{SecretClassLabel: database.Credentials.SecretClass},
+		); err != nil {
+			return err
+		}
+		slices.SortFunc(secrets.Items, func(a, b metav1.PartialObjectMetadata) int { return strings.Compare(a.Name, b.Name) })
+		for _, secret := range secrets.Items {
+			fmt.Fprintf(w, "database.credentials.%s=%s\n", secret.Name, secret.ResourceVersion)
+		}
+	}
+	return nil
+}
+
+func writeS3ConnectionHash(w io.Writer, prefix string, s3Connection *S3Connection) {
+	fmt.Fprintf(w, "%s.endpoint=%s\n%s.pathStyle=%t\n", prefix, s3Connection.Endpoint.String(), prefix, s3Connection.PathStyle)
+	if s3Connection.credential != nil {
+		fmt.Fprintf(w, "%s.secretClass=%s\n", prefix, s3Connection.credential.SecretClass)
+	}
+}
+
 func (b *StatefulSetBuilder) setupVector(obj *appsv1.StatefulSet) {
 	if b.RoleGroupConfig != nil && b.RoleGroupConfig.Logging != nil && *b.RoleGroupConfig.Logging.EnableVectorAgent {
 		vectorFactory := builder.NewVector(
@@ -130,23 +314,29 @@ func (b *StatefulSetBuilder) setupVector(obj *appsv1.StatefulSet) {
 	}
 }
 
-func (b *StatefulSetBuilder) getMainContainer(krb5Config *KerberosConfig, s3Config *S3Config) *builder.Container {
+func (b *StatefulSetBuilder) getMainContainer(
+	krb5Config *KerberosConfig,
+	s3Config *S3Config,
+	tlsConfig *TlsConfig,
+	dbConfig *DatabaseConfig,
+	librariesConfig *LibrariesConfig,
+) *builder.Container {
 	container := builder.NewContainer(
 		b.RoleName,
 		b.GetImage(),
 	)
+	portName := getServicePortName(b.RoleName)
 	// Do not use `-x` here: the script exports S3 credentials read from files,
 	// and xtrace would echo the expanded secret values into the container log.
 	container.SetCommand([]string{"sh", "-euo", "pipefail", "-c"}).
-		SetArgs(b.getMainContainerCommandArgs(krb5Config, s3Config)).
-		AddEnvVars(b.getMainContainerEnv(krb5Config)).
-		AddEnvFromSecret(b.ClusterConfig.Database.CredentialsSecret).
-		AddPorts(ContainerPort).
-		AddVolumeMounts(b.getMainContainerVolumeMounts(s3Config, krb5Config)).
+		SetArgs(b.getMainContainerCommandArgs(krb5Config, s3Config, dbConfig)).
+		AddEnvVars(b.getMainContainerEnv(krb5Config, s3Config, dbConfig)).
+		AddPorts(b.Ports).
+		AddVolumeMounts(b.getMainContainerVolumeMounts(s3Config, krb5Config, tlsConfig, dbConfig)).
 		SetReadinessProbe(&corev1.Probe{
 			ProbeHandler: corev1.ProbeHandler{
 				TCPSocket: &corev1.TCPSocketAction{
-					Port: intstr.FromString(MetastorePortName),
+					Port: intstr.FromString(portName),
 				},
 			},
 			InitialDelaySeconds: 10,
@@ -156,7 +346,7 @@ func (b *StatefulSetBuilder) getMainContainer(krb5Config *KerberosConfig, s3Conf
 		SetLivenessProbe(&corev1.Probe{
 			ProbeHandler: corev1.ProbeHandler{
 				TCPSocket: &corev1.TCPSocketAction{
-					Port: intstr.FromString(MetastorePortName),
+					Port: intstr.FromString(portName),
 				},
 			},
 			InitialDelaySeconds: 30,
@@ -164,10 +354,36 @@ func (b *StatefulSetBuilder) getMainContainer(krb5Config *KerberosConfig, s3Conf
 			FailureThreshold:    5,
 		})
 
+	if librariesConfig != nil {
+		container.AddEnvVars(librariesConfig.GetEnv()).
+			AddVolumeMounts(librariesConfig.GetVolumeMounts())
+	}
+
 	return container
 }
 
-func (b *StatefulSetBuilder) getMainContainerCommandArgs(krb5Config *KerberosConfig, S3Config *S3Config) []string {
+// getLibraries returns the libraries of the merged role and rolegroup config.
+func (b *StatefulSetBuilder) getLibraries() []hivev1alpha1.LibrarySpec {
+	if b.ConfigMapBuilder == nil || b.ConfigMapBuilder.RoleGroupConfig == nil {
+		return nil
+	}
+	return b.ConfigMapBuilder.RoleGroupConfig.Libraries
+}
+
+func (b *StatefulSetBuilder) getStartCommand() string {
+	if b.RoleName == HiveServer2RoleName {
+		return `bin/hive --config ` + constants.KubedoopConfigDir + ` --service hiveserver2 &`
+	}
+	// The schema of an embedded derby database lives in the pod, so it is created at startup.
+	// Other databases are migrated by the schema Job before the metastore is rolled out.
+	if !IsSchemaJobEnabled(b.ClusterConfig.Database) {
+		return `DB_TYPE="${DB_DRIVER:-derby}"
+bin/start-metastore --config ` + constants.KubedoopConfigDir + ` --db-type $DB_TYPE --hive-bin-dir bin &`
+	}
+	return `bin/hive --config ` + constants.KubedoopConfigDir + ` --service metastore &`
+}
+
+func (b *StatefulSetBuilder) getMainContainerCommandArgs(krb5Config *KerberosConfig, S3Config *S3Config, dbConfig *DatabaseConfig) []string {
 	shutdownFile := path.Join(constants.KubedoopLogDir, "_vector", "shutdown")
 	args := []string{
 		`
@@ -183,14 +399,18 @@ cp -RL ` + path.Join(constants.KubedoopConfigDirMount, "*") + ` ` + path.Join(co
 	if S3Config != nil {
 		args = append(args, S3Config.GetContainerCommandArgs())
 	}
+
+	if dbConfig != nil {
+		args = append(args, dbConfig.GetContainerCommandArgs())
+	}
+
 	args = append(
 		args,
 		util.CommonBashTrapFunctions,
 		`
 rm -f `+shutdownFile+`
 `+util.InvokePrepareSignalHandlers+`
-DB_TYPE="${DB_DRIVER:-derby}"
-bin/start-metastore --config `+constants.KubedoopConfigDir+` --db-type $DB_TYPE --hive-bin-dir bin &
+`+b.getStartCommand()+`
 `+util.InvokeWaitForTermination+`
 
 `+util.CreateVectorShutdownFileCommand()+`
@@ -222,58 +442,26 @@ func (b *StatefulSetBuilder) getJVMOpts(
 	}
 }
 
-func (b *StatefulSetBuilder) getMainContainerEnv(krb5Config *KerberosConfig) []corev1.EnvVar {
-
-	jvmOpts := []string{}
-	// database is required in ClusterConfig
-	database := b.ClusterConfig.Database
-
-	switch database.DatabaseType {
-	case "mysql":
-		jvmOpts = append(jvmOpts,
-			"-Djavax.jdo.option.ConnectionURL="+database.ConnString,
-			"-Djavax.jdo.option.ConnectionDriverName=com.mysql.cj.jdbc.Driver")
-	case "postgres":
-		jvmOpts = append(jvmOpts,
-			"-Djavax.jdo.option.ConnectionURL="+database.ConnString,
-			"-Djavax.jdo.option.ConnectionDriverName=org.postgresql.Driver")
-	case "oracle":
-		jvmOpts = append(jvmOpts,
-			"-Djavax.jdo.option.ConnectionURL="+database.ConnString,
-			"-Djavax.jdo.option.ConnectionDriverName=oracle.jdbc.OracleDriver")
-	case "derby":
-		jvmOpts = append(jvmOpts,
-			"-Djavax.jdo.option.ConnectionURL="+database.ConnString,
-			"-Djavax.jdo.option.ConnectionDriverName=org.apache.derby.jdbc.EmbeddedDriver")
-	default:
-		jvmOpts = append(jvmOpts,
-			"-Djavax.jdo.option.ConnectionURL=jdbc:derby:/tmp/metastore_db;create=true",
-			"-Djavax.jdo.option.ConnectionDriverName=org.apache.derby.jdbc.EmbeddedDriver")
-	}
-
-	if database.DatabaseType != "derby" {
-		// pass by env secret from database.credentials
-		jvmOpts = append(jvmOpts,
-			"-Djavax.jdo.option.ConnectionUserName=$(username)",
-			"-Djavax.jdo.option.ConnectionPassword=$(password)",
-		)
-	}
-
+func (b *StatefulSetBuilder) getMainContainerEnv(krb5Config *KerberosConfig, s3Config *S3Config, dbConfig *DatabaseConfig) []corev1.EnvVar {
 	env := []corev1.EnvVar{
 		{
 			Name:  "SERVICE_NAME",
-			Value: "metastore",
-		},
-		{
-			Name:  "HADOOP_CLIENT_OPTS",
-			Value: strings.Join(jvmOpts, " "),
-		},
-		{
-			Name:  "DB_DRIVER",
-			Value: database.DatabaseType,
+			Value: b.RoleName,
 		},
 	}
 
+	// Hadoop reads the core-site.xml and hdfs-site.xml merged from the HDFS discovery ConfigMap.
+	if b.ClusterConfig.HDFS != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "HADOOP_CONF_DIR",
+			Value: constants.KubedoopConfigDir,
+		})
+	}
+
+	if dbConfig != nil {
+		env = append(env, dbConfig.GetEnv()...)
+	}
+
 	jvmEnvs := make([]corev1.EnvVar, 0)
 
 	if krb5Config != nil {
@@ -287,12 +475,16 @@ func (b *StatefulSetBuilder) getMainContainerEnv(krb5Config *KerberosConfig) []c
 		}
 	}
 
+	if s3Config != nil {
+		jvmEnvs = append(jvmEnvs, s3Config.GetEnv()...)
+	}
+
 	env = append(env, b.getJVMOpts(jvmEnvs))
 
 	return env
 }
 
-func (b *StatefulSetBuilder) getVolumes(s3Config *S3Config, krb5Cofig *KerberosConfig) []corev1.Volume {
+func (b *StatefulSetBuilder) getVolumes(s3Config *S3Config, krb5Cofig *KerberosConfig, tlsConfig *TlsConfig, dbConfig *DatabaseConfig) []corev1.Volume {
 	volumes := []corev1.Volume{
 		{
 			Name: MatestoreConfigmapVolumeName,
@@ -322,10 +514,18 @@ func (b *StatefulSetBuilder) getVolumes(s3Config *S3Config, krb5Cofig *KerberosC
 		volumes = append(volumes, krb5Cofig.GetVolumes()...)
 	}
 
+	if tlsConfig != nil {
+		volumes = append(volumes, tlsConfig.GetVolumes()...)
+	}
+
+	if dbConfig != nil {
+		volumes = append(volumes, dbConfig.GetVolumes()...)
+	}
+
 	return volumes
 }
 
-func (b *StatefulSetBuilder) getMainContainerVolumeMounts(s3Config *S3Config, krb5Cofig *KerberosConfig) []corev1.VolumeMount {
+func (b *StatefulSetBuilder) getMainContainerVolumeMounts(s3Config *S3Config, krb5Cofig *KerberosConfig, tlsConfig *TlsConfig, dbConfig *DatabaseConfig) []corev1.VolumeMount {
 	volumeMounts := []corev1.VolumeMount{
 		{
 			Name:      MatestoreConfigmapVolumeName,
@@ -345,6 +545,14 @@ func (b *StatefulSetBuilder) getMainContainerVolumeMounts(s3Config *S3Config, kr
 		volumeMounts = append(volumeMounts, krb5Cofig.GetVolumeMounts()...)
 	}
 
+	if tlsConfig != nil {
+		volumeMounts = append(volumeMounts, tlsConfig.GetVolumeMounts()...)
+	}
+
+	if dbConfig != nil {
+		volumeMounts = append(volumeMounts, dbConfig.GetVolumeMounts()...)
+	}
+
 	return volumeMounts
 }
 
@@ -352,6 +560,7 @@ func NewStatefulSetReconciler(
 	client *client.Client,
 	roleGroupInfo reconciler.RoleGroupInfo,
 	clusterConfig *hivev1alpha1.ClusterConfigSpec,
+	configMapBuilder *ConfigMapBuilder,
 	ports []corev1.ContainerPort,
 	image *util.Image,
 	replicas *int32,
@@ -365,6 +574,8 @@ func NewStatefulSetReconciler(
 		client,
 		roleGroupInfo.GetFullName(),
 		clusterConfig,
+		configMapBuilder,
+		ports,
 		replicas,
 		image,
 		overrides,
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/constant"
+)
+
+func TestStatefulSetBuilderSetConfigHash(t *testing.T) {
+	ctx := context.Background()
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hive-credentials", Namespace: "ns"},
+		StringData: map[string]string{"username": "hive"},
+	}
+	c := newTestClient(t, credentials)
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypePostgres, CredentialsSecret: "hive-credentials"},
+	}
+	b := NewStatefulSetBuilder(c, "hive-metastore-default", clusterConfig, nil, ContainerPort, nil, nil, nil, nil)
+	s3Config := NewS3Config(&S3Connection{Endpoint: url.URL{Scheme: "http", Host: "minio:9000"}}, nil)
+
+	hash := func(s3Config *S3Config) string {
+		t.Helper()
+		obj := &appsv1.StatefulSet{}
+		if err := b.setConfigHash(ctx, obj, s3Config); err != nil {
+			t.Fatal(err)
+		}
+		return obj.Spec.Template.Annotations[constant.AnnotationConfigHash]
+	}
+
+	initial := hash(s3Config)
+	if initial == "" {
+		t.Fatal("setConfigHash() did not annotate the pod template")
+	}
+	if again := hash(s3Config); again != initial {
+		t.Errorf("hash of the same config = %s, expected %s", again, initial)
+	}
+
+	moved := NewS3Config(&S3Connection{Endpoint: url.URL{Scheme: "http", Host: "minio:9001"}}, nil)
+	if changed := hash(moved); changed == initial {
+		t.Error("hash did not change with the S3 endpoint")
+	}
+
+	credentials.StringData = map[string]string{"username": "metastore"}
+	if err := c.Client.Update(ctx, credentials); err != nil {
+		t.Fatal(err)
+	}
+	if changed := hash(s3Config); changed == initial {
+		t.Error("hash did not change with the credentials secret")
+	}
+}
+
+func TestStatefulSetBuilderSetConfigHashSecretClass(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	clusterConfig := &hivev1alpha1.ClusterConfigSpec{
+		Database: &hivev1alpha1.DatabaseSpec{
+			DatabaseType: DatabaseTypePostgres,
+			Credentials:  &hivev1alpha1.DatabaseCredentialsSpec{Credentials: commonsv1alpha1.Credentials{SecretClass: "postgres"}},
+		},
+	}
+	b := NewStatefulSetBuilder(c, "hive-metastore-default", clusterConfig, nil, ContainerPort, nil, nil, nil, nil)
+
+	// The annotations of the pod template are shared with another object, they must not be modified.
+	shared := map[string]string{"team": "data"}
+	obj := &appsv1.StatefulSet{}
+	obj.Spec.Template.Annotations = shared
+	if err := b.setConfigHash(ctx, obj, nil); err != nil {
+		t.Fatal(err)
+	}
+	initial := obj.Spec.Template.Annotations[constant.AnnotationConfigHash]
+	if _, ok := shared[constant.AnnotationConfigHash]; ok {
+		t.Error("setConfigHash() modified the shared annotations")
+	}
+	if obj.Spec.Template.Annotations["team"] != "data" {
+		t.Error("setConfigHash() dropped the existing annotations")
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "postgres-credentials", Namespace: "ns", Labels: map[string]string{SecretClassLabel: "postgres"},
+	}}
+	if err := c.Client.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	obj = &appsv1.StatefulSet{}
+	if err := b.setConfigHash(ctx, obj, nil); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Spec.Template.Annotations[constant.AnnotationConfigHash] == initial {
+		t.Error("hash did not change with the secrets of the credentials SecretClass")
+	}
+}
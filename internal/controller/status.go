@@ -0,0 +1,549 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	"github.com/zncdatadev/operator-go/pkg/reconciler"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/constant"
+)
+
+const (
+	conditionReasonAvailable          = "Available"
+	conditionReasonUnavailable        = "Unavailable"
+	conditionReasonRollingOut         = "RollingOut"
+	conditionReasonUpToDate           = "UpToDate"
+	conditionReasonReconcileError     = "ReconcileError"
+	conditionReasonReconcileSucceeded = "ReconcileSucceeded"
+	conditionReasonPaused             = "Paused"
+	conditionReasonNotPaused          = "NotPaused"
+	conditionReasonStopped            = "Stopped"
+	conditionReasonRunning            = "Running"
+	conditionReasonValid              = "Valid"
+	conditionReasonReachable          = "Reachable"
+	conditionReasonUnreachable        = "Unreachable"
+	conditionReasonEmbedded           = "Embedded"
+	conditionReasonUnknownAddress     = "UnknownAddress"
+	conditionReasonNotProbed          = "NotProbed"
+	conditionReasonOverBudget         = "OverBudget"
+	conditionReasonWithinBudget       = "WithinBudget"
+)
+
+// StatusUpdater aggregates the rolegroup StatefulSets of a HiveMetastore into its status.
+type StatusUpdater struct {
+	Client   ctrlclient.Client
+	Instance *hivev1alpha1.HiveMetastore
+	Roles    map[string]*hivev1alpha1.RoleSpec
+	// Restore is the restore status observed by the reconciliation, if it got to observe it.
+	Restore *hivev1alpha1.RestoreStatus
+	// DatabaseProbes rate-limits the reachability checks of the database, every update probes it when nil.
+	DatabaseProbes *DatabaseProbes
+}
+
+func NewStatusUpdater(client ctrlclient.Client, instance *hivev1alpha1.HiveMetastore) *StatusUpdater {
+	roles := map[string]*hivev1alpha1.RoleSpec{}
+	if instance.Spec.Metastore != nil {
+		roles[MetastoreRoleName] = instance.Spec.Metastore
+	}
+	if instance.Spec.HiveServer2 != nil {
+		roles[HiveServer2RoleName] = instance.Spec.HiveServer2
+	}
+	return &StatusUpdater{
+		Client:   client,
+		Instance: instance,
+		Roles:    roles,
+	}
+}
+
+// Update recomputes the status from the current StatefulSets and patches it.
+// reconcileErr is the error returned by the cluster reconciler, if any,
+// and is reported with the Degraded condition.
+func (u *StatusUpdater) Update(ctx context.Context, reconcileErr error) error {
+	original := u.Instance.DeepCopy()
+	status := &u.Instance.Status
+
+	roleGroups, err := u.getRoleGroupStatuses(ctx)
+	if err != nil {
+		return err
+	}
+
+	status.RoleGroups = roleGroups
+	status.Replicas = 0
+	status.ReadyReplicas = 0
+	notReady := []string{}
+	rollingOut := []string{}
+	for _, name := range slices.Sorted(maps.Keys(roleGroups)) {
+		rg := roleGroups[name]
+		status.Replicas += rg.Replicas
+		status.ReadyReplicas += rg.ReadyReplicas
+		if rg.ReadyReplicas < rg.Replicas || rg.Replicas == 0 {
+			notReady = append(notReady, name)
+		}
+		if rg.UpdatedReplicas < rg.Replicas || rg.ReadyReplicas < rg.Replicas {
+			rollingOut = append(rollingOut, name)
+		}
+	}
+
+	if err := u.updateSchemaStatus(ctx); err != nil {
+		return err
+	}
+	if err := u.updateBackupStatus(ctx); err != nil {
+		return err
+	}
+	u.updateRestoreStatus()
+
+	u.setStoppedCondition()
+	u.setPausedCondition()
+	u.setAvailableCondition(notReady)
+	u.setProgressingCondition(rollingOut, reconcileErr)
+	u.setDegradedCondition(reconcileErr)
+	u.setSpecValidCondition(reconcileErr)
+	u.setDatabaseReachableCondition(ctx)
+	u.setConnectionBudgetCondition()
+
+	status.ObservedGeneration = u.Instance.Generation
+
+	return u.Client.Status().Patch(ctx, u.Instance, ctrlclient.MergeFrom(original))
+}
+
+func (u *StatusUpdater) getRoleGroupStatuses(ctx context.Context) (map[string]hivev1alpha1.RoleGroupStatus, error) {
+	statuses := map[string]hivev1alpha1.RoleGroupStatus{}
+	for roleName, role := range u.Roles {
+		for roleGroupName := range role.RoleGroups {
+			info := reconciler.RoleGroupInfo{
+				RoleInfo: reconciler.RoleInfo{
+					ClusterInfo: reconciler.ClusterInfo{ClusterName: u.Instance.Name},
+					RoleName:    roleName,
+				},
+				RoleGroupName: roleGroupName,
+			}
+
+			rgStatus := hivev1alpha1.RoleGroupStatus{
+				Role:      roleName,
+				RoleGroup: roleGroupName,
+			}
+
+			sts := &appsv1.StatefulSet{}
+			key := ctrlclient.ObjectKey{Namespace: u.Instance.Namespace, Name: info.GetFullName()}
+			if err := u.Client.Get(ctx, key, sts); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return nil, err
+				}
+			} else {
+				if sts.Spec.Replicas != nil {
+					rgStatus.Replicas = *sts.Spec.Replicas
+				}
+				rgStatus.ReadyReplicas = sts.Status.ReadyReplicas
+				rgStatus.UpdatedReplicas = sts.Status.UpdatedReplicas
+				// The StatefulSet controller has not caught up with the latest spec yet.
+				if sts.Status.ObservedGeneration < sts.Generation {
+					rgStatus.UpdatedReplicas = 0
+				}
+			}
+
+			cm := &corev1.ConfigMap{}
+			if err := u.Client.Get(ctx, key, cm); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return nil, err
+				}
+			} else if keys := cm.Annotations[constant.AnnotationOverriddenConfigKeys]; keys != "" {
+				rgStatus.OverriddenConfigKeys = strings.Split(keys, ",")
+			}
+
+			statuses[roleName+"-"+roleGroupName] = rgStatus
+		}
+	}
+	return statuses, nil
+}
+
+// updateSchemaStatus reports the latest schema Job of the cluster, the previous schema version
+// is kept until a new migration succeeds.
+func (u *StatusUpdater) updateSchemaStatus(ctx context.Context) error {
+	clusterConfig := u.Instance.Spec.ClusterConfig
+	if clusterConfig == nil || clusterConfig.Database == nil || !IsSchemaJobEnabled(clusterConfig.Database) {
+		u.Instance.Status.Schema = nil
+		return nil
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := u.Client.List(ctx, jobs,
+		ctrlclient.InNamespace(u.Instance.Namespace),
+		ctrlclient.MatchingLabels{
+			constants.LabelKubernetesInstance:  u.Instance.Name,
+			constants.LabelKubernetesComponent: SchemaComponentName,
+		},
+	); err != nil {
+		return err
+	}
+	if len(jobs.Items) == 0 {
+		return nil
+	}
+
+	job := slices.MaxFunc(jobs.Items, func(a, b batchv1.Job) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+
+	schema := u.Instance.Status.Schema
+	if schema == nil {
+		schema = &hivev1alpha1.SchemaStatus{}
+	}
+	schema.JobName = job.Name
+
+	if failed, message := isJobFailed(&job); failed {
+		if podMessage, err := getJobPodMessage(ctx, u.Client, u.Instance.Namespace, job.Name, corev1.PodFailed, SchemaComponentName); err != nil {
+			return err
+		} else if podMessage != "" {
+			message = podMessage
+		}
+		schema.Result = hivev1alpha1.SchemaMigrationFailed
+		schema.Message = message
+		schema.LastMigrationTime = getJobConditionTime(&job, batchv1.JobFailed)
+	} else if job.Status.Succeeded > 0 {
+		version, err := getJobPodMessage(ctx, u.Client, u.Instance.Namespace, job.Name, corev1.PodSucceeded, SchemaComponentName)
+		if err != nil {
+			return err
+		}
+		if version != "" {
+			schema.Version = version
+		}
+		schema.Result = hivev1alpha1.SchemaMigrationSucceeded
+		schema.Message = "Schema initialized or upgraded successfully"
+		schema.LastMigrationTime = job.Status.CompletionTime
+	} else {
+		schema.Result = hivev1alpha1.SchemaMigrationRunning
+		schema.Message = "Schema migration is running"
+	}
+
+	u.Instance.Status.Schema = schema
+	return nil
+}
+
+// updateBackupStatus reports the latest backup Job of the cluster and the schedule of its CronJob.
+func (u *StatusUpdater) updateBackupStatus(ctx context.Context) error {
+	clusterConfig := u.Instance.Spec.ClusterConfig
+	if clusterConfig == nil || clusterConfig.Backup == nil {
+		u.Instance.Status.Backup = nil
+		return nil
+	}
+
+	backup := u.Instance.Status.Backup
+	if backup == nil {
+		backup = &hivev1alpha1.BackupStatus{}
+	}
+
+	cronJob := &batchv1.CronJob{}
+	key := ctrlclient.ObjectKey{Namespace: u.Instance.Namespace, Name: GetBackupCronJobName(u.Instance.Name)}
+	if err := u.Client.Get(ctx, key, cronJob); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+	} else {
+		backup.LastScheduleTime = cronJob.Status.LastScheduleTime
+		backup.LastSuccessfulTime = cronJob.Status.LastSuccessfulTime
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := u.Client.List(ctx, jobs,
+		ctrlclient.InNamespace(u.Instance.Namespace),
+		ctrlclient.MatchingLabels{
+			constants.LabelKubernetesInstance:  u.Instance.Name,
+			constants.LabelKubernetesComponent: BackupComponentName,
+		},
+	); err != nil {
+		return err
+	}
+	if len(jobs.Items) == 0 {
+		u.Instance.Status.Backup = backup
+		return nil
+	}
+
+	job := slices.MaxFunc(jobs.Items, func(a, b batchv1.Job) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+	backup.JobName = job.Name
+
+	if failed, message := isJobFailed(&job); failed {
+		podMessage, err := getJobPodMessage(ctx, u.Client, u.Instance.Namespace, job.Name, corev1.PodFailed, backupDumpContainerName, backupUploadContainerName)
+		if err != nil {
+			return err
+		}
+		if podMessage != "" {
+			message = podMessage
+		}
+		backup.Result = hivev1alpha1.BackupFailed
+		backup.Message = message
+	} else if job.Status.Succeeded > 0 {
+		message, err := getJobPodMessage(ctx, u.Client, u.Instance.Namespace, job.Name, corev1.PodSucceeded, backupUploadContainerName)
+		if err != nil {
+			return err
+		}
+		if message == "" {
+			message = "Backup uploaded successfully"
+		}
+		backup.Result = hivev1alpha1.BackupSucceeded
+		backup.Message = message
+	} else {
+		backup.Result = hivev1alpha1.BackupRunning
+		backup.Message = "Backup is running"
+	}
+
+	u.Instance.Status.Backup = backup
+	return nil
+}
+
+// updateRestoreStatus reports the observed restore. The previous status is kept when the reconciliation
+// did not observe the restore, e.g. with an invalid spec, so a completed restore is not run again.
+func (u *StatusUpdater) updateRestoreStatus() {
+	clusterConfig := u.Instance.Spec.ClusterConfig
+	if clusterConfig == nil || clusterConfig.RestoreFrom == nil {
+		u.Instance.Status.Restore = nil
+		return
+	}
+	if u.Restore != nil {
+		u.Instance.Status.Restore = u.Restore
+	}
+}
+
+// getJobPodMessage returns the last line of the termination message of the first of the given
+// containers, init containers included, which terminated in the latest Job pod in the given phase.
+// The schema container writes the schema version on success, failed containers the tail of their log.
+func getJobPodMessage(
+	ctx context.Context,
+	client ctrlclient.Client,
+	namespace string,
+	jobName string,
+	phase corev1.PodPhase,
+	containerNames ...string,
+) (string, error) {
+	pods := &corev1.PodList{}
+	if err := client.List(ctx, pods,
+		ctrlclient.InNamespace(namespace),
+		ctrlclient.MatchingLabels{batchv1.JobNameLabel: jobName},
+	); err != nil {
+		return "", err
+	}
+
+	var latest *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == phase && (latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp)) {
+			latest = pod
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+
+	statuses := append(slices.Clone(latest.Status.InitContainerStatuses), latest.Status.ContainerStatuses...)
+	for _, name := range containerNames {
+		for _, status := range statuses {
+			terminated := status.State.Terminated
+			if status.Name != name || terminated == nil {
+				continue
+			}
+			// A failed Job pod reports the container which failed, not the ones which succeeded before it.
+			if phase == corev1.PodFailed && terminated.ExitCode == 0 {
+				continue
+			}
+			lines := strings.Split(strings.TrimSpace(terminated.Message), "\n")
+			return lines[len(lines)-1], nil
+		}
+	}
+	return "", nil
+}
+
+func getJobConditionTime(job *batchv1.Job, conditionType batchv1.JobConditionType) *metav1.Time {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType {
+			return &condition.LastTransitionTime
+		}
+	}
+	return nil
+}
+
+func (u *StatusUpdater) isStopped() bool {
+	op := u.Instance.Spec.ClusterOperation
+	return op != nil && op.Stopped
+}
+
+func (u *StatusUpdater) isPaused() bool {
+	op := u.Instance.Spec.ClusterOperation
+	return op != nil && op.ReconciliationPaused
+}
+
+func (u *StatusUpdater) setCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	apimeta.SetStatusCondition(&u.Instance.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: u.Instance.Generation,
+	})
+}
+
+func (u *StatusUpdater) setStoppedCondition() {
+	if u.isStopped() {
+		u.setCondition(hivev1alpha1.ConditionTypeStopped, metav1.ConditionTrue, conditionReasonStopped,
+			"The cluster is stopped, all rolegroups are scaled to 0")
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeStopped, metav1.ConditionFalse, conditionReasonRunning,
+		"The cluster is running")
+}
+
+func (u *StatusUpdater) setPausedCondition() {
+	if u.isPaused() {
+		u.setCondition(hivev1alpha1.ConditionTypeReconciliationPaused, metav1.ConditionTrue, conditionReasonPaused,
+			"Reconciliation is paused, changes to the spec are not applied")
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeReconciliationPaused, metav1.ConditionFalse, conditionReasonNotPaused,
+		"Reconciliation is active")
+}
+
+func (u *StatusUpdater) setAvailableCondition(notReady []string) {
+	if u.isStopped() {
+		u.setCondition(hivev1alpha1.ConditionTypeAvailable, metav1.ConditionFalse, conditionReasonStopped,
+			"The cluster is stopped")
+		return
+	}
+	if len(notReady) > 0 {
+		u.setCondition(hivev1alpha1.ConditionTypeAvailable, metav1.ConditionFalse, conditionReasonUnavailable,
+			fmt.Sprintf("Rolegroups not ready: %s", strings.Join(notReady, ", ")))
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeAvailable, metav1.ConditionTrue, conditionReasonAvailable,
+		fmt.Sprintf("%d/%d replicas ready", u.Instance.Status.ReadyReplicas, u.Instance.Status.Replicas))
+}
+
+func (u *StatusUpdater) setProgressingCondition(rollingOut []string, reconcileErr error) {
+	if u.isPaused() {
+		u.setCondition(hivev1alpha1.ConditionTypeProgressing, metav1.ConditionFalse, conditionReasonPaused,
+			"Reconciliation is paused")
+		return
+	}
+	if reconcileErr == nil && len(rollingOut) == 0 {
+		u.setCondition(hivev1alpha1.ConditionTypeProgressing, metav1.ConditionFalse, conditionReasonUpToDate,
+			"All rolegroups are up to date")
+		return
+	}
+	message := "Reconciling resources"
+	if len(rollingOut) > 0 {
+		message = fmt.Sprintf("Rolegroups rolling out: %s", strings.Join(rollingOut, ", "))
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeProgressing, metav1.ConditionTrue, conditionReasonRollingOut, message)
+}
+
+func (u *StatusUpdater) setSpecValidCondition(reconcileErr error) {
+	var specErr *InvalidSpecError
+	if errors.As(reconcileErr, &specErr) {
+		u.setCondition(hivev1alpha1.ConditionTypeSpecValid, metav1.ConditionFalse, specErr.Reason, specErr.Message)
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeSpecValid, metav1.ConditionTrue, conditionReasonValid,
+		"The spec is valid")
+}
+
+// setDatabaseReachableCondition reports whether the operator can open a TCP connection to the database,
+// so an unreachable database is visible in the status instead of only as failing pods.
+func (u *StatusUpdater) setDatabaseReachableCondition(ctx context.Context) {
+	dbConfig, err := NewDatabaseConfig(u.Instance.Spec.ClusterConfig.Database)
+	if err != nil {
+		// Reported by the SpecValid condition.
+		apimeta.RemoveStatusCondition(&u.Instance.Status.Conditions, hivev1alpha1.ConditionTypeDatabaseReachable)
+		return
+	}
+	if dbConfig.IsEmbedded() {
+		u.setCondition(hivev1alpha1.ConditionTypeDatabaseReachable, metav1.ConditionTrue, conditionReasonEmbedded,
+			"The embedded derby database runs in the metastore pod")
+		return
+	}
+	if _, _, err := dbConfig.GetAddress(); err != nil {
+		u.setCondition(hivev1alpha1.ConditionTypeDatabaseReachable, metav1.ConditionUnknown, conditionReasonUnknownAddress,
+			err.Error())
+		return
+	}
+	if u.isStopped() {
+		// Nothing connects to the database while the rolegroups are scaled to 0.
+		u.setCondition(hivev1alpha1.ConditionTypeDatabaseReachable, metav1.ConditionUnknown, conditionReasonNotProbed,
+			"The cluster is stopped, the database is not probed")
+		return
+	}
+	if u.isDatabaseProbeFresh() {
+		return
+	}
+
+	if u.DatabaseProbes != nil {
+		u.DatabaseProbes.Record(ctrlclient.ObjectKeyFromObject(u.Instance), time.Now())
+	}
+	if err := dbConfig.CheckReachable(ctx); err != nil {
+		u.setCondition(hivev1alpha1.ConditionTypeDatabaseReachable, metav1.ConditionFalse, conditionReasonUnreachable,
+			err.Error())
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeDatabaseReachable, metav1.ConditionTrue, conditionReasonReachable,
+		"The database accepts connections")
+}
+
+// isDatabaseProbeFresh reports whether the reachability condition was set by a probe of the current spec
+// less than databaseUnreachableRequeueAfter ago, the interval at which an unreachable database is probed again.
+func (u *StatusUpdater) isDatabaseProbeFresh() bool {
+	if u.DatabaseProbes == nil {
+		return false
+	}
+	condition := apimeta.FindStatusCondition(u.Instance.Status.Conditions, hivev1alpha1.ConditionTypeDatabaseReachable)
+	if condition == nil || condition.ObservedGeneration != u.Instance.Generation ||
+		(condition.Reason != conditionReasonReachable && condition.Reason != conditionReasonUnreachable) {
+		return false
+	}
+	return u.DatabaseProbes.IsFresh(ctrlclient.ObjectKeyFromObject(u.Instance), time.Now(), databaseUnreachableRequeueAfter)
+}
+
+// setConnectionBudgetCondition warns when the pools of the metastore pods may open more connections
+// than the budget of the database, the condition is only reported with a budget.
+func (u *StatusUpdater) setConnectionBudgetCondition() {
+	database := u.Instance.Spec.ClusterConfig.Database
+	if database == nil || database.MaxConnections == nil {
+		apimeta.RemoveStatusCondition(&u.Instance.Status.Conditions, hivev1alpha1.ConditionTypeConnectionBudgetExceeded)
+		return
+	}
+
+	connections, err := GetMetastoreConnections(database, u.Instance.Spec.Metastore)
+	if err != nil {
+		u.setCondition(hivev1alpha1.ConditionTypeConnectionBudgetExceeded, metav1.ConditionUnknown, conditionReasonReconcileError,
+			err.Error())
+		return
+	}
+	if connections > *database.MaxConnections {
+		u.setCondition(hivev1alpha1.ConditionTypeConnectionBudgetExceeded, metav1.ConditionTrue, conditionReasonOverBudget,
+			fmt.Sprintf("The metastore pools may open %d connections, more than the budget of %d", connections, *database.MaxConnections))
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeConnectionBudgetExceeded, metav1.ConditionFalse, conditionReasonWithinBudget,
+		fmt.Sprintf("The metastore pools open at most %d of %d connections", connections, *database.MaxConnections))
+}
+
+func (u *StatusUpdater) setDegradedCondition(reconcileErr error) {
+	if reconcileErr != nil {
+		u.setCondition(hivev1alpha1.ConditionTypeDegraded, metav1.ConditionTrue, conditionReasonReconcileError,
+			reconcileErr.Error())
+		return
+	}
+	u.setCondition(hivev1alpha1.ConditionTypeDegraded, metav1.ConditionFalse, conditionReasonReconcileSucceeded,
+		"Resources reconciled successfully")
+}
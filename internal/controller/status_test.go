@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+// newTestUnreachableDatabase returns a postgres database whose port refuses connections.
+func newTestUnreachableDatabase(t *testing.T) *hivev1alpha1.DatabaseSpec {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &hivev1alpha1.DatabaseSpec{
+		DatabaseType:      DatabaseTypePostgres,
+		Host:              "127.0.0.1",
+		Port:              int32(port),
+		DatabaseName:      "hive",
+		CredentialsSecret: "hive-credentials",
+	}
+}
+
+func TestSetDatabaseReachableCondition(t *testing.T) {
+	tests := []struct {
+		name           string
+		stopped        bool
+		probed         bool
+		generation     int64
+		expectedReason string
+	}{
+		{name: "probed recently", probed: true, generation: 1, expectedReason: conditionReasonReachable},
+		{name: "not probed recently", generation: 1, expectedReason: conditionReasonUnreachable},
+		{name: "spec changed", probed: true, generation: 2, expectedReason: conditionReasonUnreachable},
+		{name: "stopped", stopped: true, probed: true, generation: 1, expectedReason: conditionReasonNotProbed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &hivev1alpha1.HiveMetastore{
+				ObjectMeta: metav1.ObjectMeta{Name: "hive", Namespace: "ns", Generation: tt.generation},
+				Spec: hivev1alpha1.HiveMetastoreSpec{
+					ClusterConfig:    &hivev1alpha1.ClusterConfigSpec{Database: newTestUnreachableDatabase(t)},
+					ClusterOperation: &commonsv1alpha1.ClusterOperationSpec{Stopped: tt.stopped},
+				},
+				Status: hivev1alpha1.HiveMetastoreStatus{
+					Conditions: []metav1.Condition{{
+						Type:               hivev1alpha1.ConditionTypeDatabaseReachable,
+						Status:             metav1.ConditionTrue,
+						Reason:             conditionReasonReachable,
+						ObservedGeneration: 1,
+					}},
+				},
+			}
+			probes := &DatabaseProbes{}
+			if tt.probed {
+				probes.Record(ctrlclient.ObjectKeyFromObject(instance), time.Now())
+			}
+
+			updater := &StatusUpdater{Instance: instance, DatabaseProbes: probes}
+			updater.setDatabaseReachableCondition(context.Background())
+
+			condition := apimeta.FindStatusCondition(instance.Status.Conditions, hivev1alpha1.ConditionTypeDatabaseReachable)
+			if condition == nil || condition.Reason != tt.expectedReason {
+				t.Errorf("DatabaseReachable condition = %v, expected reason %s", condition, tt.expectedReason)
+			}
+		})
+	}
+}
+
+func TestDatabaseProbes(t *testing.T) {
+	key := ctrlclient.ObjectKey{Namespace: "ns", Name: "hive"}
+	now := time.Now()
+	probes := &DatabaseProbes{}
+	if probes.IsFresh(key, now, time.Minute) {
+		t.Error("IsFresh() = true before any probe")
+	}
+
+	probes.Record(key, now)
+	if !probes.IsFresh(key, now.Add(30*time.Second), time.Minute) {
+		t.Error("IsFresh() = false within the interval")
+	}
+	if probes.IsFresh(key, now.Add(time.Minute), time.Minute) {
+		t.Error("IsFresh() = true after the interval")
+	}
+
+	probes.Forget(key)
+	if probes.IsFresh(key, now, time.Minute) {
+		t.Error("IsFresh() = true after Forget()")
+	}
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/zncdatadev/operator-go/pkg/client"
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	tlsVolumeName = "tls"
+
+	// tlsCACertKey is the key of the CA certificate in the secret-operator CA secret
+	// and in the discovery ConfigMap.
+	tlsCACertKey = "ca.crt"
+)
+
+var (
+	TlsKeystoreFile   = path.Join(constants.KubedoopTlsDir, "keystore.p12")
+	TlsTruststoreFile = path.Join(constants.KubedoopTlsDir, "truststore.p12")
+
+	secretClassGVK = schema.GroupVersionKind{
+		Group:   "secrets.kubedoop.dev",
+		Version: "v1alpha1",
+		Kind:    "SecretClass",
+	}
+)
+
+// IsKerberosEnabled reports whether the cluster authenticates with kerberos.
+func IsKerberosEnabled(clusterConfig *hivev1alpha1.ClusterConfigSpec) bool {
+	return clusterConfig.Authentication != nil && clusterConfig.Authentication.Kerberos != nil
+}
+
+// IsTlsEnabled reports whether the metastore thrift endpoint is served over TLS.
+func IsTlsEnabled(clusterConfig *hivev1alpha1.ClusterConfigSpec) bool {
+	return clusterConfig.Authentication != nil && clusterConfig.Authentication.Tls != nil
+}
+
+// TlsConfig provisions a PKCS12 keystore and truststore from a secret-operator SecretClass.
+type TlsConfig struct {
+	SecretClass string
+	JksPassword string
+
+	// ServiceName is added to the certificate, clients connect through the rolegroup service.
+	ServiceName string
+	RoleName    string
+}
+
+func NewTlsConfig(
+	tls *hivev1alpha1.TlsSpec,
+	serviceName string,
+	roleName string,
+) *TlsConfig {
+	return &TlsConfig{
+		SecretClass: tls.SecretClass,
+		JksPassword: tls.JksPassword,
+		ServiceName: serviceName,
+		RoleName:    roleName,
+	}
+}
+
+// GetHiveSite returns the SSL settings of the metastore server,
+// HiveServer2 is a metastore client and only needs the truststore.
+func (c *TlsConfig) GetHiveSite() map[string]string {
+	properties := map[string]string{
+		"hive.metastore.use.SSL":             "true",
+		"hive.metastore.truststore.path":     TlsTruststoreFile,
+		"hive.metastore.truststore.password": c.JksPassword,
+		"hive.metastore.truststore.type":     "PKCS12",
+	}
+
+	if c.RoleName == MetastoreRoleName {
+		properties["hive.metastore.keystore.path"] = TlsKeystoreFile
+		properties["hive.metastore.keystore.password"] = c.JksPassword
+		properties["hive.metastore.keystore.type"] = "PKCS12"
+	}
+	return properties
+}
+
+func (c *TlsConfig) GetVolumes() []corev1.Volume {
+	scopes := []string{
+		string(constants.PodScope),
+		string(constants.NodeScope),
+		fmt.Sprintf("%s=%s", constants.ServiceScope, c.ServiceName),
+	}
+
+	return []corev1.Volume{
+		{
+			Name: tlsVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Ephemeral: &corev1.EphemeralVolumeSource{
+					VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								constants.AnnotationSecretsClass:          c.SecretClass,
+								constants.AnnotationSecretsScope:          strings.Join(scopes, constants.CommonDelimiter),
+								constants.AnnotationSecretsFormat:         string(constants.TLSP12),
+								constants.AnnotationSecretsPKCS12Password: c.JksPassword,
+							},
+						},
+						Spec: corev1.PersistentVolumeClaimSpec{
+							StorageClassName: constants.SecretStorageClassPtr(),
+							AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+							Resources: corev1.VolumeResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceStorage: resource.MustParse("1Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (c *TlsConfig) GetVolumeMounts() []corev1.VolumeMount {
+	return []corev1.VolumeMount{
+		{
+			Name:      tlsVolumeName,
+			MountPath: constants.KubedoopTlsDir,
+		},
+	}
+}
+
+// GetTlsCACert returns the CA certificate of an autoTls SecretClass.
+// An empty string is returned when the SecretClass does not exist, secret-operator is not installed,
+// or the SecretClass is not backed by an operator managed CA.
+func GetTlsCACert(ctx context.Context, client *client.Client, secretClass string) (string, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(secretClassGVK)
+	if err := client.Get(ctx, ctrlclient.ObjectKey{Name: secretClass}, obj); err != nil {
+		if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	name, _, _ := unstructured.NestedString(obj.Object, "spec", "backend", "autoTls", "ca", "secret", "name")
+	namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "backend", "autoTls", "ca", "secret", "namespace")
+	if name == "" || namespace == "" {
+		return "", nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := client.Get(ctx, ctrlclient.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(secret.Data[tlsCACertKey]), nil
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"testing"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+// newTestAutoTlsSecretClass returns an autoTls SecretClass whose CA is kept in the Secret `namespace/name`.
+func newTestAutoTlsSecretClass(secretClass, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(secretClassGVK)
+	obj.SetName(secretClass)
+	_ = unstructured.SetNestedField(obj.Object, name, "spec", "backend", "autoTls", "ca", "secret", "name")
+	_ = unstructured.SetNestedField(obj.Object, namespace, "spec", "backend", "autoTls", "ca", "secret", "namespace")
+	return obj
+}
+
+func TestTlsConfigGetHiveSite(t *testing.T) {
+	truststore := map[string]string{
+		"hive.metastore.use.SSL":             "true",
+		"hive.metastore.truststore.path":     "/kubedoop/tls/truststore.p12",
+		"hive.metastore.truststore.password": "changeit",
+		"hive.metastore.truststore.type":     "PKCS12",
+	}
+	keystore := map[string]string{
+		"hive.metastore.keystore.path":     "/kubedoop/tls/keystore.p12",
+		"hive.metastore.keystore.password": "changeit",
+		"hive.metastore.keystore.type":     "PKCS12",
+	}
+
+	metastore := maps.Clone(truststore)
+	maps.Copy(metastore, keystore)
+
+	tests := []struct {
+		name     string
+		role     string
+		expected map[string]string
+	}{
+		{name: "metastore", role: MetastoreRoleName, expected: metastore},
+		{name: "hiveserver2", role: HiveServer2RoleName, expected: truststore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tls := &hivev1alpha1.TlsSpec{SecretClass: "tls", JksPassword: "changeit"}
+			got := NewTlsConfig(tls, "hive-"+tt.role+"-default", tt.role).GetHiveSite()
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("GetHiveSite() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTlsConfigGetVolumes(t *testing.T) {
+	tls := &hivev1alpha1.TlsSpec{SecretClass: "tls", JksPassword: "secret"}
+	config := NewTlsConfig(tls, "hive-metastore-default", MetastoreRoleName)
+
+	volumes := config.GetVolumes()
+	if len(volumes) != 1 {
+		t.Fatalf("GetVolumes() returned %d volumes, expected 1", len(volumes))
+	}
+	annotations := volumes[0].Ephemeral.VolumeClaimTemplate.Annotations
+	expected := map[string]string{
+		constants.AnnotationSecretsClass:          "tls",
+		constants.AnnotationSecretsScope:          "pod,node,service=hive-metastore-default",
+		constants.AnnotationSecretsFormat:         string(constants.TLSP12),
+		constants.AnnotationSecretsPKCS12Password: "secret",
+	}
+	if !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("annotations = %v, expected %v", annotations, expected)
+	}
+
+	mounts := config.GetVolumeMounts()
+	if len(mounts) != 1 || mounts[0].Name != volumes[0].Name || mounts[0].MountPath != constants.KubedoopTlsDir {
+		t.Errorf("GetVolumeMounts() = %v, expected %s mounted at %s", mounts, volumes[0].Name, constants.KubedoopTlsDir)
+	}
+}
+
+func TestGetTlsCACert(t *testing.T) {
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret-provisioner-tls-ca", Namespace: "kubedoop-operators"},
+		Data:       map[string][]byte{tlsCACertKey: []byte("-----BEGIN CERTIFICATE-----")},
+	}
+	tests := []struct {
+		name     string
+		objs     []ctrlclient.Object
+		expected string
+	}{
+		{
+			name:     "autoTls",
+			objs:     []ctrlclient.Object{newTestAutoTlsSecretClass("tls", caSecret.Namespace, caSecret.Name), caSecret},
+			expected: "-----BEGIN CERTIFICATE-----",
+		},
+		{name: "missing SecretClass"},
+		{name: "missing CA secret", objs: []ctrlclient.Object{newTestAutoTlsSecretClass("tls", caSecret.Namespace, caSecret.Name)}},
+		{name: "not autoTls", objs: []ctrlclient.Object{newTestKerberosSecretClass("tls", "EXAMPLE.COM")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, err := GetTlsCACert(context.Background(), newTestClient(t, tt.objs...), "tls")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ca != tt.expected {
+				t.Errorf("GetTlsCACert() = %q, expected %q", ca, tt.expected)
+			}
+		})
+	}
+}
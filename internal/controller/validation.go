@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+const (
+	InvalidSpecReasonDatabase  = "InvalidDatabase"
+	InvalidSpecReasonReplicas  = "InvalidReplicas"
+	InvalidSpecReasonLibraries = "InvalidLibraries"
+	InvalidSpecReasonBackup    = "InvalidBackup"
+	InvalidSpecReasonRestore   = "InvalidRestore"
+	InvalidSpecReasonOverrides = "InvalidConfigOverrides"
+	// The reasons below are also reported by the validating webhook, before the spec is stored.
+	InvalidSpecReasonRoleGroups     = "InvalidRoleGroups"
+	InvalidSpecReasonWarehouseDir   = "InvalidWarehouseDir"
+	InvalidSpecReasonS3             = "InvalidS3"
+	InvalidSpecReasonAuthentication = "InvalidAuthentication"
+)
+
+// InvalidSpecError is returned for a spec which cannot be reconciled until it is changed.
+// It is reported with the SpecValid condition, and the reconciliation is not retried.
+type InvalidSpecError struct {
+	Reason  string
+	Message string
+}
+
+func (e *InvalidSpecError) Error() string {
+	return e.Message
+}
+
+// ValidateSpec checks the parts of the spec the CRD schema cannot validate.
+func ValidateSpec(spec *hivev1alpha1.HiveMetastoreSpec) error {
+	if _, err := NewDatabaseConfig(spec.ClusterConfig.Database); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonDatabase, Message: err.Error()}
+	}
+	if err := validateDerbyReplicas(spec); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonReplicas, Message: err.Error()}
+	}
+	if err := validateRoleGroups(spec); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonRoleGroups, Message: err.Error()}
+	}
+	for _, role := range []*hivev1alpha1.RoleSpec{spec.Metastore, spec.HiveServer2} {
+		if err := validateRoleWarehouseDir(role); err != nil {
+			return &InvalidSpecError{Reason: InvalidSpecReasonWarehouseDir, Message: err.Error()}
+		}
+	}
+	if err := validateS3Specs(spec.ClusterConfig); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonS3, Message: err.Error()}
+	}
+	if err := validateKerberosTls(spec.ClusterConfig); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonAuthentication, Message: err.Error()}
+	}
+	for _, role := range []*hivev1alpha1.RoleSpec{spec.Metastore, spec.HiveServer2} {
+		if err := validateRoleLibraries(role); err != nil {
+			return &InvalidSpecError{Reason: InvalidSpecReasonLibraries, Message: err.Error()}
+		}
+	}
+	if err := validateConfigOverrides(MetastoreRoleName, spec.Metastore); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonOverrides, Message: err.Error()}
+	}
+	if err := validateConfigOverrides(HiveServer2RoleName, spec.HiveServer2); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonOverrides, Message: err.Error()}
+	}
+	if err := ValidateBackup(spec.ClusterConfig); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonBackup, Message: err.Error()}
+	}
+	if err := ValidateRestore(spec.ClusterConfig); err != nil {
+		return &InvalidSpecError{Reason: InvalidSpecReasonRestore, Message: err.Error()}
+	}
+	return nil
+}
+
+// validateRoleGroups requires the metastore role and at least one rolegroup in each role,
+// a role without rolegroups renders no StatefulSet.
+func validateRoleGroups(spec *hivev1alpha1.HiveMetastoreSpec) error {
+	if spec.Metastore == nil {
+		return fmt.Errorf("the metastore role is required")
+	}
+	roles := map[string]*hivev1alpha1.RoleSpec{MetastoreRoleName: spec.Metastore, HiveServer2RoleName: spec.HiveServer2}
+	for _, roleName := range []string{MetastoreRoleName, HiveServer2RoleName} {
+		role := roles[roleName]
+		if role == nil {
+			continue
+		}
+		if len(role.RoleGroups) == 0 {
+			return fmt.Errorf("role %s has no rolegroups", roleName)
+		}
+		for _, name := range slices.Sorted(maps.Keys(role.RoleGroups)) {
+			if role.RoleGroups[name] == nil {
+				return fmt.Errorf("rolegroup %s-%s is empty", roleName, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRoleWarehouseDir validates the warehouseDir of the role and of each rolegroup.
+func validateRoleWarehouseDir(role *hivev1alpha1.RoleSpec) error {
+	if role == nil {
+		return nil
+	}
+	if role.Config != nil {
+		if err := validateWarehouseDir(role.Config.WarehouseDir); err != nil {
+			return err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(role.RoleGroups)) {
+		if roleGroup := role.RoleGroups[name]; roleGroup != nil && roleGroup.Config != nil {
+			if err := validateWarehouseDir(roleGroup.Config.WarehouseDir); err != nil {
+				return fmt.Errorf("rolegroup %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateWarehouseDir accepts an absolute path or a URI with a scheme and a path, e.g. s3a://bucket/warehouse.
+// An empty value is defaulted by the CRD.
+func validateWarehouseDir(warehouseDir string) error {
+	if warehouseDir == "" {
+		return nil
+	}
+	if strings.ContainsAny(warehouseDir, " \t\n") {
+		return fmt.Errorf("warehouseDir %q must not contain whitespace", warehouseDir)
+	}
+	u, err := url.Parse(warehouseDir)
+	if err != nil {
+		return fmt.Errorf("warehouseDir %q is not a valid URI: %w", warehouseDir, err)
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(warehouseDir, "/") {
+			return fmt.Errorf("warehouseDir %q must be an absolute path or a URI with a scheme", warehouseDir)
+		}
+		return nil
+	}
+	if u.Opaque != "" || (u.Host == "" && u.Path == "") {
+		return fmt.Errorf("warehouseDir %q must be a hierarchical URI, e.g. s3a://bucket/warehouse", warehouseDir)
+	}
+	return nil
+}
+
+// validateS3Specs requires exactly one of inline and reference in each S3 connection of the spec.
+// The cluster S3 spec may also only reference buckets, which bring their own connections.
+func validateS3Specs(clusterConfig *hivev1alpha1.ClusterConfigSpec) error {
+	if s3 := clusterConfig.S3; s3 != nil {
+		if s3.Inline != nil && s3.Reference != "" {
+			return fmt.Errorf("s3 must set only one of inline and reference")
+		}
+		if !HasS3Connection(s3) && len(s3.Buckets) == 0 {
+			return fmt.Errorf("s3 must set one of inline and reference, or buckets")
+		}
+	}
+	if backup := clusterConfig.Backup; backup != nil && backup.Target != nil && backup.Target.S3 != nil {
+		if backup.Target.S3.Inline != nil && backup.Target.S3.Reference != "" {
+			return fmt.Errorf("backup target s3 must set only one of inline and reference")
+		}
+	}
+	if restore := clusterConfig.RestoreFrom; restore != nil && restore.S3 != nil {
+		if restore.S3.Inline != nil && restore.S3.Reference != "" {
+			return fmt.Errorf("restoreFrom s3 must set only one of inline and reference")
+		}
+	}
+	return nil
+}
+
+// validateKerberosTls rejects kerberos without TLS when the kerberos spec requires it.
+func validateKerberosTls(clusterConfig *hivev1alpha1.ClusterConfigSpec) error {
+	if IsKerberosEnabled(clusterConfig) && clusterConfig.Authentication.Kerberos.RequireTls && !IsTlsEnabled(clusterConfig) {
+		return fmt.Errorf("authentication.kerberos.requireTls requires authentication.tls")
+	}
+	return nil
+}
+
+// validateRoleLibraries validates the libraries of the role and of each rolegroup.
+func validateRoleLibraries(role *hivev1alpha1.RoleSpec) error {
+	if role == nil {
+		return nil
+	}
+	if role.Config != nil {
+		if err := ValidateLibraries(role.Config.Libraries); err != nil {
+			return err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(role.RoleGroups)) {
+		if roleGroup := role.RoleGroups[name]; roleGroup != nil && roleGroup.Config != nil {
+			if err := ValidateLibraries(roleGroup.Config.Libraries); err != nil {
+				return fmt.Errorf("rolegroup %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDerbyReplicas refuses more than one metastore replica with the embedded derby database,
+// each replica would open its own copy and concurrent writers corrupt it.
+func validateDerbyReplicas(spec *hivev1alpha1.HiveMetastoreSpec) error {
+	if spec.ClusterConfig.Database.DatabaseType != DatabaseTypeDerby || spec.Metastore == nil {
+		return nil
+	}
+
+	var total int32
+	for _, name := range slices.Sorted(maps.Keys(spec.Metastore.RoleGroups)) {
+		roleGroup := spec.Metastore.RoleGroups[name]
+		if roleGroup == nil {
+			continue
+		}
+		replicas := roleGroup.Replicas
+		if replicas > 1 {
+			return fmt.Errorf("metastore rolegroup %s has %d replicas, the embedded derby database supports a single replica", name, replicas)
+		}
+		total += replicas
+	}
+	if total > 1 {
+		return fmt.Errorf("metastore has %d replicas in total, the embedded derby database supports a single replica", total)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	s3v1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/s3/v1alpha1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+// newTestSpec returns a valid spec with a postgres database and one metastore replica.
+func newTestSpec() *hivev1alpha1.HiveMetastoreSpec {
+	return &hivev1alpha1.HiveMetastoreSpec{
+		ClusterConfig: &hivev1alpha1.ClusterConfigSpec{
+			Database: &hivev1alpha1.DatabaseSpec{
+				DatabaseType:      DatabaseTypePostgres,
+				Host:              "postgres",
+				DatabaseName:      "hive",
+				CredentialsSecret: "hive-credentials",
+			},
+		},
+		Metastore: &hivev1alpha1.RoleSpec{
+			RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{"default": {Replicas: 1}},
+		},
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	derby := func(spec *hivev1alpha1.HiveMetastoreSpec) {
+		spec.ClusterConfig.Database = &hivev1alpha1.DatabaseSpec{DatabaseType: DatabaseTypeDerby}
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(*hivev1alpha1.HiveMetastoreSpec)
+		expected string
+	}{
+		{name: "postgres"},
+		{name: "derby", mutate: derby},
+		{
+			name:     "unknown database type",
+			mutate:   func(spec *hivev1alpha1.HiveMetastoreSpec) { spec.ClusterConfig.Database.DatabaseType = "sqlite" },
+			expected: InvalidSpecReasonDatabase,
+		},
+		{
+			name:     "database without credentials",
+			mutate:   func(spec *hivev1alpha1.HiveMetastoreSpec) { spec.ClusterConfig.Database.CredentialsSecret = "" },
+			expected: InvalidSpecReasonDatabase,
+		},
+		{
+			name: "derby with two replicas",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				derby(spec)
+				spec.Metastore.RoleGroups["default"].Replicas = 2
+			},
+			expected: InvalidSpecReasonReplicas,
+		},
+		{
+			name: "derby with two rolegroups",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				derby(spec)
+				spec.Metastore.RoleGroups["extra"] = &hivev1alpha1.RoleGroupSpec{Replicas: 1}
+			},
+			expected: InvalidSpecReasonReplicas,
+		},
+		{
+			name:     "without metastore",
+			mutate:   func(spec *hivev1alpha1.HiveMetastoreSpec) { spec.Metastore = nil },
+			expected: InvalidSpecReasonRoleGroups,
+		},
+		{
+			name: "empty rolegroups",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.Metastore.RoleGroups = map[string]*hivev1alpha1.RoleGroupSpec{}
+			},
+			expected: InvalidSpecReasonRoleGroups,
+		},
+		{
+			name: "empty hiveServer2 rolegroups",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.HiveServer2 = &hivev1alpha1.RoleSpec{}
+			},
+			expected: InvalidSpecReasonRoleGroups,
+		},
+		{
+			name: "relative warehouseDir",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.Metastore.Config = &hivev1alpha1.ConfigSpec{WarehouseDir: "warehouse"}
+			},
+			expected: InvalidSpecReasonWarehouseDir,
+		},
+		{
+			name: "s3 with inline and reference",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.ClusterConfig.S3 = &hivev1alpha1.S3Spec{Inline: &s3v1alpha1.S3ConnectionSpec{Host: "minio"}, Reference: "minio"}
+			},
+			expected: InvalidSpecReasonS3,
+		},
+		{
+			name:     "s3 without connection",
+			mutate:   func(spec *hivev1alpha1.HiveMetastoreSpec) { spec.ClusterConfig.S3 = &hivev1alpha1.S3Spec{} },
+			expected: InvalidSpecReasonS3,
+		},
+		{
+			name: "library without source",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.Metastore.Config = &hivev1alpha1.ConfigSpec{Libraries: []hivev1alpha1.LibrarySpec{{Name: "driver"}}}
+			},
+			expected: InvalidSpecReasonLibraries,
+		},
+		{
+			name: "kerberos with hiveServer2 without tls",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.ClusterConfig.Authentication = &hivev1alpha1.AuthenticationSpec{
+					Kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos"},
+				}
+				spec.HiveServer2 = &hivev1alpha1.RoleSpec{
+					RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{"default": {Replicas: 1}},
+				}
+			},
+		},
+		{
+			name: "kerberos requiring tls without tls",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.ClusterConfig.Authentication = &hivev1alpha1.AuthenticationSpec{
+					Kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", RequireTls: true},
+				}
+			},
+			expected: InvalidSpecReasonAuthentication,
+		},
+		{
+			name: "kerberos requiring tls with tls",
+			mutate: func(spec *hivev1alpha1.HiveMetastoreSpec) {
+				spec.ClusterConfig.Authentication = &hivev1alpha1.AuthenticationSpec{
+					Tls:      &hivev1alpha1.TlsSpec{SecretClass: "tls"},
+					Kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", RequireTls: true},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := newTestSpec()
+			if tt.mutate != nil {
+				tt.mutate(spec)
+			}
+
+			err := ValidateSpec(spec)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("ValidateSpec() = %v, expected no error", err)
+				}
+				return
+			}
+			var specErr *InvalidSpecError
+			if !errors.As(err, &specErr) {
+				t.Fatalf("ValidateSpec() = %v, expected an InvalidSpecError", err)
+			}
+			if specErr.Reason != tt.expected {
+				t.Errorf("ValidateSpec() reason = %s (%s), expected %s", specErr.Reason, specErr.Message, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateWarehouseDir(t *testing.T) {
+	tests := []struct {
+		warehouseDir string
+		valid        bool
+	}{
+		{warehouseDir: "", valid: true},
+		{warehouseDir: "/kubedoop/warehouse", valid: true},
+		{warehouseDir: "s3a://bucket/warehouse", valid: true},
+		{warehouseDir: "hdfs://namenode:8020/warehouse", valid: true},
+		{warehouseDir: "s3a://bucket", valid: true},
+		{warehouseDir: "warehouse", valid: false},
+		{warehouseDir: "/kubedoop/my warehouse", valid: false},
+		{warehouseDir: "s3a:bucket/warehouse", valid: false},
+		{warehouseDir: "s3a://", valid: false},
+		{warehouseDir: "s3a://bucket/%zz", valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.warehouseDir, func(t *testing.T) {
+			err := validateWarehouseDir(tt.warehouseDir)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateWarehouseDir(%q) = %v, expected valid=%v", tt.warehouseDir, err, tt.valid)
+			}
+		})
+	}
+}
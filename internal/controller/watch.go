@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	"github.com/zncdatadev/operator-go/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+// Field index keys on HiveMetastore, used to find the clusters referencing a given object.
+const (
+	S3ConnectionIndexKey   = ".spec.s3Connections"
+	S3BucketIndexKey       = ".spec.s3Buckets"
+	DatabaseSecretIndexKey = ".spec.clusterConfig.database.secrets"
+	SecretClassIndexKey    = ".spec.clusterConfig.database.credentials.secretClass"
+	ConfigMapIndexKey      = ".spec.clusterConfig.configMaps"
+)
+
+// SecretClassLabel is the label secret-operator selects the Secrets of a k8sSearch SecretClass by.
+const SecretClassLabel = constants.SecretAPIGroup + "/class"
+
+// newSecretMetadata returns an empty Secret metadata object. The Secret watch only caches the metadata,
+// so reading the metadata does not start an informer caching the data of every Secret.
+func newSecretMetadata() *metav1.PartialObjectMetadata {
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	return obj
+}
+
+// setupIndexes registers the field indexes used by the referenced resource watches.
+func setupIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	indexer := mgr.GetFieldIndexer()
+
+	if err := indexer.IndexField(ctx, &hivev1alpha1.HiveMetastore{}, S3ConnectionIndexKey, indexS3Connection); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &hivev1alpha1.HiveMetastore{}, S3BucketIndexKey, indexS3Buckets); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &hivev1alpha1.HiveMetastore{}, DatabaseSecretIndexKey, indexDatabaseSecrets); err != nil {
+		return err
+	}
+
+	if err := indexer.IndexField(ctx, &hivev1alpha1.HiveMetastore{}, SecretClassIndexKey, indexSecretClass); err != nil {
+		return err
+	}
+
+	return indexer.IndexField(ctx, &hivev1alpha1.HiveMetastore{}, ConfigMapIndexKey, indexConfigMaps)
+}
+
+// indexS3Connection indexes the referenced S3Connections of the warehouse, the backup target and the restore source.
+func indexS3Connection(obj ctrlclient.Object) []string {
+	instance := obj.(*hivev1alpha1.HiveMetastore)
+	clusterConfig := instance.Spec.ClusterConfig
+	if clusterConfig == nil {
+		return nil
+	}
+
+	s3Specs := []*hivev1alpha1.S3Spec{clusterConfig.S3}
+	if clusterConfig.Backup != nil && clusterConfig.Backup.Target != nil {
+		s3Specs = append(s3Specs, clusterConfig.Backup.Target.S3)
+	}
+	if clusterConfig.RestoreFrom != nil {
+		s3Specs = append(s3Specs, clusterConfig.RestoreFrom.S3)
+	}
+
+	connections := []string{}
+	for _, s3Spec := range s3Specs {
+		if s3Spec != nil && s3Spec.Reference != "" && !slices.Contains(connections, s3Spec.Reference) {
+			connections = append(connections, s3Spec.Reference)
+		}
+	}
+	return connections
+}
+
+// indexS3Buckets indexes the S3Buckets of the warehouse and the S3Buckets the libraries are fetched from.
+func indexS3Buckets(obj ctrlclient.Object) []string {
+	instance := obj.(*hivev1alpha1.HiveMetastore)
+	buckets := []string{}
+	if clusterConfig := instance.Spec.ClusterConfig; clusterConfig != nil && clusterConfig.S3 != nil {
+		buckets = append(buckets, clusterConfig.S3.Buckets...)
+	}
+
+	for _, role := range []*hivev1alpha1.RoleSpec{instance.Spec.Metastore, instance.Spec.HiveServer2} {
+		if role == nil {
+			continue
+		}
+		configs := []*hivev1alpha1.ConfigSpec{role.Config}
+		for _, roleGroup := range role.RoleGroups {
+			if roleGroup != nil {
+				configs = append(configs, roleGroup.Config)
+			}
+		}
+		for _, config := range configs {
+			if config == nil {
+				continue
+			}
+			for _, library := range config.Libraries {
+				if library.S3 != nil && !slices.Contains(buckets, library.S3.Bucket) {
+					buckets = append(buckets, library.S3.Bucket)
+				}
+			}
+		}
+	}
+	return buckets
+}
+
+// indexDatabaseSecrets indexes the Secrets mounted by name, the database credentials and CA.
+func indexDatabaseSecrets(obj ctrlclient.Object) []string {
+	instance := obj.(*hivev1alpha1.HiveMetastore)
+	clusterConfig := instance.Spec.ClusterConfig
+	if clusterConfig == nil || clusterConfig.Database == nil {
+		return nil
+	}
+
+	secrets := []string{}
+	if clusterConfig.Database.CredentialsSecret != "" {
+		secrets = append(secrets, clusterConfig.Database.CredentialsSecret)
+	}
+	if tls := clusterConfig.Database.Tls; tls != nil && tls.Secret != "" {
+		secrets = append(secrets, tls.Secret)
+	}
+	return secrets
+}
+
+// indexSecretClass indexes the SecretClass of the database credentials, its Secrets carry the class label.
+func indexSecretClass(obj ctrlclient.Object) []string {
+	instance := obj.(*hivev1alpha1.HiveMetastore)
+	clusterConfig := instance.Spec.ClusterConfig
+	if clusterConfig == nil || clusterConfig.Database == nil || clusterConfig.Database.Credentials == nil {
+		return nil
+	}
+	return []string{clusterConfig.Database.Credentials.SecretClass}
+}
+
+// indexConfigMaps indexes the user provided ConfigMaps, the HDFS discovery ConfigMap
+// and the vector aggregator discovery ConfigMap.
+func indexConfigMaps(obj ctrlclient.Object) []string {
+	instance := obj.(*hivev1alpha1.HiveMetastore)
+	clusterConfig := instance.Spec.ClusterConfig
+	if clusterConfig == nil {
+		return nil
+	}
+
+	configMaps := []string{}
+	if clusterConfig.HDFS != nil && clusterConfig.HDFS.ConfigMap != "" {
+		configMaps = append(configMaps, clusterConfig.HDFS.ConfigMap)
+	}
+	if clusterConfig.VectorAggregatorConfigMapName != "" {
+		configMaps = append(configMaps, clusterConfig.VectorAggregatorConfigMapName)
+	}
+	return configMaps
+}
+
+// enqueueReferencingClusters returns a handler that maps an object to the
+// HiveMetastore objects in the same namespace which reference it through indexKey.
+func enqueueReferencingClusters(client ctrlclient.Client, indexKey string) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(referencingClusters(client, indexKey, ctrlclient.Object.GetName))
+}
+
+// enqueueSecretReferencingClusters returns a handler that maps a Secret to the HiveMetastore objects
+// in the same namespace which mount it by name, or reference the SecretClass of its class label.
+func enqueueSecretReferencingClusters(client ctrlclient.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(referencingSecretClusters(client))
+}
+
+// referencingSecretClusters returns the map function of enqueueSecretReferencingClusters,
+// it only reads the metadata of the Secret.
+func referencingSecretClusters(client ctrlclient.Client) handler.MapFunc {
+	byName := referencingClusters(client, DatabaseSecretIndexKey, ctrlclient.Object.GetName)
+	bySecretClass := referencingClusters(client, SecretClassIndexKey, func(obj ctrlclient.Object) string {
+		return obj.GetLabels()[SecretClassLabel]
+	})
+	return func(ctx context.Context, obj ctrlclient.Object) []reconcile.Request {
+		return append(byName(ctx, obj), bySecretClass(ctx, obj)...)
+	}
+}
+
+// referencingClusters returns a map function listing the HiveMetastore objects in the namespace
+// of the object whose indexKey matches the value of the object.
+func referencingClusters(client ctrlclient.Client, indexKey string, value func(ctrlclient.Object) string) handler.MapFunc {
+	return func(ctx context.Context, obj ctrlclient.Object) []reconcile.Request {
+		indexValue := value(obj)
+		if indexValue == "" {
+			return nil
+		}
+
+		list := &hivev1alpha1.HiveMetastoreList{}
+		if err := client.List(
+			ctx,
+			list,
+			ctrlclient.InNamespace(obj.GetNamespace()),
+			ctrlclient.MatchingFields{indexKey: indexValue},
+		); err != nil {
+			log.Error(err, "Failed to list HiveMetastore referencing object", "index", indexKey, "namespace", obj.GetNamespace(), "name", obj.GetName())
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(list.Items))
+		for _, item := range list.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name},
+			})
+		}
+		return requests
+	}
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+)
+
+func newTestIndexedCluster() *hivev1alpha1.HiveMetastore {
+	return &hivev1alpha1.HiveMetastore{
+		ObjectMeta: metav1.ObjectMeta{Name: "hive", Namespace: "ns"},
+		Spec: hivev1alpha1.HiveMetastoreSpec{
+			ClusterConfig: &hivev1alpha1.ClusterConfigSpec{
+				Database: &hivev1alpha1.DatabaseSpec{
+					DatabaseType:      DatabaseTypePostgres,
+					CredentialsSecret: "hive-credentials",
+					Tls:               &hivev1alpha1.DatabaseTlsSpec{Secret: "postgres-ca"},
+				},
+				S3: &hivev1alpha1.S3Spec{Reference: "warehouse", Buckets: []string{"warehouse"}},
+				Backup: &hivev1alpha1.BackupSpec{
+					Target: &hivev1alpha1.BackupTargetSpec{S3: &hivev1alpha1.S3Spec{Reference: "backups"}},
+				},
+				RestoreFrom:                   &hivev1alpha1.RestoreSpec{S3: &hivev1alpha1.S3Spec{Reference: "warehouse"}},
+				HDFS:                          &hivev1alpha1.HDFSSpec{ConfigMap: "hdfs"},
+				VectorAggregatorConfigMapName: "vector",
+			},
+			Metastore: &hivev1alpha1.RoleSpec{
+				Config: &hivev1alpha1.ConfigSpec{
+					Libraries: []hivev1alpha1.LibrarySpec{
+						{Name: "driver", S3: &hivev1alpha1.LibraryS3Spec{Bucket: "jars", Key: "driver.jar"}},
+					},
+				},
+				RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{
+					"default": {
+						Replicas: 1,
+						Config: &hivev1alpha1.ConfigSpec{
+							Libraries: []hivev1alpha1.LibrarySpec{
+								{Name: "udf", S3: &hivev1alpha1.LibraryS3Spec{Bucket: "udfs", Key: "udf.jar"}},
+								{Name: "url", URL: "https://example.com/url.jar"},
+							},
+						},
+					},
+				},
+			},
+			HiveServer2: &hivev1alpha1.RoleSpec{
+				Config: &hivev1alpha1.ConfigSpec{
+					Libraries: []hivev1alpha1.LibrarySpec{
+						{Name: "driver", S3: &hivev1alpha1.LibraryS3Spec{Bucket: "jars", Key: "driver.jar"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	instance := newTestIndexedCluster()
+	tests := []struct {
+		name     string
+		index    func(ctrlclient.Object) []string
+		expected []string
+	}{
+		{name: "s3 connections", index: indexS3Connection, expected: []string{"warehouse", "backups"}},
+		{name: "s3 buckets", index: indexS3Buckets, expected: []string{"jars", "udfs", "warehouse"}},
+		{name: "database secrets", index: indexDatabaseSecrets, expected: []string{"hive-credentials", "postgres-ca"}},
+		{name: "config maps", index: indexConfigMaps, expected: []string{"hdfs", "vector"}},
+		{name: "secret class", index: indexSecretClass},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.index(instance)
+			slices.Sort(values)
+			expected := slices.Sorted(slices.Values(tt.expected))
+			if !slices.Equal(values, expected) {
+				t.Errorf("index = %v, expected %v", values, expected)
+			}
+		})
+	}
+
+	// A cluster without a cluster config references nothing.
+	empty := &hivev1alpha1.HiveMetastore{}
+	for _, index := range []func(ctrlclient.Object) []string{indexS3Connection, indexS3Buckets, indexDatabaseSecrets, indexSecretClass, indexConfigMaps} {
+		if values := index(empty); len(values) != 0 {
+			t.Errorf("index of an empty cluster = %v, expected none", values)
+		}
+	}
+}
+
+func TestEnqueueSecretReferencingClusters(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := hivev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := newTestIndexedCluster()
+	bySecretClass := &hivev1alpha1.HiveMetastore{
+		ObjectMeta: metav1.ObjectMeta{Name: "class", Namespace: "ns"},
+		Spec: hivev1alpha1.HiveMetastoreSpec{
+			ClusterConfig: &hivev1alpha1.ClusterConfigSpec{
+				Database: &hivev1alpha1.DatabaseSpec{
+					DatabaseType: DatabaseTypePostgres,
+					Credentials:  &hivev1alpha1.DatabaseCredentialsSpec{Credentials: commonsv1alpha1.Credentials{SecretClass: "postgres"}},
+				},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(byName, bySecretClass).
+		WithIndex(&hivev1alpha1.HiveMetastore{}, DatabaseSecretIndexKey, indexDatabaseSecrets).
+		WithIndex(&hivev1alpha1.HiveMetastore{}, SecretClassIndexKey, indexSecretClass).
+		Build()
+	mapFunc := referencingSecretClusters(c)
+
+	tests := []struct {
+		name     string
+		secret   *corev1.Secret
+		expected []string
+	}{
+		{
+			name:     "by name",
+			secret:   &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "postgres-ca", Namespace: "ns"}},
+			expected: []string{"hive"},
+		},
+		{
+			name: "by secret class",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+				Name: "postgres-credentials", Namespace: "ns", Labels: map[string]string{SecretClassLabel: "postgres"},
+			}},
+			expected: []string{"class"},
+		},
+		{
+			name:   "other namespace",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "postgres-ca", Namespace: "other"}},
+		},
+		{
+			name:   "unreferenced",
+			secret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "ns"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, request := range mapFunc(context.Background(), tt.secret) {
+				names = append(names, request.Name)
+			}
+			if !slices.Equal(names, tt.expected) {
+				t.Errorf("requests = %v, expected %v", names, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/controller"
+)
+
+var hivemetastorelog = logf.Log.WithName("hivemetastore-resource")
+
+// invalidSpecPaths maps the reasons of controller.InvalidSpecError to the field reported by the webhook.
+var invalidSpecPaths = map[string]*field.Path{
+	controller.InvalidSpecReasonDatabase:       field.NewPath("spec", "clusterConfig", "database"),
+	controller.InvalidSpecReasonReplicas:       field.NewPath("spec", "metastore", "roleGroups"),
+	controller.InvalidSpecReasonLibraries:      field.NewPath("spec"),
+	controller.InvalidSpecReasonBackup:         field.NewPath("spec", "clusterConfig", "backup"),
+	controller.InvalidSpecReasonRestore:        field.NewPath("spec", "clusterConfig", "restoreFrom"),
+	controller.InvalidSpecReasonOverrides:      field.NewPath("spec"),
+	controller.InvalidSpecReasonRoleGroups:     field.NewPath("spec"),
+	controller.InvalidSpecReasonWarehouseDir:   field.NewPath("spec"),
+	controller.InvalidSpecReasonS3:             field.NewPath("spec", "clusterConfig"),
+	controller.InvalidSpecReasonAuthentication: field.NewPath("spec", "clusterConfig", "authentication"),
+}
+
+// SetupHiveMetastoreWebhookWithManager registers the webhook for HiveMetastore in the manager.
+func SetupHiveMetastoreWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &hivev1alpha1.HiveMetastore{}).
+		WithValidator(&HiveMetastoreCustomValidator{}).
+		WithDefaulter(&HiveMetastoreCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-hive-kubedoop-dev-v1alpha1-hivemetastore,mutating=true,failurePolicy=fail,sideEffects=None,groups=hive.kubedoop.dev,resources=hivemetastores,verbs=create;update,versions=v1alpha1,name=mhivemetastore-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// HiveMetastoreCustomDefaulter sets the defaults of the operator when a HiveMetastore is created or updated,
+// the stored object shows the image versions and the database settings which are used.
+type HiveMetastoreCustomDefaulter struct{}
+
+var _ admission.Defaulter[*hivev1alpha1.HiveMetastore] = &HiveMetastoreCustomDefaulter{}
+
+// Default implements admission.Defaulter.
+func (d *HiveMetastoreCustomDefaulter) Default(_ context.Context, obj *hivev1alpha1.HiveMetastore) error {
+	hivemetastorelog.Info("Defaulting for HiveMetastore", "name", obj.GetName())
+
+	controller.DefaultSpec(&obj.Spec)
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-hive-kubedoop-dev-v1alpha1-hivemetastore,mutating=false,failurePolicy=fail,sideEffects=None,groups=hive.kubedoop.dev,resources=hivemetastores,verbs=create;update,versions=v1alpha1,name=vhivemetastore-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// HiveMetastoreCustomValidator rejects the specs the controller would report as invalid,
+// so they are refused before they are stored, and changes of immutable fields.
+type HiveMetastoreCustomValidator struct{}
+
+var _ admission.Validator[*hivev1alpha1.HiveMetastore] = &HiveMetastoreCustomValidator{}
+
+// ValidateCreate implements admission.Validator.
+func (v *HiveMetastoreCustomValidator) ValidateCreate(_ context.Context, obj *hivev1alpha1.HiveMetastore) (admission.Warnings, error) {
+	hivemetastorelog.Info("Validation for HiveMetastore upon creation", "name", obj.GetName())
+
+	return nil, toInvalid(obj, validateSpec(&obj.Spec))
+}
+
+// ValidateUpdate implements admission.Validator.
+func (v *HiveMetastoreCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj *hivev1alpha1.HiveMetastore) (admission.Warnings, error) {
+	hivemetastorelog.Info("Validation for HiveMetastore upon update", "name", newObj.GetName())
+
+	allErrs := validateSpec(&newObj.Spec)
+	allErrs = append(allErrs, validateImmutableFields(&oldObj.Spec, &newObj.Spec)...)
+	return nil, toInvalid(newObj, allErrs)
+}
+
+// ValidateDelete implements admission.Validator.
+func (v *HiveMetastoreCustomValidator) ValidateDelete(_ context.Context, _ *hivev1alpha1.HiveMetastore) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func toInvalid(obj *hivev1alpha1.HiveMetastore, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: hivev1alpha1.GroupVersion.Group, Kind: "HiveMetastore"},
+		obj.Name,
+		allErrs,
+	)
+}
+
+// validateSpec runs the validation of the controller, it reports the first invalid part of the spec.
+func validateSpec(spec *hivev1alpha1.HiveMetastoreSpec) field.ErrorList {
+	if spec.ClusterConfig == nil || spec.ClusterConfig.Database == nil {
+		return field.ErrorList{field.Required(field.NewPath("spec", "clusterConfig", "database"), "")}
+	}
+
+	err := controller.ValidateSpec(spec)
+	if err == nil {
+		return nil
+	}
+	var specErr *controller.InvalidSpecError
+	if !errors.As(err, &specErr) {
+		return field.ErrorList{field.InternalError(field.NewPath("spec"), err)}
+	}
+	path, ok := invalidSpecPaths[specErr.Reason]
+	if !ok {
+		path = field.NewPath("spec")
+	}
+	return field.ErrorList{field.Invalid(path, specErr.Reason, specErr.Message)}
+}
+
+// validateImmutableFields refuses changes which the running cluster cannot follow.
+func validateImmutableFields(oldSpec, newSpec *hivev1alpha1.HiveMetastoreSpec) field.ErrorList {
+	var allErrs field.ErrorList
+	// Objects stored before the defaulting webhook lack the defaults the new object was given.
+	oldSpec = oldSpec.DeepCopy()
+	controller.DefaultSpec(oldSpec)
+	if oldSpec.ClusterConfig == nil || oldSpec.ClusterConfig.Database == nil ||
+		newSpec.ClusterConfig == nil || newSpec.ClusterConfig.Database == nil {
+		return nil
+	}
+	oldDatabase := oldSpec.ClusterConfig.Database
+	newDatabase := newSpec.ClusterConfig.Database
+	databasePath := field.NewPath("spec", "clusterConfig", "database")
+
+	// The metastore data is not migrated between databases, a stopped cluster can be pointed elsewhere.
+	stopped := oldSpec.ClusterOperation != nil && oldSpec.ClusterOperation.Stopped
+	if oldDatabase.DatabaseType != newDatabase.DatabaseType && !stopped {
+		allErrs = append(allErrs, field.Forbidden(databasePath.Child("databaseType"),
+			"the database type of a running cluster cannot be changed, stop the cluster first"))
+	}
+
+	// The derby PVC is a volumeClaimTemplate of the metastore StatefulSets, which is immutable.
+	if oldDatabase.DatabaseType == controller.DatabaseTypeDerby && newDatabase.DatabaseType == controller.DatabaseTypeDerby &&
+		!reflect.DeepEqual(oldDatabase.Storage, newDatabase.Storage) {
+		allErrs = append(allErrs, field.Forbidden(databasePath.Child("storage"),
+			"the storage of the derby database cannot be changed"))
+	}
+	return allErrs
+}
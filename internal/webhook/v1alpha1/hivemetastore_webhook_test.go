@@ -0,0 +1,153 @@
+/*
+Copyright 2024 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	commonsv1alpha1 "github.com/zncdatadev/operator-go/pkg/apis/commons/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hivev1alpha1 "github.com/zncdatadev/hive-operator/api/v1alpha1"
+	"github.com/zncdatadev/hive-operator/internal/controller"
+)
+
+func newTestHiveMetastore(database *hivev1alpha1.DatabaseSpec) *hivev1alpha1.HiveMetastore {
+	return &hivev1alpha1.HiveMetastore{
+		ObjectMeta: metav1.ObjectMeta{Name: "hive", Namespace: "default"},
+		Spec: hivev1alpha1.HiveMetastoreSpec{
+			ClusterConfig: &hivev1alpha1.ClusterConfigSpec{Database: database},
+			Metastore: &hivev1alpha1.RoleSpec{
+				RoleGroups: map[string]*hivev1alpha1.RoleGroupSpec{"default": {Replicas: 1}},
+			},
+		},
+	}
+}
+
+func newTestPostgres() *hivev1alpha1.DatabaseSpec {
+	return &hivev1alpha1.DatabaseSpec{
+		DatabaseType:      controller.DatabaseTypePostgres,
+		Host:              "postgres",
+		DatabaseName:      "hive",
+		CredentialsSecret: "hive-credentials",
+	}
+}
+
+func newTestDerby(capacity string) *hivev1alpha1.DatabaseSpec {
+	database := &hivev1alpha1.DatabaseSpec{DatabaseType: controller.DatabaseTypeDerby}
+	if capacity != "" {
+		database.Storage = &commonsv1alpha1.StorageResource{Capacity: resource.MustParse(capacity)}
+	}
+	return database
+}
+
+func TestHiveMetastoreCustomValidatorValidateCreate(t *testing.T) {
+	kerberos := func(obj *hivev1alpha1.HiveMetastore, requireTls bool) *hivev1alpha1.HiveMetastore {
+		obj.Spec.ClusterConfig.Authentication = &hivev1alpha1.AuthenticationSpec{
+			Kerberos: &hivev1alpha1.KerberosSpec{SecretClass: "kerberos", RequireTls: requireTls},
+		}
+		return obj
+	}
+
+	tests := []struct {
+		name    string
+		obj     *hivev1alpha1.HiveMetastore
+		invalid bool
+	}{
+		{name: "postgres", obj: newTestHiveMetastore(newTestPostgres())},
+		{name: "without database", obj: newTestHiveMetastore(nil), invalid: true},
+		{name: "unknown database type", obj: newTestHiveMetastore(&hivev1alpha1.DatabaseSpec{DatabaseType: "sqlite"}), invalid: true},
+		{name: "kerberos requiring tls without tls", obj: kerberos(newTestHiveMetastore(newTestPostgres()), true), invalid: true},
+		{name: "kerberos without tls", obj: kerberos(newTestHiveMetastore(newTestPostgres()), false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&HiveMetastoreCustomValidator{}).ValidateCreate(context.Background(), tt.obj)
+			assertInvalid(t, err, tt.invalid)
+		})
+	}
+}
+
+func TestHiveMetastoreCustomValidatorValidateUpdate(t *testing.T) {
+	stopped := func(obj *hivev1alpha1.HiveMetastore) *hivev1alpha1.HiveMetastore {
+		obj.Spec.ClusterOperation = &commonsv1alpha1.ClusterOperationSpec{Stopped: true}
+		return obj
+	}
+
+	tests := []struct {
+		name    string
+		oldObj  *hivev1alpha1.HiveMetastore
+		newObj  *hivev1alpha1.HiveMetastore
+		invalid bool
+	}{
+		{
+			name:   "unchanged",
+			oldObj: newTestHiveMetastore(newTestPostgres()),
+			newObj: newTestHiveMetastore(newTestPostgres()),
+		},
+		{
+			name:    "database type of a running cluster",
+			oldObj:  newTestHiveMetastore(newTestDerby("1Gi")),
+			newObj:  newTestHiveMetastore(newTestPostgres()),
+			invalid: true,
+		},
+		{
+			name:   "database type of a stopped cluster",
+			oldObj: stopped(newTestHiveMetastore(newTestDerby("1Gi"))),
+			newObj: newTestHiveMetastore(newTestPostgres()),
+		},
+		{
+			name:    "derby storage",
+			oldObj:  newTestHiveMetastore(newTestDerby("1Gi")),
+			newObj:  newTestHiveMetastore(newTestDerby("2Gi")),
+			invalid: true,
+		},
+		{
+			name:   "derby storage stored before the defaulting",
+			oldObj: newTestHiveMetastore(newTestDerby("")),
+			newObj: newTestHiveMetastore(newTestDerby("1Gi")),
+		},
+		{
+			name:    "invalid new spec",
+			oldObj:  newTestHiveMetastore(newTestPostgres()),
+			newObj:  newTestHiveMetastore(&hivev1alpha1.DatabaseSpec{DatabaseType: controller.DatabaseTypePostgres}),
+			invalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&HiveMetastoreCustomValidator{}).ValidateUpdate(context.Background(), tt.oldObj, tt.newObj)
+			assertInvalid(t, err, tt.invalid)
+		})
+	}
+}
+
+func assertInvalid(t *testing.T, err error, invalid bool) {
+	t.Helper()
+	if !invalid {
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		return
+	}
+	if !apierrors.IsInvalid(err) {
+		t.Errorf("expected an Invalid error, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2024 zncdatadev.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	hivev1alpha2 "github.com/zncdatadev/hive-operator/api/v1alpha2"
+)
+
+// SetupHiveMetastoreWebhookWithManager registers the conversion webhook of HiveMetastore in the manager.
+// v1alpha2 is the hub and the storage version, v1alpha1 objects are converted through it. Requests in
+// v1alpha2 are defaulted and validated by the webhooks of v1alpha1, which the API server calls with the
+// converted object.
+func SetupHiveMetastoreWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &hivev1alpha2.HiveMetastore{}).
+		Complete()
+}